@@ -1,58 +1,176 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fileserver/config"
 	"fileserver/internal/api"
+	"fileserver/internal/metrics"
+	"fileserver/internal/middleware"
+	"fileserver/internal/service"
+	"fileserver/internal/storage"
 	"fileserver/internal/utils"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	// Defer a function to catch any runtime panics and log them.
-	// This helps in recovering from unexpected fatal errors.
-	defer func() {
-		if r := recover(); r != nil {
-			log.Fatalf("Catch fatal error: %v\n", r) // Log the fatal error if panic occurs
-		}
-	}()
-
 	// Get the application profile from environment variables or default to "prod" if not set.
 	profile := utils.DefaultValue(os.Getenv("APP_PROFILE"), "prod")
 
+	// Run the migrate command instead of the server when requested: fileserver migrate up|down [n]|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(profile, os.Args[2:]))
+	}
+
 	// Initialize the configuration for the application based on the profile.
 	if err := config.Initialize(profile); err != nil {
 		// If an error occurs during initialization, log the error and terminate the application.
-		log.Fatalf("Error to read %s configuration: %v\n", profile, err)
+		slog.Error("Error to read the configuration", "profile", profile, "error", err)
+		os.Exit(1)
 	}
 
 	// Log the profile that is being used to start the application.
-	log.Printf("Application starting with profile: %s", profile)
+	slog.Info("Application starting", "profile", profile)
+
+	// Measure the storage operations, the database queries and the stored documents
+	if err := initializeMetrics(); err != nil {
+		slog.Error("Error initializing metrics", "error", err)
+		os.Exit(1)
+	}
+
+	// Stop on SIGINT or SIGTERM, as sent by the orchestrators before killing the container.
+	stop, cancelStop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancelStop()
+
+	// The background jobs are stopped only once the in-flight requests are drained,
+	// since the uploads completed during the grace period still queue their indexing.
+	background, cancelBackground := context.WithCancel(context.Background())
+	defer cancelBackground()
+
+	// Start the purger of the trash, if configured
+	if trash := config.App.Trash; trash != nil && trash.Retention > 0 {
+		interval := time.Duration(trash.PurgeInterval)
+		if interval <= 0 {
+			interval = time.Hour
+		}
+		slog.Info("Start trash purger", "retention", time.Duration(trash.Retention), "interval", interval)
+		service.StartTrashPurger(background, interval, time.Duration(trash.Retention))
+	}
+
+	// Start the indexer of the document contents for the full-text search
+	if config.DB != nil {
+		slog.Info("Start search indexer")
+		service.StartIndexer(background)
+	}
 
 	// Create a new HTTP request multiplexer (ServeMux) to register routes.
 	mux := http.NewServeMux()
-	log.Printf("Register all routes\n")
+	slog.Info("Register all routes", "count", len(api.Routes))
+
+	// Warn when the routes are open to anonymous clients
+	if !config.App.Auth.Enabled() {
+		slog.Warn("Authentication is disabled: every route is open to anonymous clients")
+	}
 
 	// Iterate through the routes defined in the API package and register them.
-	for url, handler := range api.Routes {
-		// For each route, log the URL and corresponding handler function name.
-		log.Printf("Register route %s for %v", url, utils.GetFunctionName(handler))
-		// Register the route and associate it with the handler function.
-		mux.HandleFunc(url, handler)
+	for url, route := range api.Routes {
+		// For each route, log the URL, the corresponding handler function name and the scope it requires.
+		slog.Debug("Register route", "route", url, "handler", utils.GetFunctionName(route.Handler), "scope", route.Scope)
+		// Register the route and associate it with the handler function, behind the metrics of the route,
+		// the authentication and the middlewares of the route.
+		middlewares := append([]middleware.Middleware{middleware.Metrics(url)}, api.RouteMiddlewares[url]...)
+		mux.Handle(url, middleware.Chain(api.Authenticate(route.Scope, route.Handler), middlewares...))
 	}
 
-	// Get the server configuration from the app's config settings.
-	server := config.App.Server
-	// Format the server's host and port into a string for the URL.
-	url := fmt.Sprintf("%s:%d", server.Host, server.Port)
-	// Log the server's URL where it will be listening.
-	log.Printf("Start server on %s\n", url)
+	// Wrap every route with the global middlewares: the request ID first, so that the access log and the
+	// panics carry it, then the access log, which records the 500 answered to a panic.
+	handler := middleware.Chain(mux,
+		middleware.RequestID,
+		middleware.AccessLog,
+		middleware.Recover,
+		middleware.CORS(config.App.Server.CORS),
+	)
 
-	// Start the HTTP server using the specified host and port, and pass in the mux for routing.
-	// If an error occurs while starting the server, log it and terminate the program.
-	if err := http.ListenAndServe(url, mux); err != nil {
-		log.Fatalf("%v\n", err)
+	// Create the HTTP server from the server configuration. The read and write timeouts are left unset
+	// unless configured, so that the large uploads and downloads are not cut off.
+	settings := config.App.Server
+	server := &http.Server{
+		Addr:              settings.Address(),
+		Handler:           handler,
+		ReadHeaderTimeout: settings.HeaderTimeout(),
+		ReadTimeout:       time.Duration(settings.ReadTimeout),
+		WriteTimeout:      time.Duration(settings.WriteTimeout),
+		IdleTimeout:       settings.KeepAliveTimeout(),
+		MaxHeaderBytes:    settings.MaxHeaderBytes,
+		TLSConfig:         config.ServerTLS,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+
+	// Start the HTTP server in background, reporting the failures to listen.
+	// With TLS the certificates come from the TLS configuration, which reloads them when they change.
+	failed := make(chan error, 1)
+	go func() {
+		var err error
+		slog.Info("Start server", "address", server.Addr, "tls", server.TLSConfig != nil)
+		if server.TLSConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+
+	// Wait for a signal, or for the server to fail
+	select {
+	case err := <-failed:
+		slog.Error("Server failed", "error", err)
+		os.Exit(1)
+	case <-stop.Done():
+		cancelStop()
+	}
+
+	// Stop accepting connections and wait for the in-flight requests, within the grace period
+	slog.Info("Shutting down server, waiting for the in-flight requests", "grace_period", settings.GracePeriod())
+	ctx, cancel := context.WithTimeout(context.Background(), settings.GracePeriod())
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Error shutting down server, closing the remaining connections", "error", err)
+		server.Close()
+	}
+
+	// Stop the background jobs and release the clients
+	cancelBackground()
+	if err := config.Close(); err != nil {
+		slog.Error("Error closing clients", "error", err)
+	}
+	slog.Info("Server stopped")
+}
+
+// initializeMetrics instruments the storage backend and the database, and registers the metrics of the
+// stored documents, which are counted on the database at every scrape.
+func initializeMetrics() error {
+	backend := "minio"
+	if config.App.Storage != nil && config.App.Storage.Type != "" {
+		backend = config.App.Storage.Type
+	}
+	config.Store = storage.Instrument(config.Store, metrics.StorageObserver(backend))
+
+	if config.DB == nil {
+		return nil
+	}
+	if err := metrics.InstrumentDB(config.DB); err != nil {
+		return fmt.Errorf("error instrumenting database: %v", err)
 	}
+	return metrics.RegisterDocuments(func() (metrics.DocumentCount, metrics.DocumentCount, error) {
+		available, trashed, err := service.GetDocumentStats()
+		return metrics.DocumentCount(available), metrics.DocumentCount(trashed), err
+	})
 }
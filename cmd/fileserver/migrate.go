@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fileserver/config"
+	"fileserver/internal/migrations"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// migrateUsage describes the arguments of the migrate command.
+const migrateUsage = `usage: fileserver migrate <command>
+
+commands:
+  up        apply all the pending migrations
+  down [n]  revert the last n applied migrations (default 1)
+  status    list the migrations and whether they are applied`
+
+// runMigrate runs the migrate command against the database of a profile, without starting the server.
+//
+// Parameters:
+// - profile (string): The application profile whose database is migrated.
+// - args ([]string): The arguments following "migrate" on the command line.
+//
+// Returns:
+// - int: The exit code of the command, 0 on success.
+func runMigrate(profile string, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	// Step 1: Parse the command before connecting to anything
+	command, steps := args[0], 1
+	switch {
+	case command == "up" && len(args) == 1, command == "status" && len(args) == 1:
+	case command == "down" && len(args) <= 2:
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				fmt.Fprintf(os.Stderr, "invalid number of migrations %q\n", args[1])
+				return 2
+			}
+			steps = n
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	// Step 2: Connect to the database, leaving the schema as it is
+	config.DisableAutoMigrate = true
+	if err := config.Initialize(profile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error to read %s configuration: %v\n", profile, err)
+		return 1
+	}
+	if config.DB == nil {
+		fmt.Fprintf(os.Stderr, "No database configured for profile %s\n", profile)
+		return 1
+	}
+
+	// Step 3: Run the command
+	switch command {
+	case "up":
+		applied, err := migrations.Up(config.DB)
+		for _, migration := range applied {
+			fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+	case "down":
+		reverted, err := migrations.Down(config.DB, steps)
+		for _, migration := range reverted {
+			fmt.Printf("Reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No migration to revert")
+		}
+	case "status":
+		statuses, err := migrations.GetStatus(config.DB)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-30s %s\n", status.Version, status.Name, state)
+		}
+	}
+	return 0
+}
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"fileserver/internal/logging"
+	"fileserver/internal/migrations"
+	"fileserver/internal/storage"
 	"fileserver/internal/utils"
 	"fmt"
 	"github.com/minio/minio-go/v7"
@@ -9,7 +13,11 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"log/slog"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 )
 
 // Application represents the top-level structure of the application's configuration.
@@ -17,12 +25,143 @@ type Application struct {
 	Server   *Server   `json:"server"`   // Server configuration
 	Database *Database `json:"database"` // Database configuration
 	Minio    *Minio    `json:"minio"`    // MinIO configuration
+	Storage  *Storage  `json:"storage"`  // Object storage backend configuration
+	Upload   *Upload   `json:"upload"`   // Upload handling configuration
+	Trash    *Trash    `json:"trash"`    // Trash and purger configuration
+	Search   *Search   `json:"search"`   // Full-text search configuration
+	Auth     *Auth     `json:"auth"`     // Authentication configuration
+	Log      *Log      `json:"log"`      // Logging configuration
+}
+
+// Log holds the configuration of the logs, written to the standard error.
+type Log struct {
+	Level  string `json:"level"`  // Minimum level written: "debug", "info" (default), "warn" or "error"
+	Format string `json:"format"` // Format of the records: "text" (default) or "json"
+}
+
+// Defaults of the logs.
+const (
+	defaultLogLevel  = "info"
+	defaultLogFormat = logging.FormatText
+)
+
+// LogLevel returns the minimum level of the logs, "info" when not configured.
+func (l *Log) LogLevel() string {
+	if l == nil {
+		return defaultLogLevel
+	}
+	return utils.DefaultValue(l.Level, defaultLogLevel)
+}
+
+// LogFormat returns the format of the logs, "text" when not configured.
+func (l *Log) LogFormat() string {
+	if l == nil {
+		return defaultLogFormat
+	}
+	return utils.DefaultValue(l.Format, defaultLogFormat)
 }
 
 // Server holds the configuration related to the web server (e.g., host, port).
 type Server struct {
 	Host string `json:"host"` // Hostname or IP address for the server
 	Port int    `json:"port"` // Port number on which the server will run
+
+	ReadHeaderTimeout Duration `json:"readHeaderTimeout"` // Time allowed to read the request headers (default 10s)
+	ReadTimeout       Duration `json:"readTimeout"`       // Time allowed to read a whole request, body included (default none)
+	WriteTimeout      Duration `json:"writeTimeout"`      // Time allowed to write a whole response (default none)
+	IdleTimeout       Duration `json:"idleTimeout"`       // How long an idle keep-alive connection is kept open (default 2m)
+	ShutdownTimeout   Duration `json:"shutdownTimeout"`   // Grace period given to the in-flight requests on shutdown (default 30s)
+	MaxHeaderBytes    int      `json:"maxHeaderBytes"`    // Maximum size in bytes of the request headers (default 1 MiB)
+
+	TLS  *TLS  `json:"tls"`  // TLS listener and client certificates, plain HTTP when missing
+	CORS *CORS `json:"cors"` // Cross-origin requests of the browser front ends, refused when missing
+}
+
+// Defaults of the web server. The read and write timeouts are not set by default, since they would
+// cut off the long uploads and downloads of large files.
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultShutdownTimeout   = 30 * time.Second
+)
+
+// Address returns the address the server listens on, in the host:port form.
+func (s *Server) Address() string {
+	return fmt.Sprintf("%s:%d", s.Host, s.Port)
+}
+
+// HeaderTimeout returns the time allowed to read the request headers, 10 seconds when not configured.
+func (s *Server) HeaderTimeout() time.Duration {
+	if s.ReadHeaderTimeout <= 0 {
+		return defaultReadHeaderTimeout
+	}
+	return time.Duration(s.ReadHeaderTimeout)
+}
+
+// KeepAliveTimeout returns how long an idle connection is kept open, 2 minutes when not configured.
+func (s *Server) KeepAliveTimeout() time.Duration {
+	if s.IdleTimeout <= 0 {
+		return defaultIdleTimeout
+	}
+	return time.Duration(s.IdleTimeout)
+}
+
+// GracePeriod returns how long the in-flight requests are waited for on shutdown, 30 seconds when not configured.
+func (s *Server) GracePeriod() time.Duration {
+	if s.ShutdownTimeout <= 0 {
+		return defaultShutdownTimeout
+	}
+	return time.Duration(s.ShutdownTimeout)
+}
+
+// CORS holds the configuration of the cross-origin requests, sent by the browser front ends served from
+// another origin.
+type CORS struct {
+	AllowedOrigins   []string `json:"allowedOrigins"`   // Origins allowed to call the API, e.g. "https://app.example.com"; "*" for any
+	AllowedMethods   []string `json:"allowedMethods"`   // Methods allowed (default the methods of the API)
+	AllowedHeaders   []string `json:"allowedHeaders"`   // Request headers allowed (default the ones asked by the browser)
+	ExposedHeaders   []string `json:"exposedHeaders"`   // Response headers readable by the scripts (default the ones of the API)
+	AllowCredentials bool     `json:"allowCredentials"` // Whether the browser may send its cookies and certificates
+	MaxAge           Duration `json:"maxAge"`           // How long the browser may cache a preflight response (default 10m)
+}
+
+// Defaults of the cross-origin requests.
+var (
+	defaultCORSMethods = []string{
+		http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete,
+	}
+	defaultCORSExposedHeaders = []string{
+		"Content-Disposition", "Content-Location", "ETag", "Link", "Location", "X-Request-ID",
+		"Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Tus-Checksum-Algorithm",
+		"Upload-Offset", "Upload-Length", "Upload-Metadata",
+	}
+)
+
+// defaultCORSMaxAge is how long a preflight response is cached when not configured.
+const defaultCORSMaxAge = 10 * time.Minute
+
+// Methods returns the methods allowed to the cross-origin requests, the methods of the API when not configured.
+func (c *CORS) Methods() []string {
+	if len(c.AllowedMethods) == 0 {
+		return defaultCORSMethods
+	}
+	return c.AllowedMethods
+}
+
+// Exposed returns the response headers readable by the scripts, the ones of the API when not configured.
+func (c *CORS) Exposed() []string {
+	if len(c.ExposedHeaders) == 0 {
+		return defaultCORSExposedHeaders
+	}
+	return c.ExposedHeaders
+}
+
+// PreflightMaxAge returns how long a preflight response may be cached, 10 minutes when not configured.
+func (c *CORS) PreflightMaxAge() time.Duration {
+	if c.MaxAge <= 0 {
+		return defaultCORSMaxAge
+	}
+	return time.Duration(c.MaxAge)
 }
 
 // Database holds the configuration for connecting to a database (e.g., Postgres or SQLite).
@@ -36,6 +175,8 @@ type Database struct {
 	Password string `json:"password"` // Database password
 	SSLMode  bool   `json:"ssl-mode"` // Whether SSL is enabled for the connection
 	Timezone string `json:"timezone"` // Timezone for the database connection
+
+	AutoMigrate bool `json:"autoMigrate"` // Whether the pending schema migrations are applied at startup
 }
 
 // Minio holds the configuration for connecting to a MinIO server.
@@ -49,15 +190,270 @@ type Minio struct {
 	BucketLookup int    `json:"bucketLookup"` // Bucket lookup strategy
 }
 
+// Storage holds the configuration of the backend where the file contents are stored.
+type Storage struct {
+	Type     string `json:"type"`     // Backend type: "minio", "local" or "memory"
+	Bucket   string `json:"bucket"`   // Bucket name (used in case of MinIO)
+	PartSize uint64 `json:"partSize"` // Size in bytes of the multipart upload parts (used in case of MinIO)
+	Path     string `json:"path"`     // Root directory (used in case of local filesystem)
+
+	UploadURLExpiry   Duration `json:"uploadUrlExpiry"`   // Validity of the presigned upload URLs (default 15m)
+	DownloadURLExpiry Duration `json:"downloadUrlExpiry"` // Default validity of the presigned download URLs (default 1h)
+}
+
+// Default validity of the presigned URLs.
+const (
+	defaultUploadURLExpiry   = 15 * time.Minute
+	defaultDownloadURLExpiry = time.Hour
+)
+
+// UploadURLTTL returns how long a presigned upload URL is valid, 15 minutes when not configured.
+func (s *Storage) UploadURLTTL() time.Duration {
+	if s == nil || s.UploadURLExpiry <= 0 {
+		return defaultUploadURLExpiry
+	}
+	return time.Duration(s.UploadURLExpiry)
+}
+
+// DownloadURLTTL returns how long a presigned download URL is valid by default, 1 hour when not configured.
+func (s *Storage) DownloadURLTTL() time.Duration {
+	if s == nil || s.DownloadURLExpiry <= 0 {
+		return defaultDownloadURLExpiry
+	}
+	return time.Duration(s.DownloadURLExpiry)
+}
+
+// Upload holds the configuration of the upload handling.
+type Upload struct {
+	Fingerprint string `json:"fingerprint"` // Fingerprint algorithm: "sha256" (default) or "blake3"
+	Duplicates  string `json:"duplicates"`  // Policy for byte-identical uploads: "reject" (default) or "link"
+	MaxSize     int64  `json:"maxSize"`     // Maximum size in bytes of a resumable upload, 0 for no limit
+}
+
+// Duplicate upload policies.
+const (
+	DuplicatesReject = "reject" // Reject a byte-identical upload with 409 Conflict
+	DuplicatesLink   = "link"   // Link a byte-identical upload to the already stored object
+)
+
+// FingerprintAlgorithm returns the configured fingerprint algorithm, SHA-256 when not configured.
+func (u *Upload) FingerprintAlgorithm() string {
+	if u == nil {
+		return utils.FingerprintSHA256
+	}
+	return utils.DefaultValue(u.Fingerprint, utils.FingerprintSHA256)
+}
+
+// DuplicatesPolicy returns the configured policy for byte-identical uploads, "reject" when not configured.
+func (u *Upload) DuplicatesPolicy() string {
+	if u == nil {
+		return DuplicatesReject
+	}
+	return utils.DefaultValue(u.Duplicates, DuplicatesReject)
+}
+
+// Trash holds the configuration of the trash, where deleted documents are kept until they are purged.
+type Trash struct {
+	Retention     Duration `json:"retention"`     // How long a document stays in the trash (e.g. "720h")
+	PurgeInterval Duration `json:"purgeInterval"` // How often the purger looks for expired documents (e.g. "1h")
+}
+
+// Search holds the configuration of the full-text search over the document contents.
+type Search struct {
+	Language    string `json:"language"`    // Text search configuration used by Postgres (default "simple")
+	MaxFileSize int64  `json:"maxFileSize"` // Maximum size in bytes of a content to index (default 64 MiB)
+	QueueSize   int    `json:"queueSize"`   // Number of documents waiting to be indexed (default 1024)
+}
+
+// Defaults of the full-text search.
+const (
+	defaultSearchLanguage    = "simple"
+	defaultSearchMaxFileSize = 64 << 20
+	defaultSearchQueueSize   = 1024
+)
+
+// TextSearchLanguage returns the Postgres text search configuration, "simple" when not configured.
+func (s *Search) TextSearchLanguage() string {
+	if s == nil {
+		return defaultSearchLanguage
+	}
+	return utils.DefaultValue(s.Language, defaultSearchLanguage)
+}
+
+// MaxIndexedSize returns the maximum size of a content to index, 64 MiB when not configured.
+func (s *Search) MaxIndexedSize() int64 {
+	if s == nil || s.MaxFileSize <= 0 {
+		return defaultSearchMaxFileSize
+	}
+	return s.MaxFileSize
+}
+
+// IndexQueueSize returns the number of documents that can wait to be indexed, 1024 when not configured.
+func (s *Search) IndexQueueSize() int {
+	if s == nil || s.QueueSize <= 0 {
+		return defaultSearchQueueSize
+	}
+	return s.QueueSize
+}
+
+// Auth holds the configuration of the authentication of the API clients.
+type Auth struct {
+	Mode         string `json:"mode"`         // Accepted credentials: "apikey" (default), "jwt" or "both"
+	Disabled     bool   `json:"disabled"`     // Whether the routes are open to anonymous clients (development only)
+	BootstrapKey string `json:"bootstrapKey"` // API key with the admin scope, to create the first keys (see loadBootstrapKey)
+	JWT          *JWT   `json:"jwt"`          // Validation of the bearer tokens (used in case of "jwt" or "both")
+}
+
+// Authentication modes.
+const (
+	AuthModeAPIKey = "apikey" // Clients authenticate with the API keys only
+	AuthModeJWT    = "jwt"    // Clients authenticate with the bearer tokens of the identity provider only
+	AuthModeBoth   = "both"   // Clients authenticate with either of them
+)
+
+// minBootstrapKeyLength is the minimum length of the bootstrap key, which must not be guessable.
+const minBootstrapKeyLength = 16
+
+// Environment variables providing the bootstrap key, so that the secret stays out of the configuration files
+// baked into the image.
+const (
+	BootstrapKeyVariable     = "FILESERVER_BOOTSTRAP_KEY"      // The bootstrap key itself
+	BootstrapKeyFileVariable = "FILESERVER_BOOTSTRAP_KEY_FILE" // Path of a file holding the bootstrap key (e.g. a Docker or ECS secret)
+)
+
+// Enabled reports whether the clients must authenticate, true when not configured.
+func (a *Auth) Enabled() bool {
+	return a == nil || !a.Disabled
+}
+
+// AuthMode returns the accepted credentials, "apikey" when not configured.
+func (a *Auth) AuthMode() string {
+	if a == nil {
+		return AuthModeAPIKey
+	}
+	return utils.DefaultValue(a.Mode, AuthModeAPIKey)
+}
+
+// APIKeysEnabled reports whether the clients can authenticate with an API key.
+func (a *Auth) APIKeysEnabled() bool {
+	return a.AuthMode() != AuthModeJWT
+}
+
+// JWTEnabled reports whether the clients can authenticate with a bearer token of the identity provider.
+func (a *Auth) JWTEnabled() bool {
+	return a.AuthMode() != AuthModeAPIKey
+}
+
+// JWT holds the configuration of the validation of the bearer tokens issued by an identity provider (OIDC).
+// The signing keys are read from a JWKS document, either a local file or the URL published by the provider.
+type JWT struct {
+	JWKSFile        string              `json:"jwksFile"`        // Path of a local JWKS file
+	JWKSURL         string              `json:"jwksUrl"`         // URL of the JWKS of the provider (e.g. .../protocol/openid-connect/certs)
+	Issuer          string              `json:"issuer"`          // Expected "iss" claim
+	Audience        string              `json:"audience"`        // Expected value in the "aud" claim
+	SubjectClaim    string              `json:"subjectClaim"`    // Claim holding the user identity (default "sub")
+	RolesClaim      string              `json:"rolesClaim"`      // Claim holding the roles, dotted for nested claims (default "roles")
+	GroupsClaim     string              `json:"groupsClaim"`     // Claim holding the groups matched by the ACLs (default "groups")
+	RoleScopes      map[string][]string `json:"roleScopes"`      // Scopes granted by each role; a role named as a scope grants it
+	Leeway          Duration            `json:"leeway"`          // Tolerance on the time claims (default "1m")
+	RefreshInterval Duration            `json:"refreshInterval"` // How often the JWKS is read again (default "1h")
+}
+
+// Defaults of the validation of the bearer tokens.
+const (
+	defaultSubjectClaim    = "sub"
+	defaultRolesClaim      = "roles"
+	defaultGroupsClaim     = "groups"
+	defaultJWTLeeway       = time.Minute
+	defaultRefreshInterval = time.Hour
+)
+
+// Subject returns the claim holding the user identity, "sub" when not configured.
+func (j *JWT) Subject() string {
+	return utils.DefaultValue(j.SubjectClaim, defaultSubjectClaim)
+}
+
+// Roles returns the claim holding the roles, "roles" when not configured.
+func (j *JWT) Roles() string {
+	return utils.DefaultValue(j.RolesClaim, defaultRolesClaim)
+}
+
+// Groups returns the claim holding the groups of the user, "groups" when not configured.
+func (j *JWT) Groups() string {
+	return utils.DefaultValue(j.GroupsClaim, defaultGroupsClaim)
+}
+
+// ClockSkew returns the tolerance on the time claims, 1 minute when not configured.
+func (j *JWT) ClockSkew() time.Duration {
+	if j.Leeway <= 0 {
+		return defaultJWTLeeway
+	}
+	return time.Duration(j.Leeway)
+}
+
+// KeysRefreshInterval returns how often the JWKS is read again, 1 hour when not configured.
+func (j *JWT) KeysRefreshInterval() time.Duration {
+	if j.RefreshInterval <= 0 {
+		return defaultRefreshInterval
+	}
+	return time.Duration(j.RefreshInterval)
+}
+
+// BootstrapAPIKey returns the bootstrap key, empty when not configured.
+func (a *Auth) BootstrapAPIKey() string {
+	if a == nil {
+		return ""
+	}
+	return a.BootstrapKey
+}
+
+// Duration is a time.Duration read from the configuration as a string such as "90s" or "24h".
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string with time.ParseDuration.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string: %v", err)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MaxUploadSize returns the maximum size of a resumable upload, 0 when there is no limit.
+func (u *Upload) MaxUploadSize() int64 {
+	if u == nil {
+		return 0
+	}
+	return u.MaxSize
+}
+
 // Global variables for the application configuration and clients.
 var (
-	App   Application   // Application-level configuration
-	DB    *gorm.DB      // Database client (GORM)
-	MinIO *minio.Client // MinIO client
+	App   Application     // Application-level configuration
+	DB    *gorm.DB        // Database client (GORM)
+	MinIO *minio.Client   // MinIO client
+	Store storage.Storage // Object storage backend
+
+	// ServerTLS is the configuration of the TLS listener, nil when the server speaks plain HTTP.
+	ServerTLS *tls.Config
+
+	// minioTransport is the HTTP transport of the MinIO client, kept to close its connections.
+	minioTransport *http.Transport
+
+	// DisableAutoMigrate prevents Initialize from applying the pending migrations even when the
+	// configuration asks for it, for the commands that manage the migrations themselves.
+	DisableAutoMigrate bool
 )
 
 const (
-	configDir = "config" // Directory where the configuration files are stored
+	configDir     = "config"    // Directory where the configuration files are stored
+	defaultBucket = "documents" // Default bucket name in MinIO
+	defaultRegion = "us-east-1" // Default region used to create the MinIO bucket
 )
 
 // Initialize reads the configuration file based on the profile (dev, test, prod),
@@ -80,25 +476,105 @@ func Initialize(profile string) error {
 		return fmt.Errorf("error unmarshaling JSON: %v", err)
 	}
 
+	// Write the logs as configured, before anything else is logged
+	if err := initializeLogging(App.Log); err != nil {
+		return fmt.Errorf("error initializing logging: %v", err)
+	}
+
+	// Validate the upload configuration
+	if err := validateUpload(App.Upload); err != nil {
+		return fmt.Errorf("error validating upload configuration: %v", err)
+	}
+
+	// Read the bootstrap key from the environment, then validate the authentication configuration
+	if App.Auth, err = loadBootstrapKey(App.Auth); err != nil {
+		return fmt.Errorf("error reading bootstrap key: %v", err)
+	}
+	if err := validateAuth(App.Auth); err != nil {
+		return fmt.Errorf("error validating auth configuration: %v", err)
+	}
+
+	// Load the certificates of the TLS listener, if configured
+	if App.Server != nil && App.Server.TLS != nil {
+		if err := validateTLS(App.Server.TLS); err != nil {
+			return fmt.Errorf("error validating tls configuration: %v", err)
+		}
+		if err := initializeTLS(App.Server.TLS); err != nil {
+			return fmt.Errorf("error initializing TLS: %v", err)
+		}
+		slog.Info("TLS initialized", "min_version", App.Server.TLS.MinimumVersion(), "client_cas", App.Server.TLS.ClientCAFile != "")
+	}
+
 	// Initialize MinIO if MinIO configuration is provided
 	if App.Minio != nil {
 		if err := initializeMinIO(App.Minio); err != nil {
 			return fmt.Errorf("error initializing MinIO: %v", err)
 		}
-		fmt.Println("MinIO initialized")
+		slog.Info("MinIO initialized", "url", App.Minio.Url)
 	}
 
+	// Initialize the object storage backend, falling back to MinIO when no storage section is provided
+	if err := initializeStorage(App.Storage); err != nil {
+		return fmt.Errorf("error initializing storage: %v", err)
+	}
+	slog.Info("Storage initialized", "backend", fmt.Sprintf("%T", Store))
+
 	// Initialize database if database configuration is provided
 	if App.Database != nil {
 		if err := initializeDatabase(App.Database); err != nil {
 			return fmt.Errorf("error initializing database: %v", err)
 		}
-		fmt.Println("Database initialized")
+		slog.Info("Database initialized", "driver", App.Database.Driver)
+
+		// Bring the schema up to date, if configured
+		if App.Database.AutoMigrate && !DisableAutoMigrate {
+			applied, err := migrations.Up(DB)
+			if err != nil {
+				return fmt.Errorf("error migrating database: %v", err)
+			}
+			slog.Info("Database migrated", "applied", len(applied))
+		}
 	}
 
 	return nil
 }
 
+// initializeLogging installs the default slog logger with the configured level and format. The logs of the
+// log package are written through it too.
+func initializeLogging(logConfig *Log) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logConfig.LogLevel())); err != nil {
+		return fmt.Errorf("log level %s is not supported", logConfig.LogLevel())
+	}
+	handler, err := logging.NewHandler(os.Stderr, logConfig.LogFormat(), level)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// Close releases the clients created by Initialize: it closes the connections of the database and the
+// idle connections of the MinIO client. It is called on shutdown, once the server has stopped.
+func Close() error {
+	// Close the idle connections to MinIO, the client itself holds no other resource
+	if minioTransport != nil {
+		minioTransport.CloseIdleConnections()
+	}
+
+	// Close the connection pool of the database
+	if DB != nil {
+		sqlDB, err := DB.DB()
+		if err != nil {
+			return fmt.Errorf("error getting the database connection: %v", err)
+		}
+		if err := sqlDB.Close(); err != nil {
+			return fmt.Errorf("error closing the database: %v", err)
+		}
+	}
+	return nil
+}
+
 // checkProfileAndGetFilePath returns the correct configuration file path based on the profile (dev, test, prod).
 func checkProfileAndGetFilePath(profile string) (string, error) {
 	var filename string
@@ -118,17 +594,133 @@ func checkProfileAndGetFilePath(profile string) (string, error) {
 
 // initializeMinIO initializes the MinIO client using the provided configuration.
 func initializeMinIO(minioConfig *Minio) error {
+	// Create the HTTP transport of the client, so that its connections can be closed on shutdown
+	transport, err := minio.DefaultTransport(minioConfig.Secure)
+	if err != nil {
+		return fmt.Errorf("cannot create the MinIO transport: %v", err)
+	}
+
 	// Create a MinIO client with the given credentials and options
 	client, err := minio.New(minioConfig.Url, &minio.Options{
 		Creds:        credentials.NewStaticV4(minioConfig.Username, minioConfig.Password, minioConfig.Token),
 		Secure:       minioConfig.Secure,
 		Region:       minioConfig.Region,
 		BucketLookup: getBucketLookup(minioConfig.BucketLookup),
+		Transport:    transport,
 	})
 	if err != nil {
 		return fmt.Errorf("cannot connect to MinIO %s: %v", minioConfig.Url, err)
 	}
 	MinIO = client
+	minioTransport = transport
+	return nil
+}
+
+// validateUpload checks the fingerprint algorithm and the duplicates policy of the upload configuration.
+func validateUpload(uploadConfig *Upload) error {
+	if _, err := utils.NewFingerprintHash(uploadConfig.FingerprintAlgorithm()); err != nil {
+		return err
+	}
+	switch uploadConfig.DuplicatesPolicy() {
+	case DuplicatesReject, DuplicatesLink:
+		return nil
+	default:
+		return fmt.Errorf("duplicates policy %s is not supported", uploadConfig.DuplicatesPolicy())
+	}
+}
+
+// loadBootstrapKey sets the bootstrap key from the environment: FILESERVER_BOOTSTRAP_KEY holds the key,
+// FILESERVER_BOOTSTRAP_KEY_FILE the path of a file holding it. Either of them replaces the key of the
+// configuration file; setting both is an error.
+//
+// Parameters:
+// - authConfig (*Auth): The authentication configuration read from the file, nil if it has no auth section.
+//
+// Returns:
+// - *Auth: The configuration with the bootstrap key of the environment, created if needed.
+// - error: An error is returned if both variables are set or the file cannot be read.
+func loadBootstrapKey(authConfig *Auth) (*Auth, error) {
+	key, file := os.Getenv(BootstrapKeyVariable), os.Getenv(BootstrapKeyFileVariable)
+	switch {
+	case key != "" && file != "":
+		return nil, fmt.Errorf("set either %s or %s, not both", BootstrapKeyVariable, BootstrapKeyFileVariable)
+	case file != "":
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %v", file, err)
+		}
+		// Secret files usually end with a newline
+		if key = strings.TrimSpace(string(content)); key == "" {
+			return nil, fmt.Errorf("%s is empty", file)
+		}
+	case key == "":
+		return authConfig, nil
+	}
+
+	if authConfig == nil {
+		authConfig = &Auth{}
+	}
+	authConfig.BootstrapKey = key
+	return authConfig, nil
+}
+
+// validateAuth checks the authentication mode, the bootstrap key and the validation of the bearer tokens.
+func validateAuth(authConfig *Auth) error {
+	switch authConfig.AuthMode() {
+	case AuthModeAPIKey, AuthModeJWT, AuthModeBoth:
+	default:
+		return fmt.Errorf("auth mode %s is not supported", authConfig.AuthMode())
+	}
+	if key := authConfig.BootstrapAPIKey(); key != "" && len(key) < minBootstrapKeyLength {
+		return fmt.Errorf("bootstrap key must be at least %d characters long", minBootstrapKeyLength)
+	}
+	if !authConfig.JWTEnabled() {
+		return nil
+	}
+
+	jwtConfig := authConfig.JWT
+	switch {
+	case jwtConfig == nil:
+		return fmt.Errorf("auth mode %s requires the jwt configuration", authConfig.AuthMode())
+	case (jwtConfig.JWKSFile == "") == (jwtConfig.JWKSURL == ""):
+		return fmt.Errorf("jwt requires either jwksFile or jwksUrl")
+	case jwtConfig.Issuer == "" || jwtConfig.Audience == "":
+		return fmt.Errorf("jwt requires the issuer and the audience")
+	}
+	return nil
+}
+
+// initializeStorage creates the object storage backend selected by the configuration.
+// Without a storage section the MinIO backend is used with the default bucket, as before.
+func initializeStorage(storageConfig *Storage) error {
+	if storageConfig == nil {
+		storageConfig = &Storage{Type: "minio"}
+	}
+	if storageConfig.UploadURLTTL() > storage.MaxPresignExpiry || storageConfig.DownloadURLTTL() > storage.MaxPresignExpiry {
+		return fmt.Errorf("presigned URLs cannot be valid for more than %v", storage.MaxPresignExpiry)
+	}
+
+	switch storageConfig.Type {
+	case "", "minio":
+		if MinIO == nil {
+			return fmt.Errorf("minio storage requires the minio configuration")
+		}
+		region := defaultRegion
+		if App.Minio != nil {
+			region = utils.DefaultValue(App.Minio.Region, defaultRegion)
+		}
+		Store = storage.NewMinIO(MinIO, utils.DefaultValue(storageConfig.Bucket, defaultBucket), region, storageConfig.PartSize)
+	case "local":
+		local, err := storage.NewLocal(utils.DefaultValue(storageConfig.Path, "data"))
+		if err != nil {
+			return err
+		}
+		Store = local
+	case "memory":
+		Store = storage.NewMemory()
+	default:
+		return fmt.Errorf("storage type %s is not supported", storageConfig.Type)
+	}
 	return nil
 }
 
@@ -176,17 +768,26 @@ func initializeDatabase(dbConfig *Database) error {
 		}
 
 		// Open PostgreSQL connection with GORM
-		db, err := gorm.Open(postgres.Open(url), &gorm.Config{})
+		db, err := gorm.Open(postgres.Open(url), &gorm.Config{Logger: logging.GormLogger{}})
 		if err != nil {
 			return fmt.Errorf("cannot connect to database %s@%s:%d", dbConfig.Username, dbConfig.Host, dbConfig.Port)
 		}
 		DB = db
 	case "sqlite":
 		// Open SQLite connection with GORM
-		db, err := gorm.Open(sqlite.Open(dbConfig.Url), &gorm.Config{})
+		db, err := gorm.Open(sqlite.Open(dbConfig.Url), &gorm.Config{Logger: logging.GormLogger{}})
 		if err != nil {
 			return fmt.Errorf("cannot connect to database %s", dbConfig.Url)
 		}
+
+		// The full-text search needs FTS5, which the driver compiles in only with the sqlite_fts5 build tag
+		var fts5 bool
+		if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5).Error; err != nil {
+			return fmt.Errorf("cannot check the SQLite features: %v", err)
+		}
+		if !fts5 {
+			return fmt.Errorf("SQLite is built without FTS5, build the server with -tags sqlite_fts5")
+		}
 		DB = db
 	default:
 		return fmt.Errorf("database type is not supported")
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadBootstrapKey(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "bootstrap-key")
+	if err := os.WriteFile(secret, []byte("key-from-a-secret-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(t.TempDir(), "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  *Auth
+		key     string
+		file    string
+		want    string
+		wantErr bool
+	}{
+		{name: "nothing set", config: nil, want: ""},
+		{name: "configuration file only", config: &Auth{BootstrapKey: "key-from-the-config"}, want: "key-from-the-config"},
+		{name: "variable without auth section", config: nil, key: "key-from-the-variable", want: "key-from-the-variable"},
+		{name: "variable replaces the file", config: &Auth{BootstrapKey: "key-from-the-config"}, key: "key-from-the-variable", want: "key-from-the-variable"},
+		{name: "secret file, newline trimmed", config: &Auth{Mode: AuthModeBoth}, file: secret, want: "key-from-a-secret-file"},
+		{name: "both variables", key: "key-from-the-variable", file: secret, wantErr: true},
+		{name: "missing secret file", file: filepath.Join(t.TempDir(), "missing"), wantErr: true},
+		{name: "empty secret file", file: empty, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv(BootstrapKeyVariable, test.key)
+			t.Setenv(BootstrapKeyFileVariable, test.file)
+			authConfig, err := loadBootstrapKey(test.config)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("loadBootstrapKey succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadBootstrapKey: %v", err)
+			}
+			if got := authConfig.BootstrapAPIKey(); got != test.want {
+				t.Errorf("bootstrap key = %q, want %q", got, test.want)
+			}
+			if test.config != nil && authConfig.AuthMode() != test.config.AuthMode() {
+				t.Errorf("auth mode = %s, want %s", authConfig.AuthMode(), test.config.AuthMode())
+			}
+		})
+	}
+}
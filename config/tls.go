@@ -0,0 +1,216 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fileserver/internal/utils"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLS holds the configuration of the TLS listener of the web server and of the authentication of the
+// clients with their certificates (mutual TLS).
+type TLS struct {
+	CertFile       string              `json:"certFile"`       // Path of the PEM certificate chain of the server
+	KeyFile        string              `json:"keyFile"`        // Path of the PEM private key of the server
+	MinVersion     string              `json:"minVersion"`     // Minimum TLS version: "1.2" (default) or "1.3"
+	ClientCAFile   string              `json:"clientCaFile"`   // Path of the PEM CAs verifying the client certificates, empty to ignore them
+	ClientAuth     string              `json:"clientAuth"`     // Client certificates: "optional" (default) or "require"
+	ClientSubject  string              `json:"clientSubject"`  // Identity taken from a client certificate: "cn" (default) or "dn"
+	ClientScopes   map[string][]string `json:"clientScopes"`   // Scopes granted to each client identity; "*" applies to every certificate
+	ReloadInterval Duration            `json:"reloadInterval"` // How often the files are checked for changes (default "1m")
+}
+
+// Client certificate policies.
+const (
+	ClientAuthOptional = "optional" // The clients may send a certificate, verified when sent
+	ClientAuthRequire  = "require"  // The clients must send a valid certificate
+)
+
+// Identities taken from the client certificates.
+const (
+	ClientSubjectCN = "cn" // The common name of the subject
+	ClientSubjectDN = "dn" // The whole distinguished name of the subject, e.g. "CN=indexer,OU=batch,O=Acme"
+)
+
+// Defaults of the TLS listener.
+const (
+	defaultTLSMinVersion     = "1.2"
+	defaultTLSReloadInterval = time.Minute
+)
+
+// tlsVersions maps the configured minimum versions to the TLS constants.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// MinimumVersion returns the configured minimum TLS version, "1.2" when not configured.
+func (t *TLS) MinimumVersion() string {
+	return utils.DefaultValue(t.MinVersion, defaultTLSMinVersion)
+}
+
+// ClientAuthPolicy returns whether the client certificates are optional or required, "optional" when not configured.
+func (t *TLS) ClientAuthPolicy() string {
+	return utils.DefaultValue(t.ClientAuth, ClientAuthOptional)
+}
+
+// ClientIdentity returns which part of a client certificate identifies the client, "cn" when not configured.
+func (t *TLS) ClientIdentity() string {
+	return utils.DefaultValue(t.ClientSubject, ClientSubjectCN)
+}
+
+// FilesReloadInterval returns how often the certificate files are checked for changes, 1 minute when not configured.
+func (t *TLS) FilesReloadInterval() time.Duration {
+	if t.ReloadInterval <= 0 {
+		return defaultTLSReloadInterval
+	}
+	return time.Duration(t.ReloadInterval)
+}
+
+// validateTLS checks the paths and the policies of the TLS configuration.
+func validateTLS(tlsConfig *TLS) error {
+	if tlsConfig.CertFile == "" || tlsConfig.KeyFile == "" {
+		return fmt.Errorf("tls requires the certFile and the keyFile")
+	}
+	if _, ok := tlsVersions[tlsConfig.MinimumVersion()]; !ok {
+		return fmt.Errorf("tls version %s is not supported", tlsConfig.MinimumVersion())
+	}
+	switch tlsConfig.ClientAuthPolicy() {
+	case ClientAuthOptional, ClientAuthRequire:
+	default:
+		return fmt.Errorf("client auth %s is not supported", tlsConfig.ClientAuthPolicy())
+	}
+	if tlsConfig.ClientAuth != "" && tlsConfig.ClientCAFile == "" {
+		return fmt.Errorf("client auth %s requires the clientCaFile", tlsConfig.ClientAuth)
+	}
+	switch tlsConfig.ClientIdentity() {
+	case ClientSubjectCN, ClientSubjectDN:
+	default:
+		return fmt.Errorf("client subject %s is not supported", tlsConfig.ClientIdentity())
+	}
+	return nil
+}
+
+// initializeTLS loads the certificates of the TLS configuration, so that a wrong file stops the start, and
+// creates the configuration of the listener, which reloads them when the files change.
+func initializeTLS(tlsConfig *TLS) error {
+	reloader := &certReloader{settings: tlsConfig}
+	if err := reloader.load(); err != nil {
+		return err
+	}
+	ServerTLS = &tls.Config{
+		MinVersion:         tlsVersions[tlsConfig.MinimumVersion()],
+		GetConfigForClient: reloader.configForClient,
+	}
+	return nil
+}
+
+// certReloader holds the certificates of the TLS listener, read again from the files when they change.
+// The files are checked at most once per reload interval, during a handshake.
+type certReloader struct {
+	settings *TLS
+
+	mu       sync.Mutex
+	current  *tls.Config // Configuration built from the last certificates read
+	modTimes []time.Time // Modification times of the files when they were read
+	checked  time.Time   // When the files were last checked
+}
+
+// files returns the paths of the files holding the certificates, in a stable order.
+func (c *certReloader) files() []string {
+	files := []string{c.settings.CertFile, c.settings.KeyFile}
+	if c.settings.ClientCAFile != "" {
+		files = append(files, c.settings.ClientCAFile)
+	}
+	return files
+}
+
+// configForClient returns the configuration for a new handshake, with the current certificates.
+// When the files changed and cannot be read, the previous certificates are kept.
+func (c *certReloader) configForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.checked) >= c.settings.FilesReloadInterval() {
+		c.checked = time.Now()
+		if c.changed() {
+			if err := c.loadLocked(); err != nil {
+				slog.Error("Error reloading TLS certificates, keeping the previous ones", "error", err)
+			} else {
+				slog.Info("TLS certificates reloaded", "cert_file", c.settings.CertFile)
+			}
+		}
+	}
+	return c.current, nil
+}
+
+// changed reports whether a file was modified since it was read. A file that cannot be stat'ed counts as
+// unchanged, so that a certificate being replaced is read once it is complete.
+func (c *certReloader) changed() bool {
+	for i, file := range c.files() {
+		info, err := os.Stat(file)
+		if err == nil && !info.ModTime().Equal(c.modTimes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// load reads the certificates from the files.
+func (c *certReloader) load() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checked = time.Now()
+	return c.loadLocked()
+}
+
+// loadLocked reads the certificates from the files and builds the configuration of the next handshakes.
+// The caller holds the lock.
+func (c *certReloader) loadLocked() error {
+	// Step 1: Record the modification times before reading, so that a change while reading is seen next time
+	files := c.files()
+	modTimes := make([]time.Time, len(files))
+	for i, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", file, err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+
+	// Step 2: Read the certificate of the server
+	certificate, err := tls.LoadX509KeyPair(c.settings.CertFile, c.settings.KeyFile)
+	if err != nil {
+		return fmt.Errorf("error loading the certificate %s: %v", c.settings.CertFile, err)
+	}
+	next := &tls.Config{
+		MinVersion:   tlsVersions[c.settings.MinimumVersion()],
+		Certificates: []tls.Certificate{certificate},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	// Step 3: Read the CAs verifying the client certificates, if any
+	if c.settings.ClientCAFile != "" {
+		content, err := os.ReadFile(c.settings.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("error reading the client CAs: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return fmt.Errorf("no certificate found in %s", c.settings.ClientCAFile)
+		}
+		next.ClientCAs = pool
+		next.ClientAuth = tls.VerifyClientCertIfGiven
+		if c.settings.ClientAuthPolicy() == ClientAuthRequire {
+			next.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	c.current = next
+	c.modTimes = modTimes
+	return nil
+}
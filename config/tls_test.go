@@ -0,0 +1,177 @@
+package config
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a new self-signed certificate for a common name and its key to PEM files with the
+// given modification time, and returns the DER encoding of the certificate.
+func writeCertificate(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedKey, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), modTime)
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: encodedKey}), modTime)
+	return der
+}
+
+// writeFile writes a file and sets its modification time.
+func writeFile(t *testing.T, path string, content []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// servedCertificate returns the DER encoding of the certificate a new handshake would present.
+func servedCertificate(t *testing.T, reloader *certReloader) []byte {
+	t.Helper()
+	tlsConfig, err := reloader.configForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("configForClient: %v", err)
+	}
+	return tlsConfig.Certificates[0].Certificate[0]
+}
+
+func TestCertReloaderReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	settings := &TLS{
+		CertFile:       filepath.Join(dir, "server.crt"),
+		KeyFile:        filepath.Join(dir, "server.key"),
+		ReloadInterval: Duration(time.Hour),
+	}
+	start := time.Now().Add(-time.Hour)
+	first := writeCertificate(t, settings.CertFile, settings.KeyFile, "first", start)
+	reloader := &certReloader{settings: settings}
+	if err := reloader.load(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !bytes.Equal(servedCertificate(t, reloader), first) {
+		t.Fatalf("the loaded certificate is not served")
+	}
+
+	// The files are not checked again before the reload interval
+	second := writeCertificate(t, settings.CertFile, settings.KeyFile, "second", start.Add(time.Minute))
+	if !bytes.Equal(servedCertificate(t, reloader), first) {
+		t.Errorf("the certificate was reloaded before the reload interval")
+	}
+
+	// Once the interval has passed, the renewed certificate is served
+	reloader.checked = time.Now().Add(-time.Hour)
+	if !bytes.Equal(servedCertificate(t, reloader), second) {
+		t.Errorf("the renewed certificate is not served")
+	}
+
+	// A broken file keeps the previous certificate
+	writeFile(t, settings.CertFile, []byte("not a certificate"), start.Add(2*time.Minute))
+	reloader.checked = time.Now().Add(-time.Hour)
+	if !bytes.Equal(servedCertificate(t, reloader), second) {
+		t.Errorf("a broken certificate replaced the previous one")
+	}
+
+	// Fixing the file serves the new certificate, a missing file counts as unchanged
+	third := writeCertificate(t, settings.CertFile, settings.KeyFile, "third", start.Add(3*time.Minute))
+	reloader.checked = time.Now().Add(-time.Hour)
+	if !bytes.Equal(servedCertificate(t, reloader), third) {
+		t.Errorf("the fixed certificate is not served")
+	}
+	if err := os.Remove(settings.KeyFile); err != nil {
+		t.Fatal(err)
+	}
+	reloader.checked = time.Now().Add(-time.Hour)
+	if !bytes.Equal(servedCertificate(t, reloader), third) {
+		t.Errorf("a missing key dropped the current certificate")
+	}
+}
+
+func TestCertReloaderVerifiesClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	settings := &TLS{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "clients.crt"),
+	}
+	modTime := time.Now().Add(-time.Hour)
+	writeCertificate(t, settings.CertFile, settings.KeyFile, "server", modTime)
+	writeCertificate(t, settings.ClientCAFile, filepath.Join(dir, "clients.key"), "clients", modTime)
+
+	for policy, want := range map[string]tls.ClientAuthType{
+		"":                tls.VerifyClientCertIfGiven,
+		ClientAuthRequire: tls.RequireAndVerifyClientCert,
+	} {
+		settings.ClientAuth = policy
+		reloader := &certReloader{settings: settings}
+		if err := reloader.load(); err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		if reloader.current.ClientAuth != want || reloader.current.ClientCAs == nil {
+			t.Errorf("client auth %q: %v with CAs %v, want %v", policy, reloader.current.ClientAuth, reloader.current.ClientCAs, want)
+		}
+	}
+
+	// A CA file without certificates stops the start
+	writeFile(t, settings.ClientCAFile, []byte("no certificates here"), modTime)
+	if err := initializeTLS(settings); err == nil {
+		t.Errorf("initializeTLS succeeded with a CA file without certificates")
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	valid := TLS{CertFile: "server.crt", KeyFile: "server.key"}
+	tests := []struct {
+		name    string
+		change  func(settings *TLS)
+		wantErr bool
+	}{
+		{"defaults", func(*TLS) {}, false},
+		{"missing key", func(s *TLS) { s.KeyFile = "" }, true},
+		{"TLS 1.3", func(s *TLS) { s.MinVersion = "1.3" }, false},
+		{"TLS 1.1", func(s *TLS) { s.MinVersion = "1.1" }, true},
+		{"required client certificates", func(s *TLS) { s.ClientAuth, s.ClientCAFile = ClientAuthRequire, "ca.crt" }, false},
+		{"client auth without CAs", func(s *TLS) { s.ClientAuth = ClientAuthRequire }, true},
+		{"unknown client auth", func(s *TLS) { s.ClientAuth, s.ClientCAFile = "always", "ca.crt" }, true},
+		{"distinguished name", func(s *TLS) { s.ClientSubject = ClientSubjectDN }, false},
+		{"unknown client subject", func(s *TLS) { s.ClientSubject = "email" }, true},
+	}
+	for _, test := range tests {
+		settings := valid
+		test.change(&settings)
+		if err := validateTLS(&settings); (err != nil) != test.wantErr {
+			t.Errorf("%s: validateTLS = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fileserver/internal/models"
+	"fileserver/internal/service"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// aclRequest is the body of a request replacing an ACL, such as
+// {"owner": "alice", "entries": [{"type": "group", "principal": "finance", "permissions": ["read"]}]}.
+type aclRequest struct {
+	Owner   *string            `json:"owner"`   // New owner, empty to open the content to everyone; missing to keep it
+	Entries []service.ACLGrant `json:"entries"` // New entries, replacing the current ones
+}
+
+// GetFileACL returns the owner of a document, its ACL entries and the ones inherited from its folders.
+func GetFileACL(w http.ResponseWriter, r *http.Request) {
+	document, ok := documentFromPath(w, r)
+	if !ok || !authorizeDocument(w, r, document, models.ScopeRead) {
+		return
+	}
+
+	acl, err := service.GetDocumentACL(document)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving ACL: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, acl)
+}
+
+// SetFileACL replaces the ACL entries of a document and optionally changes its owner, then returns the ACL.
+// Only the owner of the document and the administrators can change it.
+func SetFileACL(w http.ResponseWriter, r *http.Request) {
+	document, ok := documentFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// Step 1: Read the ACL from the body
+	request, ok := readACLRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// Step 2: Save the ACL
+	err := service.SetDocumentACL(service.PrincipalFrom(r.Context()), document, request.Owner, request.Entries)
+	if err != nil {
+		writeACLError(w, err)
+		return
+	}
+
+	// Step 3: Return the new ACL
+	acl, err := service.GetDocumentACL(document)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving ACL: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, acl)
+}
+
+// GetFolderACL returns the owner of a folder, its ACL entries and the ones inherited from the folders above.
+func GetFolderACL(w http.ResponseWriter, r *http.Request) {
+	folder, ok := folderFromPath(w, r)
+	if !ok || !authorizeFolder(w, r, &folder.ID, models.ScopeRead) {
+		return
+	}
+
+	acl, err := service.GetFolderACL(folder)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving ACL: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, acl)
+}
+
+// SetFolderACL replaces the ACL entries of a folder, inherited by all its content, and optionally changes
+// its owner, then returns the ACL. Only the owner of the folder and the administrators can change it.
+func SetFolderACL(w http.ResponseWriter, r *http.Request) {
+	folder, ok := folderFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// Step 1: Read the ACL from the body
+	request, ok := readACLRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// Step 2: Save the ACL
+	err := service.SetFolderACL(service.PrincipalFrom(r.Context()), folder, request.Owner, request.Entries)
+	if err != nil {
+		writeACLError(w, err)
+		return
+	}
+
+	// Step 3: Return the new ACL
+	acl, err := service.GetFolderACL(folder)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving ACL: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, acl)
+}
+
+// readACLRequest decodes the body of a request replacing an ACL.
+// On failure the error response is written and false is returned.
+func readACLRequest(w http.ResponseWriter, r *http.Request) (*aclRequest, bool) {
+	var request aclRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		http.Error(w, "Error parsing the request: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return &request, true
+}
+
+// documentFromPath retrieves the document identified by the "idFile" path value.
+// On failure the error response is written and false is returned.
+func documentFromPath(w http.ResponseWriter, r *http.Request) (*models.Document, bool) {
+	idFile, err := uuid.Parse(r.PathValue("idFile"))
+	if err != nil {
+		http.Error(w, "Error parsing the idFile: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	document, err := service.GetDocument(idFile)
+	if err != nil {
+		http.Error(w, "Document not found: "+err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return document, true
+}
+
+// authorizeDocument checks that the caller of a request has a permission on a document.
+// On failure the error response is written and false is returned.
+func authorizeDocument(w http.ResponseWriter, r *http.Request, document *models.Document, permission string) bool {
+	err := service.CheckDocumentAccess(service.PrincipalFrom(r.Context()), document, permission)
+	if err != nil {
+		writeACLError(w, err)
+		return false
+	}
+	return true
+}
+
+// authorizeFolder checks that the caller of a request has a permission on a folder, nil for the root.
+// On failure the error response is written and false is returned.
+func authorizeFolder(w http.ResponseWriter, r *http.Request, folderID *uint, permission string) bool {
+	err := service.CheckFolderAccess(service.PrincipalFrom(r.Context()), folderID, permission)
+	if err != nil {
+		writeACLError(w, err)
+		return false
+	}
+	return true
+}
+
+// writeACLError maps the errors of the access control functions to status codes.
+func writeACLError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrAccessDenied):
+		status = http.StatusForbidden
+	case errors.Is(err, service.ErrInvalidACL):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrFolderNotFound):
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
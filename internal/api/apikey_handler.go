@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fileserver/internal/models"
+	"fileserver/internal/service"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiKeyRequest is the body of a request creating an API key.
+type apiKeyRequest struct {
+	Name      string     `json:"name"`      // Name describing who or what uses the key
+	Scopes    []string   `json:"scopes"`    // Scopes granted to the key
+	ExpiresAt *time.Time `json:"expiresAt"` // When the key expires, missing if it never expires
+}
+
+// apiKeyView is an API key as returned to the administrators, without its hash.
+type apiKeyView struct {
+	ID         uint          `json:"id"`                   // Identifier of the key
+	Name       string        `json:"name"`                 // Name describing who or what uses the key
+	Subject    string        `json:"subject"`              // Identity of the callers using the key, for the owners and the ACLs
+	Prefix     string        `json:"prefix"`               // First characters of the key
+	Scopes     models.Scopes `json:"scopes"`               // Scopes granted to the key
+	CreatedAt  time.Time     `json:"createdAt"`            // When the key was created
+	ExpiresAt  *time.Time    `json:"expiresAt,omitempty"`  // When the key expires
+	LastUsedAt *time.Time    `json:"lastUsedAt,omitempty"` // When the key was last used
+	RevokedAt  *time.Time    `json:"revokedAt,omitempty"`  // When the key was revoked
+	Key        string        `json:"key,omitempty"`        // The key itself, returned only on creation
+}
+
+// newAPIKeyView converts a stored API key to its JSON view.
+func newAPIKeyView(apiKey *models.APIKey) apiKeyView {
+	return apiKeyView{
+		ID:         apiKey.ID,
+		Name:       apiKey.Name,
+		Subject:    service.APIKeySubject(apiKey.ID),
+		Prefix:     apiKey.Prefix,
+		Scopes:     apiKey.Scopes,
+		CreatedAt:  apiKey.CreatedAt,
+		ExpiresAt:  apiKey.ExpiresAt,
+		LastUsedAt: apiKey.LastUsedAt,
+		RevokedAt:  apiKey.RevokedAt,
+	}
+}
+
+// CreateAPIKey creates an API key from a JSON body such as {"name": "backup", "scopes": ["read"]}.
+// The key is returned in the response only: it cannot be retrieved later.
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	// Step 1: Read the key from the body
+	var request apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Error parsing the request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		http.Error(w, "Missing key name", http.StatusBadRequest)
+		return
+	}
+	scopes, err := service.NormalizeScopes(request.Scopes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		http.Error(w, "Invalid expiresAt, it must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	// Step 2: Generate the key
+	apiKey, key, err := service.CreateAPIKey(name, scopes, request.ExpiresAt)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error creating API key: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Step 3: Return the key, for the only time
+	view := newAPIKeyView(apiKey)
+	view.Key = key
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/admin/keys/%d", apiKey.ID))
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(view); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// GetAPIKeys retrieves the list of the API keys, the revoked ones included.
+func GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	// Step 1: Retrieve the keys
+	keys, err := service.GetAPIKeys()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving API keys: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Step 2: Convert the keys to JSON format, without their hashes
+	views := make([]apiKeyView, len(keys))
+	for i := range keys {
+		views[i] = newAPIKeyView(&keys[i])
+	}
+	writeJSON(w, views)
+}
+
+// RevokeAPIKey revokes an API key, which is refused from then on.
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	// Extract the key id from the path value
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 0)
+	if err != nil {
+		http.Error(w, "Invalid key id: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Revoke the key
+	apiKey, err := service.RevokeAPIKey(uint(id))
+	if errors.Is(err, service.ErrAPIKeyNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Error revoking API key: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "API key %s (%s) revoked", apiKey.Name, apiKey.Prefix)
+}
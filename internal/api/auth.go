@@ -0,0 +1,136 @@
+package api
+
+import (
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/logging"
+	"fileserver/internal/models"
+	"fileserver/internal/service"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// apiKeyHeader is the header carrying the API key, as an alternative to "Authorization: Bearer <key>".
+const apiKeyHeader = "X-API-Key"
+
+// Authenticate wraps a handler so that it is only called by clients holding an API key or a bearer token
+// with the scope of the route, as allowed by the auth mode. The caller is stored in the context of the
+// request, see service.PrincipalFrom, and added to its logs with the document or the upload it targets.
+// Routes without scope are public, and so are all the routes when the authentication is disabled.
+//
+// Parameters:
+// - scope (string): The scope required to call the handler, empty for a public route.
+// - handler (http.HandlerFunc): The handler to protect.
+//
+// Returns:
+// - http.HandlerFunc: The protected handler.
+func Authenticate(scope string, handler http.HandlerFunc) http.HandlerFunc {
+	if scope == "" {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		logTarget(r)
+		if !config.App.Auth.Enabled() {
+			handler(w, r)
+			return
+		}
+
+		// Step 1: Find the caller from the credentials of the request
+		principal, err := authenticateRequest(r)
+		if errors.Is(err, errMissingCredentials) || errors.Is(err, service.ErrInvalidAPIKey) ||
+			errors.Is(err, service.ErrInvalidToken) || errors.Is(err, service.ErrInvalidCertificate) {
+			unauthorized(w, "Authentication failed: "+err.Error())
+			return
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("Error authenticating request: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Step 2: Check the scope of the route
+		if !principal.Scopes.Allows(scope) {
+			http.Error(w, fmt.Sprintf("The credentials do not grant the %s scope", scope), http.StatusForbidden)
+			return
+		}
+		logging.AddAttrs(r.Context(), slog.String("user", principal.Subject))
+		handler(w, r.WithContext(service.WithPrincipal(r.Context(), principal)))
+	}
+}
+
+// logTarget adds the document or the upload named by the path of a request to the attributes of its logs.
+func logTarget(r *http.Request) {
+	if idFile := r.PathValue("idFile"); idFile != "" {
+		logging.AddAttrs(r.Context(), slog.String("document_id", idFile))
+	}
+	if idUpload := r.PathValue("idUpload"); idUpload != "" {
+		logging.AddAttrs(r.Context(), slog.String("upload_id", idUpload))
+	}
+}
+
+// errMissingCredentials is returned when a request carries neither an API key, a bearer token nor a client certificate.
+var errMissingCredentials = errors.New("missing credentials")
+
+// authenticateRequest finds the caller of a request. An API key is read from the X-API-Key header; a bearer
+// token is checked as an API key when it looks like one, as a token of the identity provider otherwise.
+// Without any of them, the client certificate verified by the TLS handshake identifies the caller.
+func authenticateRequest(r *http.Request) (*service.Principal, error) {
+	auth := config.App.Auth
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		if !auth.APIKeysEnabled() {
+			return nil, fmt.Errorf("%w: API keys are not accepted", service.ErrInvalidAPIKey)
+		}
+		return service.AuthenticateAPIKey(key)
+	}
+
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	token = strings.TrimSpace(token)
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			return service.AuthenticateCertificate(r.TLS.VerifiedChains[0][0])
+		}
+		return nil, errMissingCredentials
+	}
+	if auth.APIKeysEnabled() && (!auth.JWTEnabled() || service.IsAPIKey(token)) {
+		return service.AuthenticateAPIKey(token)
+	}
+	return service.AuthenticateToken(token)
+}
+
+// unauthorized answers 401 Unauthorized, telling the client how to authenticate.
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="fileserver"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
+
+// principalView is the authenticated caller as returned by GET /me.
+type principalView struct {
+	Subject string        `json:"subject"`          // Identity of the caller
+	Roles   []string      `json:"roles,omitempty"`  // Roles of the caller in the identity provider
+	Groups  []string      `json:"groups,omitempty"` // Groups of the caller in the identity provider
+	Scopes  models.Scopes `json:"scopes"`           // Scopes granted to the caller
+}
+
+// GetCurrentPrincipal returns the identity, the roles, the groups and the scopes of the caller, to check what the
+// credentials map to.
+func GetCurrentPrincipal(w http.ResponseWriter, r *http.Request) {
+	principal := service.PrincipalFrom(r.Context())
+	if principal == nil {
+		http.Error(w, "Authentication is disabled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, principalView{
+		Subject: principal.Subject,
+		Roles:   principal.Roles,
+		Groups:  principal.Groups,
+		Scopes:  principal.Scopes,
+	})
+}
+
+// callerSubject returns the identity of the caller of a request, empty when it is anonymous.
+func callerSubject(r *http.Request) string {
+	if principal := service.PrincipalFrom(r.Context()); principal != nil {
+		return principal.Subject
+	}
+	return ""
+}
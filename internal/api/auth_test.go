@@ -0,0 +1,249 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"fileserver/internal/service"
+	"github.com/golang-jwt/jwt/v5"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Settings of the identity provider of the tests.
+const (
+	testIssuer    = "https://sso.example.com"
+	testAudience  = "fileserver"
+	testKeyID     = "test-key"
+	testBootstrap = "bootstrap-key-0123456789"
+)
+
+// Signing key of the identity provider of the tests and path of its JWKS. The service reads the JWKS once
+// per process, so all the tests share them.
+var (
+	signingKey *ecdsa.PrivateKey
+	jwksFile   string
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "fileserver-api")
+	if err != nil {
+		log.Fatal(err)
+	}
+	code := func() int {
+		defer os.RemoveAll(dir)
+		if signingKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			log.Fatal(err)
+		}
+		jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{{
+			"kty": "EC",
+			"crv": "P-256",
+			"kid": testKeyID,
+			"use": "sig",
+			"alg": "ES256",
+			"x":   base64.RawURLEncoding.EncodeToString(signingKey.PublicKey.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(signingKey.PublicKey.Y.FillBytes(make([]byte, 32))),
+		}}})
+		if err != nil {
+			log.Fatal(err)
+		}
+		jwksFile = filepath.Join(dir, "jwks.json")
+		if err := os.WriteFile(jwksFile, jwks, 0o600); err != nil {
+			log.Fatal(err)
+		}
+		return m.Run()
+	}()
+	os.Exit(code)
+}
+
+// useAuth replaces the authentication configuration, and the one of the client certificates, for the
+// duration of a test: API keys with the bootstrap key, the tokens of the test identity provider (whose
+// "editor" role grants the write scope) and the certificates named "backup" (granted the read scope).
+func useAuth(t *testing.T, mode string) {
+	t.Helper()
+	previousAuth, previousServer := config.App.Auth, config.App.Server
+	config.App.Auth = &config.Auth{
+		Mode:         mode,
+		BootstrapKey: testBootstrap,
+		JWT: &config.JWT{
+			JWKSFile:   jwksFile,
+			Issuer:     testIssuer,
+			Audience:   testAudience,
+			RoleScopes: map[string][]string{"editor": {models.ScopeWrite}},
+		},
+	}
+	config.App.Server = &config.Server{TLS: &config.TLS{ClientScopes: map[string][]string{"backup": {models.ScopeRead}}}}
+	t.Cleanup(func() { config.App.Auth, config.App.Server = previousAuth, previousServer })
+}
+
+// signToken returns a token of the test identity provider for a subject with the given roles.
+func signToken(t *testing.T, subject string, roles ...string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"sub":   subject,
+		"roles": roles,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = testKeyID
+	signed, err := token.SignedString(signingKey)
+	if err != nil {
+		t.Fatalf("error signing token: %v", err)
+	}
+	return signed
+}
+
+// withCertificate adds to a request a client certificate verified by the TLS handshake.
+func withCertificate(r *http.Request, commonName string) {
+	certificate := &x509.Certificate{Subject: pkix.Name{CommonName: commonName, OrganizationalUnit: []string{"ops"}}}
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate}}}
+}
+
+// callAs calls a handler protected by Authenticate and returns the status and the subject of the caller
+// the handler was given ("anonymous" without caller, empty when the handler was not called).
+func callAs(scope string, prepare func(r *http.Request)) (int, string) {
+	subject := ""
+	handler := Authenticate(scope, func(w http.ResponseWriter, r *http.Request) {
+		subject = "anonymous"
+		if principal := service.PrincipalFrom(r.Context()); principal != nil {
+			subject = principal.Subject
+		}
+	})
+	r := httptest.NewRequest(http.MethodGet, "/files", nil)
+	prepare(r)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w.Code, subject
+}
+
+func TestAuthenticateOrder(t *testing.T) {
+	useAuth(t, config.AuthModeBoth)
+	token := signToken(t, "alice", "editor", models.ScopeRead)
+	tests := []struct {
+		name        string
+		apiKey      string
+		bearer      string
+		certificate string
+		status      int
+		subject     string
+	}{
+		{"API key first", testBootstrap, token, "backup", http.StatusOK, "apikey:bootstrap"},
+		{"invalid API key, no fallback", "not-a-key", token, "backup", http.StatusUnauthorized, ""},
+		{"bearer token before the certificate", "", token, "backup", http.StatusOK, "alice"},
+		{"invalid bearer token, no fallback", "", "not-a-token", "backup", http.StatusUnauthorized, ""},
+		{"bearer API key", "", testBootstrap, "", http.StatusOK, "apikey:bootstrap"},
+		{"client certificate last", "", "", "backup", http.StatusOK, "backup"},
+		{"no credentials", "", "", "", http.StatusUnauthorized, ""},
+	}
+	for _, test := range tests {
+		status, subject := callAs(models.ScopeRead, func(r *http.Request) {
+			if test.apiKey != "" {
+				r.Header.Set(apiKeyHeader, test.apiKey)
+			}
+			if test.bearer != "" {
+				r.Header.Set("Authorization", "Bearer "+test.bearer)
+			}
+			if test.certificate != "" {
+				withCertificate(r, test.certificate)
+			}
+		})
+		if status != test.status || subject != test.subject {
+			t.Errorf("%s: status %d, caller %q; want %d, %q", test.name, status, subject, test.status, test.subject)
+		}
+	}
+}
+
+func TestAuthenticateModes(t *testing.T) {
+	token := signToken(t, "alice", models.ScopeRead)
+	tests := []struct {
+		mode   string
+		apiKey string
+		bearer string
+		status int
+	}{
+		{config.AuthModeAPIKey, testBootstrap, "", http.StatusOK},
+		{config.AuthModeAPIKey, "", token, http.StatusUnauthorized}, // The token is checked as an API key
+		{config.AuthModeJWT, "", token, http.StatusOK},
+		{config.AuthModeJWT, testBootstrap, "", http.StatusUnauthorized},
+		{config.AuthModeJWT, "", testBootstrap, http.StatusUnauthorized}, // The key is checked as a token
+	}
+	for _, test := range tests {
+		useAuth(t, test.mode)
+		status, _ := callAs(models.ScopeRead, func(r *http.Request) {
+			if test.apiKey != "" {
+				r.Header.Set(apiKeyHeader, test.apiKey)
+			}
+			if test.bearer != "" {
+				r.Header.Set("Authorization", "Bearer "+test.bearer)
+			}
+		})
+		if status != test.status {
+			t.Errorf("mode %s, API key %q, bearer %.10q: status %d, want %d", test.mode, test.apiKey, test.bearer, status, test.status)
+		}
+	}
+}
+
+func TestAuthenticateScopes(t *testing.T) {
+	useAuth(t, config.AuthModeBoth)
+	credentials := map[string]func(r *http.Request){
+		"admin": func(r *http.Request) { r.Header.Set(apiKeyHeader, testBootstrap) },
+		"editor": func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+signToken(t, "alice", "editor"))
+		},
+		"reader": func(r *http.Request) { withCertificate(r, "backup") },
+		"nobody": func(r *http.Request) { withCertificate(r, "unknown") },
+	}
+	allowed := map[string][]string{
+		"admin":  {models.ScopeRead, models.ScopeWrite, models.ScopeDelete, models.ScopeAdmin},
+		"editor": {models.ScopeWrite},
+		"reader": {models.ScopeRead},
+	}
+	for caller, prepare := range credentials {
+		for _, scope := range []string{models.ScopeRead, models.ScopeWrite, models.ScopeDelete, models.ScopeAdmin} {
+			want := http.StatusForbidden
+			for _, granted := range allowed[caller] {
+				if granted == scope {
+					want = http.StatusOK
+				}
+			}
+			if status, _ := callAs(scope, prepare); status != want {
+				t.Errorf("%s on a %s route: status %d, want %d", caller, scope, status, want)
+			}
+		}
+	}
+}
+
+func TestAuthenticatePublicAndDisabled(t *testing.T) {
+	useAuth(t, config.AuthModeBoth)
+	if status, subject := callAs("", func(*http.Request) {}); status != http.StatusOK || subject != "anonymous" {
+		t.Errorf("public route: status %d, caller %q", status, subject)
+	}
+
+	// Without credentials the client is told how to authenticate
+	handler := Authenticate(models.ScopeRead, func(http.ResponseWriter, *http.Request) {})
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/files", nil))
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("missing credentials: status %d, WWW-Authenticate %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+
+	// With the authentication disabled every route is open, even with invalid credentials
+	config.App.Auth.Disabled = true
+	status, subject := callAs(models.ScopeAdmin, func(r *http.Request) { r.Header.Set(apiKeyHeader, "invalid") })
+	if status != http.StatusOK || subject != "anonymous" {
+		t.Errorf("authentication disabled: status %d, caller %q", status, subject)
+	}
+}
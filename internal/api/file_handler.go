@@ -1,61 +1,75 @@
 package api
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fileserver/config"
+	"fileserver/internal/logging"
+	"fileserver/internal/metrics"
 	"fileserver/internal/models"
 	"fileserver/internal/service"
+	"fileserver/internal/storage"
+	"fileserver/internal/utils"
 	"fmt"
 	"github.com/google/uuid"
 	"io"
+	"log/slog"
+	"mime"
 	"mime/multipart"
 	"net/http"
-	"os"
-	"time"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
-// Constants for default bucket name and folder path for uploaded files
-const (
-	defaultBucketName   = "documents"              // Default bucket name in MinIO
-	localFolderTemplate = "%s/fileserver/uploads/" // Template for creating local upload directories
-)
-
-// GetFiles retrieves the list of indexed documents from the database with fuzzy search on file names
+// GetFiles retrieves a page of the indexed documents from the database with fuzzy search on file names.
+// The "tag" query parameter, repeated, restricts the list to the documents with all the tags, or with
+// any of them when "tagMode" is "or". The other filters, the sort and the pagination are described by
+// parseFileQuery. The response is a JSON envelope with the documents, the total count and the cursors of
+// the adjacent pages, which are also returned as Link headers.
 func GetFiles(w http.ResponseWriter, r *http.Request) {
-	// Step 1: Retrieve the search query from the URL parameters
-	searchQuery := r.URL.Query().Get("searchQuery")
-	if searchQuery == "" {
-		// If there is no search query, retrieve all documents
-		searchQuery = "%"
-	} else {
-		// Add wildcards for partial search
-		searchQuery = "%" + searchQuery + "%"
+	// Step 1: Read the filters, the sort and the page from the URL parameters
+	query, err := parseFileQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	query.Caller = service.PrincipalFrom(r.Context())
 
-	// Step 2: Retrieve documents whose name matches the fuzzy search
-	documents, err := service.GetFiles(searchQuery)
+	// Step 2: Retrieve the page of documents, only the ones the caller can read
+	page, err := service.GetFiles(query)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		// Handle error if the query fails
 		http.Error(w, fmt.Sprintf("Error retrieving documents: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Step 3: Convert the documents to JSON format
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-
-	// Use json.NewEncoder to write the response directly in JSON format
-	if err := json.NewEncoder(w).Encode(documents); err != nil {
-		http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
-		return
+	// Step 3: Convert the page to the JSON envelope, with the links to the adjacent pages
+	response := filesPage{Items: page.Documents, Total: page.Total}
+	if page.Next != nil {
+		response.NextCursor = page.Next.String()
+		w.Header().Add("Link", pageLink(r, response.NextCursor, "next"))
 	}
+	if page.Prev != nil {
+		response.PrevCursor = page.Prev.String()
+		w.Header().Add("Link", pageLink(r, response.PrevCursor, "prev"))
+	}
+	writeJSON(w, response)
 }
 
-// GetFile handles the request to fetch a file from MinIO and serve it to the user.
+// GetFile handles the request to fetch a file from the storage and stream it to the user.
+// The current version is served unless an older one is requested with the "version" query parameter.
+// Range, If-Range, If-None-Match and If-Modified-Since are supported through http.ServeContent,
+// using the ETag and the last modification time of the stored object.
 func GetFile(w http.ResponseWriter, r *http.Request) {
-	// Ensure that the request method is GET
-	if r.Method != http.MethodGet {
+	// Ensure that the request method is GET (or HEAD, to inspect the headers only)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -73,63 +87,100 @@ func GetFile(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Error retrieving document: %v", err), http.StatusNotFound)
 		return
 	}
-
-	// Fetch the file object from MinIO storage
-	object, err := service.GetFileFromMinIO(defaultBucketName, objectName)
-	if err != nil {
+	if !authorizeDocument(w, r, document, models.ScopeRead) {
 		return
 	}
-	defer object.Close() // Ensure that the file object is closed after use
 
-	// Create the upload directory if it doesn't exist
-	uploadDir := fmt.Sprintf(localFolderTemplate, os.TempDir())
-	err = os.MkdirAll(uploadDir, os.ModePerm)
-	if err != nil {
-		http.Error(w, "Error creating the uploads folder", http.StatusInternalServerError)
-		return
+	serveDocument(w, r, document)
+}
+
+// serveDocument streams the content of a document to the user, with the headers of a download.
+// The current version is served unless an older one is requested with the "version" query parameter.
+func serveDocument(w http.ResponseWriter, r *http.Request, document *models.Document) {
+	// Serve the current version, or the one requested with the "version" query parameter
+	key, contentType := document.Key(), document.ContentType()
+	if value := r.URL.Query().Get("version"); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Error parsing the version: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		version, err := service.GetVersion(r.Context(), document, number)
+		if errors.Is(err, service.ErrVersionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error retrieving the version: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		key = version.ObjectKey
+		contentType = utils.DefaultValue(version.MimeType, "application/octet-stream")
 	}
+	serveObject(w, r, document, key, contentType)
+}
 
-	// Create a new file locally with a unique name (using a timestamp)
-	newFileName := fmt.Sprintf("%d_%s", time.Now().Unix(), objectName)
-	file, err := os.Create(uploadDir + newFileName)
-	if err != nil {
-		http.Error(w, "Error saving the file: "+err.Error(), http.StatusInternalServerError)
+// serveObject streams a stored object to the user, with the headers of a download of the document.
+func serveObject(w http.ResponseWriter, r *http.Request, document *models.Document, key, contentType string) {
+	object, info, ok := openObject(w, r, key)
+	if !ok {
 		return
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			http.Error(w, "Error closing file: "+err.Error(), http.StatusInternalServerError)
-		}
-	}(file)
+	defer object.Close() // Ensure that the file object is closed after use
+	sendObject(w, r, document, object, info, contentType)
+}
 
-	// Copy the file content from MinIO to the local file
-	_, err = io.Copy(file, object)
+// openObject opens a stored object and reads its information (size, ETag, last modification),
+// nothing is downloaded yet. On failure the error response is written and false is returned.
+func openObject(w http.ResponseWriter, r *http.Request, key string) (storage.Object, storage.ObjectInfo, bool) {
+	// Open the file object on the storage backend
+	object, err := service.GetFileFromStorage(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Error retrieving the file: "+err.Error(), http.StatusNotFound)
+		return nil, storage.ObjectInfo{}, false
+	}
 	if err != nil {
-		fmt.Println("Error saving object to file:", err)
-		return
+		http.Error(w, "Error retrieving the file: "+err.Error(), http.StatusInternalServerError)
+		return nil, storage.ObjectInfo{}, false
 	}
 
-	// Get the file's information (size, name, etc.)
-	fileInfo, err := file.Stat()
+	// Get the object's information
+	info, err := object.Stat()
 	if err != nil {
-		http.Error(w, "Could not get file information", http.StatusInternalServerError)
-		return
+		object.Close()
+		http.Error(w, "Could not get file information: "+err.Error(), http.StatusInternalServerError)
+		return nil, storage.ObjectInfo{}, false
 	}
+	return object, info, true
+}
 
-	// Set headers for file download (name, content type, and length)
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; objectName=%s", fileInfo.Name()))
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
+// sendObject streams an object opened by openObject, with the headers of a download of the document.
+func sendObject(w http.ResponseWriter, r *http.Request, document *models.Document, object storage.Object, info storage.ObjectInfo, contentType string) {
+	// Set headers for file download (name, content type and validator), the length is set by ServeContent
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": document.Name}))
+	w.Header().Set("Content-Type", contentType)
+	if info.ETag != "" {
+		w.Header().Set("ETag", strconv.Quote(info.ETag))
+	}
 
-	// Log the successful file retrieval
-	fmt.Printf("Sending file: %s (Size: %d bytes)\n", fileInfo.Name(), fileInfo.Size())
+	// Log the file retrieval
+	slog.InfoContext(r.Context(), "Sending file", "name", document.Name, "size", info.Size, "range", r.Header.Get("Range"))
 
-	// Serve the file content as a download
-	http.ServeContent(w, r, fileInfo.Name(), fileInfo.ModTime(), file)
+	// Stream the file content, honouring the conditional and range headers
+	http.ServeContent(w, r, document.Name, info.LastModified, metrics.CountDownload(object))
 }
 
-// LoadFile handles file uploads from a client and stores them locally and on MinIO.
+// LoadFile handles file uploads from a client and streams them straight to the storage backend.
+// The multipart body is read part by part, so the file is never buffered in memory or on the local disk;
+// its fingerprint and size are computed while it is copied to the storage.
+//
+// The document is placed in the folder of the "folderId" form field, or at the root, and is owned by the
+// authenticated caller, who must be allowed to write in the folder. The "uploader" (by
+// default the authenticated caller) and "description" form fields, the JSON object of the "metadata" form field and the
+// "meta.<key>" form fields are stored with the document, together with its size and MIME type.
+//
+// A byte-identical upload is either rejected with 409 Conflict or linked to the already stored object,
+// depending on the "duplicates" query parameter ("reject" or "link") or, when missing, on the configuration.
 func LoadFile(w http.ResponseWriter, r *http.Request) {
 	// Ensure that the request method is POST and that it is a multipart form
 	if r.Method != http.MethodPost {
@@ -137,120 +188,238 @@ func LoadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse the multipart form data with a maximum file size of 10MB
-	err := r.ParseMultipartForm(10 << 20) // 10 MB
-	if err != nil {
-		http.Error(w, "Error parsing the request", http.StatusBadRequest)
+	// Resolve the policy for duplicated content before reading the body
+	duplicates := utils.DefaultValue(r.URL.Query().Get("duplicates"), config.App.Upload.DuplicatesPolicy())
+	if duplicates != config.DuplicatesReject && duplicates != config.DuplicatesLink {
+		http.Error(w, "Invalid duplicates policy: "+duplicates, http.StatusBadRequest)
 		return
 	}
 
-	// Retrieve the uploaded file from the form
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, "Error retrieving the file: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer func(file multipart.File) {
-		err := file.Close()
+	// Stream the file part of the multipart body to the storage. When the folderId field comes before the
+	// file, the folder is checked first, so that a denied upload is not streamed at all.
+	upload, ok := receiveFile(w, r, func(fields map[string]string) bool {
+		value, found := fields["folderId"]
+		if !found {
+			return true
+		}
+		folderID, err := parseFolderID(value)
 		if err != nil {
-			http.Error(w, "Error closing the input file: "+err.Error(), http.StatusInternalServerError)
+			writeFolderError(w, err)
+			return false
 		}
-	}(file)
-
-	// Create the upload directory if it doesn't exist
-	uploadDir := fmt.Sprintf(localFolderTemplate, os.TempDir())
-	err = os.MkdirAll(uploadDir, os.ModePerm)
-	if err != nil {
-		http.Error(w, "Error creating the uploads folder", http.StatusInternalServerError)
+		return authorizeFolder(w, r, folderID, models.ScopeWrite)
+	})
+	if !ok {
 		return
 	}
 
-	// Use a unique file name based on timestamp and the original file name
-	newFileName := fmt.Sprintf("%d_%s", time.Now().Unix(), header.Filename)
-	filePath := uploadDir + newFileName
-	out, err := os.Create(filePath)
+	// Read the custom metadata sent with the file
+	metadata, err := upload.metadata()
 	if err != nil {
-		http.Error(w, "Error saving the file: "+err.Error(), http.StatusInternalServerError)
+		_ = service.DeleteFileFromStorage(r.Context(), upload.key)
+		http.Error(w, "Error parsing the metadata: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer func(out *os.File) {
-		err := out.Close()
-		if err != nil {
-			http.Error(w, "Error closing the output file: "+err.Error(), http.StatusInternalServerError)
-		}
-		if err := cleanup(out); err != nil {
-			http.Error(w, "Error remove the output file: "+err.Error(), http.StatusInternalServerError)
-		}
-	}(out)
 
-	// Copy the file content from the request to the local file
-	_, err = io.Copy(out, file)
+	// Check the folder where the file is placed, the caller must be allowed to write in it; the folderId field
+	// may also come after the file, which is then deleted if the folder is denied
+	folderID, err := parseFolderID(upload.fields["folderId"])
 	if err != nil {
-		http.Error(w, "Error copying the file", http.StatusInternalServerError)
+		_ = service.DeleteFileFromStorage(r.Context(), upload.key)
+		writeFolderError(w, err)
 		return
 	}
-
-	// Calculate fingerprint of file
-	//fingerprint, err := utils.CalculateFingerprint(filePath)
-	//if err != nil {
-	//	http.Error(w, "Error during calculate fingerprint: "+err.Error(), http.StatusInternalServerError)
-	//	return
-	//}
-	fingerprint := uuid.New().String()
-
-	// Check if document already uploaded
-	_, err = service.GetDocumentByFingerprint(fingerprint)
-	if err == nil {
-		http.Error(w, "Document already exists.", http.StatusConflict)
+	if !authorizeFolder(w, r, folderID, models.ScopeWrite) {
+		_ = service.DeleteFileFromStorage(r.Context(), upload.key)
 		return
 	}
 
-	// Upload the file to MinIO with a unique ID (UUID)
-	idFile := uuid.New()
-	err = service.UploadFileToMinIO(context.Background(), defaultBucketName, idFile.String(), filePath)
-	if err != nil {
-		http.Error(w, "Error during upload file to MinIO: "+err.Error(), http.StatusInternalServerError)
+	// Save document to database as a reference to the blob of its content
+	document, linked, err := service.CreateDocument(r.Context(), service.StagedFile{
+		Name:        upload.name,
+		Key:         upload.key,
+		Fingerprint: upload.fingerprint,
+		Size:        upload.size,
+		MimeType:    upload.mimeType,
+		Uploader:    utils.DefaultValue(upload.fields["uploader"], callerSubject(r)),
+		Owner:       callerSubject(r),
+		Description: upload.fields["description"],
+		Metadata:    metadata,
+		FolderID:    folderID,
+	}, duplicates)
+	if errors.Is(err, service.ErrDuplicateDocument) {
+		http.Error(w, err.Error(), http.StatusConflict)
 		return
 	}
-
-	// Save document to database
-	newDocument := &models.Document{
-		Name:        header.Filename,
-		IdFile:      idFile,
-		Fingerprint: fingerprint,
-	}
-	if err := service.AddDocument(newDocument); err != nil {
+	if err != nil {
 		http.Error(w, "Error adding document: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	logging.AddAttrs(r.Context(), slog.String("document_id", document.IdFile.String()))
+
 	// Respond to the client with a success message
-	_, err = fmt.Fprintf(w, "File %s uploaded successfully!\n", newFileName)
+	if linked {
+		_, err = fmt.Fprintf(w, "File %s linked to existing content as %v! (%d bytes)\n", upload.name, document.IdFile, upload.size)
+	} else {
+		_, err = fmt.Fprintf(w, "File %s uploaded successfully as %v! (%d bytes)\n", upload.name, document.IdFile, upload.size)
+	}
 	if err != nil {
 		return
 	}
 }
 
-// cleanup removes a file from the local file system after use.
-func cleanup(file *os.File) error {
-	if _, err := os.Stat(file.Name()); err == nil {
-		err := os.Remove(file.Name())
+// maxFieldSize is the maximum size of a form field sent together with an uploaded file.
+const maxFieldSize = 64 << 10 // 64 KiB
+
+// metadataFieldPrefix is the prefix of the form fields holding a single custom metadata value.
+const metadataFieldPrefix = "meta."
+
+// uploadedFile describes a file streamed to the storage by LoadFile.
+type uploadedFile struct {
+	key         string            // Staging key of the stored file
+	name        string            // Original name of the file
+	fingerprint string            // Fingerprint of the content
+	size        int64             // Size of the content in bytes
+	mimeType    string            // MIME type detected from the content and the name
+	fields      map[string]string // Other form fields of the request
+}
+
+// metadata returns the custom metadata sent with the file: the JSON object of the "metadata" form field,
+// merged with the "meta.<key>" form fields.
+func (u *uploadedFile) metadata() (models.Metadata, error) {
+	metadata := make(models.Metadata)
+	if value := u.fields["metadata"]; value != "" {
+		if err := json.Unmarshal([]byte(value), &metadata); err != nil {
+			return nil, fmt.Errorf("metadata must be a JSON object: %v", err)
+		}
+	}
+	for name, value := range u.fields {
+		if key, ok := strings.CutPrefix(name, metadataFieldPrefix); ok && key != "" {
+			metadata[key] = value
+		}
+	}
+	return metadata, nil
+}
+
+// receiveFile streams the "file" part of a multipart request to a new staging key of the storage and collects
+// the other form fields. The parts are read one by one, so the file is never buffered in memory or on the
+// local disk. When check is not nil, it is called with the fields received before the file part, which is
+// stored only if check returns true; check writes the error response otherwise.
+// On failure the error response is written, the file already stored is deleted and false is returned.
+func receiveFile(w http.ResponseWriter, r *http.Request, check func(fields map[string]string) bool) (*uploadedFile, bool) {
+	defer metrics.StartUpload()()
+
+	// Drop the stored file when the rest of the request is rejected, even if the client went away
+	var upload *uploadedFile
+	accepted := false
+	defer func() {
+		if !accepted && upload != nil {
+			_ = service.DeleteFileFromStorage(context.WithoutCancel(r.Context()), upload.key)
+		}
+	}()
+
+	// Open the multipart stream without parsing the whole form
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Error parsing the request: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	// Walk through all the parts, the file is uploaded as soon as it is found
+	fields := make(map[string]string)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			return fmt.Errorf("Error removing file: %v", err)
-		} else {
-			fmt.Println("File removed successfully:", file.Name())
+			http.Error(w, "Error reading the request: "+err.Error(), http.StatusBadRequest)
+			return nil, false
 		}
-	} else if os.IsNotExist(err) {
-		return fmt.Errorf("File does not exist: %v", file.Name())
-	} else {
-		fmt.Println("Error checking file:", err)
+
+		if part.FileName() == "" {
+			// Keep the other form fields, they describe the file and may come before or after it
+			value, err := io.ReadAll(io.LimitReader(part, maxFieldSize+1))
+			_ = part.Close()
+			if err != nil {
+				http.Error(w, "Error reading the request: "+err.Error(), http.StatusBadRequest)
+				return nil, false
+			}
+			if len(value) > maxFieldSize {
+				http.Error(w, fmt.Sprintf("Form field %s exceeds %d bytes", part.FormName(), maxFieldSize), http.StatusBadRequest)
+				return nil, false
+			}
+			fields[part.FormName()] = string(value)
+			continue
+		}
+		if part.FormName() != "file" {
+			// Skip the files that are not the uploaded one
+			_ = part.Close()
+			continue
+		}
+		if upload != nil {
+			_ = part.Close()
+			http.Error(w, "Only one file can be uploaded per request", http.StatusBadRequest)
+			return nil, false
+		}
+
+		// Check the fields received so far, then stream the file part to the storage
+		if check != nil && !check(fields) {
+			_ = part.Close()
+			return nil, false
+		}
+		upload, err = streamToStorage(r.Context(), part)
+		_ = part.Close()
+		if err != nil {
+			http.Error(w, "Error during upload file to storage: "+err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+	}
+	if upload == nil {
+		http.Error(w, "Error retrieving the file: no file part in the request", http.StatusBadRequest)
+		return nil, false
+	}
+	upload.fields = fields
+	accepted = true
+	return upload, true
+}
+
+// streamToStorage copies a multipart file part to a new staging key of the storage,
+// detecting the MIME type and calculating the fingerprint and the size of the content on the fly.
+func streamToStorage(ctx context.Context, part *multipart.Part) (*uploadedFile, error) {
+	key := service.StagingKey(uuid.New())
+	name := filepath.Base(part.FileName())
+
+	// Peek at the head of the content to detect its MIME type, without consuming it
+	buffered := bufio.NewReaderSize(metrics.CountUpload(part), utils.SniffLength)
+	head, err := buffered.Peek(utils.SniffLength)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	mimeType := utils.DetectMimeType(head, name)
+
+	content, err := utils.NewFingerprintReader(buffered, config.App.Upload.FingerprintAlgorithm())
+	if err != nil {
+		return nil, err
+	}
+	if err := service.UploadFileToStorage(ctx, key, content, -1); err != nil {
+		return nil, err
 	}
-	return nil
+	return &uploadedFile{
+		key:         key,
+		name:        name,
+		fingerprint: content.Fingerprint(),
+		size:        content.Size(),
+		mimeType:    mimeType,
+	}, nil
 }
 
-// DeleteFile deletes a file from the database and MinIO
+// DeleteFile moves a document to the trash, from where it can be restored until the purger removes it.
+// With the "purge=true" query parameter the document (trashed or not) is removed permanently, together
+// with its content in the storage when no other document references it.
 func DeleteFile(w http.ResponseWriter, r *http.Request) {
-	// Ensure that the request method is GET
+	// Ensure that the request method is DELETE
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -263,20 +432,136 @@ func DeleteFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Step 1: Get document from PostgreSQL database
+	// Check whether the document has to be removed permanently
+	purge := false
+	if value := r.URL.Query().Get("purge"); value != "" {
+		if purge, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "Error parsing the purge parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if purge {
+		// Step 1: Make sure that the document exists, in the trash or not, and that the caller can delete it
+		document, err := service.GetDocumentIncludingDeleted(idFile)
+		if err != nil {
+			http.Error(w, "Document not found: "+err.Error(), http.StatusNotFound)
+			return
+		}
+		if !authorizeDocument(w, r, document, models.ScopeDelete) {
+			return
+		}
+
+		// Step 2: Delete the document and release its content
+		if err := service.PurgeDocument(r.Context(), idFile); err != nil {
+			http.Error(w, fmt.Sprintf("Error purging document: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Return success response
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "File with ID %v purged successfully", idFile)
+		return
+	}
+
+	// Step 1: Get document from database, the caller must be allowed to delete it
 	document, err := service.GetDocument(idFile)
 	if err != nil {
 		http.Error(w, "Document not found: "+err.Error(), http.StatusNotFound)
 		return
 	}
+	if !authorizeDocument(w, r, document, models.ScopeDelete) {
+		return
+	}
 
-	// Step 2: Delete from PostgreSQL
-	if err := config.DB.Delete(&document).Error; err != nil {
+	// Step 2: Move the document to the trash (logical deletion)
+	if err := service.DeleteDocument(idFile); err != nil {
 		http.Error(w, fmt.Sprintf("Error deleting document from DB: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	// Return success response
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "File with ID %v deleted successfully", idFile)
+	fmt.Fprintf(w, "File with ID %v moved to trash", idFile)
+}
+
+// documentPatch is the body of a request editing a document; missing fields are left untouched.
+type documentPatch struct {
+	Name        *string          `json:"name"`        // New name of the document
+	Description *string          `json:"description"` // New description of the document
+	Metadata    *models.Metadata `json:"metadata"`    // New custom key/values, replacing the current ones
+	FolderID    json.RawMessage  `json:"folderId"`    // New folder of the document, null for the root
+}
+
+// UpdateFile edits the editable fields of a document (name, description and custom metadata), moves it to
+// another folder with "folderId" (null for the root) and returns it.
+// The content and the fields recorded at upload time (size, MIME type, extension, uploader) are not editable.
+func UpdateFile(w http.ResponseWriter, r *http.Request) {
+	// Extract the document id from the path value
+	idFile, err := uuid.Parse(r.PathValue("idFile"))
+	if err != nil {
+		http.Error(w, "Error parsing the idFile: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Step 1: Read the changes from the body
+	var patch documentPatch
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patch); err != nil {
+		http.Error(w, "Error parsing the request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if patch.Name != nil {
+		name := filepath.Base(*patch.Name)
+		if *patch.Name == "" || name == "." || name == "/" {
+			http.Error(w, "Invalid document name", http.StatusBadRequest)
+			return
+		}
+		patch.Name = &name
+	}
+
+	move, folderID, err := parseFolderRef(patch.FolderID)
+	if err != nil {
+		http.Error(w, "Invalid folderId: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Step 2: Get document from database, the caller must be allowed to change it and to write in the new folder
+	document, err := service.GetDocument(idFile)
+	if err != nil {
+		http.Error(w, "Document not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if !authorizeDocument(w, r, document, models.ScopeWrite) {
+		return
+	}
+	if move && !authorizeFolder(w, r, folderID, models.ScopeWrite) {
+		return
+	}
+
+	// Step 3: Save the changes
+	err = service.UpdateDocument(document, service.DocumentChanges{
+		Name:        patch.Name,
+		Description: patch.Description,
+		Metadata:    patch.Metadata,
+		Move:        move,
+		FolderID:    folderID,
+	})
+	if errors.Is(err, service.ErrFolderNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error updating document: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Step 4: Return the updated document
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(document); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+		return
+	}
 }
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"fileserver/internal/models"
+	"fileserver/internal/service"
+	"fileserver/internal/utils"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Number of documents in a page of GET /files, by default and at most.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+// filesPage is the JSON envelope of a page of documents.
+type filesPage struct {
+	Items      []models.Document `json:"items"`                // The documents of the page
+	Total      int64             `json:"total"`                // Number of documents matching the filters, in all the pages
+	NextCursor string            `json:"nextCursor,omitempty"` // Cursor of the next page, missing on the last page
+	PrevCursor string            `json:"prevCursor,omitempty"` // Cursor of the previous page, missing on the first page
+}
+
+// parseFileQuery reads the parameters of GET /files:
+//   - searchQuery: part of the file name, case-insensitive
+//   - tag (repeated) and tagMode ("and", the default, or "or"): the tags of the documents
+//   - mimeType: a MIME type such as "application/pdf", or a family such as "image/*"
+//   - uploader: who uploaded the documents
+//   - createdFrom, createdTo, updatedFrom, updatedTo: date ranges, as RFC 3339 times or dates (YYYY-MM-DD);
+//     the "from" bounds are inclusive, the "to" bounds exclusive for times and inclusive for dates
+//   - minSize, maxSize: size range in bytes, inclusive
+//   - sort ("name", the default, "createdAt", "updatedAt" or "size") and order ("asc", the default, or "desc")
+//   - limit: number of documents in the page, 50 by default and 1000 at most
+//   - cursor: the nextCursor or prevCursor of a previous page, with the same sort and order
+func parseFileQuery(values url.Values) (service.FileQuery, error) {
+	query := service.FileQuery{
+		Sort:        utils.DefaultValue(values.Get("sort"), "name"),
+		SearchQuery: values.Get("searchQuery"),
+		Uploader:    values.Get("uploader"),
+		MimeType:    values.Get("mimeType"),
+		Limit:       defaultPageSize,
+	}
+
+	// Retrieve the tags to filter on and whether all of them ("and", the default) or any ("or") must match
+	tags, err := parseTags(values["tag"])
+	if err != nil {
+		return query, fmt.Errorf("Invalid tag: %v", err)
+	}
+	tagMode := utils.DefaultValue(values.Get("tagMode"), "and")
+	if tagMode != "and" && tagMode != "or" {
+		return query, fmt.Errorf("Invalid tagMode, it must be \"and\" or \"or\"")
+	}
+	query.Tags, query.MatchAll = tags, tagMode == "and"
+
+	// Retrieve the ranges
+	for _, param := range []struct {
+		name  string
+		upper bool
+		value **time.Time
+	}{
+		{"createdFrom", false, &query.CreatedFrom},
+		{"createdTo", true, &query.CreatedTo},
+		{"updatedFrom", false, &query.UpdatedFrom},
+		{"updatedTo", true, &query.UpdatedTo},
+	} {
+		if *param.value, err = parseTimeBound(values.Get(param.name), param.upper); err != nil {
+			return query, fmt.Errorf("Invalid %s, it must be an RFC 3339 time or a YYYY-MM-DD date", param.name)
+		}
+	}
+	if query.MinSize, err = parseSize(values.Get("minSize")); err != nil {
+		return query, fmt.Errorf("Invalid minSize, it must be a number of bytes")
+	}
+	if query.MaxSize, err = parseSize(values.Get("maxSize")); err != nil {
+		return query, fmt.Errorf("Invalid maxSize, it must be a number of bytes")
+	}
+
+	// Retrieve the sort and the page
+	switch query.Sort {
+	case "name", "createdAt", "updatedAt", "size":
+	default:
+		return query, fmt.Errorf("Invalid sort, it must be \"name\", \"createdAt\", \"updatedAt\" or \"size\"")
+	}
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return query, fmt.Errorf("Invalid order, it must be \"asc\" or \"desc\"")
+	}
+	if value := values.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit <= 0 || query.Limit > maxPageSize {
+			return query, fmt.Errorf("Invalid limit, it must be a number between 1 and %d", maxPageSize)
+		}
+	}
+	if value := values.Get("cursor"); value != "" {
+		if query.Cursor, err = service.ParseCursor(value); err != nil {
+			return query, err
+		}
+	}
+	return query, nil
+}
+
+// parseTimeBound reads a bound of a date range, nil when the value is empty. A date without time as upper
+// bound means the end of that day, so that the day is included.
+func parseTimeBound(value string, upper bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if bound, err := time.Parse(time.RFC3339, value); err == nil {
+		return &bound, nil
+	}
+	bound, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, err
+	}
+	if upper {
+		bound = bound.AddDate(0, 0, 1)
+	}
+	return &bound, nil
+}
+
+// parseSize reads a bound of a size range, nil when the value is empty.
+func parseSize(value string) (*int64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("invalid size %q", value)
+	}
+	return &size, nil
+}
+
+// pageLink formats a Link header value pointing to the page of a cursor, with the same parameters as the
+// current request.
+func pageLink(r *http.Request, cursor, rel string) string {
+	values := r.URL.Query()
+	values.Set("cursor", cursor)
+	link := url.URL{Path: r.URL.Path, RawQuery: values.Encode()}
+	return fmt.Sprintf("<%s>; rel=%q", link.String(), rel)
+}
@@ -0,0 +1,254 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fileserver/internal/models"
+	"fileserver/internal/service"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// rootFolder is the identifier accepted in place of a folder id to address the root.
+const rootFolder = "root"
+
+// folderRequest is the body of the requests creating or updating a folder.
+type folderRequest struct {
+	Name     *string         `json:"name"`     // Name of the folder
+	ParentID json.RawMessage `json:"parentId"` // Parent folder id, null for the root
+}
+
+// folderChildren is the content of a folder returned when browsing.
+type folderChildren struct {
+	Folder    *models.Folder    `json:"folder"`    // The folder, null for the root
+	Folders   []models.Folder   `json:"folders"`   // Its subfolders
+	Documents []models.Document `json:"documents"` // Its documents
+}
+
+// CreateFolder creates a folder from a JSON body such as {"name": "acme", "parentId": 3}.
+// Without parentId the folder is created at the root. The folder is owned by the authenticated caller, who
+// must be allowed to write in the parent folder.
+func CreateFolder(w http.ResponseWriter, r *http.Request) {
+	// Step 1: Read the folder from the body
+	var request folderRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Error parsing the request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Name == nil {
+		http.Error(w, "Missing folder name", http.StatusBadRequest)
+		return
+	}
+	_, parentID, err := parseFolderRef(request.ParentID)
+	if err != nil {
+		http.Error(w, "Invalid parentId: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Step 2: Create the folder
+	if !authorizeFolder(w, r, parentID, models.ScopeWrite) {
+		return
+	}
+	folder, err := service.CreateFolder(*request.Name, parentID, callerSubject(r))
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	// Step 3: Return the new folder
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/folders/%d", folder.ID))
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(folder); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// GetFolder retrieves a folder.
+func GetFolder(w http.ResponseWriter, r *http.Request) {
+	folder, ok := folderFromPath(w, r)
+	if !ok || !authorizeFolder(w, r, &folder.ID, models.ScopeRead) {
+		return
+	}
+	writeJSON(w, folder)
+}
+
+// UpdateFolder renames and/or moves a folder, from a JSON body such as {"name": "acme", "parentId": null}.
+// Missing fields are left untouched; a null parentId moves the folder to the root.
+func UpdateFolder(w http.ResponseWriter, r *http.Request) {
+	folder, ok := folderFromPath(w, r)
+	if !ok || !authorizeFolder(w, r, &folder.ID, models.ScopeWrite) {
+		return
+	}
+
+	// Step 1: Read the changes from the body
+	var request folderRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Error parsing the request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	move, parentID, err := parseFolderRef(request.ParentID)
+	if err != nil {
+		http.Error(w, "Invalid parentId: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if move && !authorizeFolder(w, r, parentID, models.ScopeWrite) {
+		return
+	}
+
+	// Step 2: Save the changes
+	if err := service.UpdateFolder(folder, service.FolderChanges{Name: request.Name, Move: move, ParentID: parentID}); err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	// Step 3: Return the updated folder
+	writeJSON(w, folder)
+}
+
+// DeleteFolder deletes an empty folder. With the "recursive=true" query parameter a folder that is not empty
+// is deleted together with its subfolders, and all its documents are moved to the trash.
+func DeleteFolder(w http.ResponseWriter, r *http.Request) {
+	folder, ok := folderFromPath(w, r)
+	if !ok || !authorizeFolder(w, r, &folder.ID, models.ScopeDelete) {
+		return
+	}
+
+	// Check whether the content has to be deleted too
+	recursive := false
+	if value := r.URL.Query().Get("recursive"); value != "" {
+		var err error
+		if recursive, err = strconv.ParseBool(value); err != nil {
+			http.Error(w, "Error parsing the recursive parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Delete the folder
+	trashed, err := service.DeleteFolder(folder, recursive)
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Folder %s deleted, %d files moved to trash", folder.Name, trashed)
+}
+
+// GetFolderChildren lists the subfolders and the documents of a folder that the caller can read. The id
+// "root" lists the root.
+func GetFolderChildren(w http.ResponseWriter, r *http.Request) {
+	var folder *models.Folder
+	if r.PathValue("id") != rootFolder {
+		var ok bool
+		if folder, ok = folderFromPath(w, r); !ok {
+			return
+		}
+	}
+	writeChildren(w, r, folder)
+}
+
+// GetPath navigates the folders like a file manager: GET /path/projects/acme lists the content of the folder
+// "acme" inside "projects", while GET /path/projects/acme/spec.pdf downloads the document "spec.pdf" in it.
+// GET /path/ lists the root.
+func GetPath(w http.ResponseWriter, r *http.Request) {
+	folder, document, err := service.ResolvePath(r.PathValue("path"))
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+	if document != nil {
+		if authorizeDocument(w, r, document, models.ScopeRead) {
+			serveDocument(w, r, document)
+		}
+		return
+	}
+	writeChildren(w, r, folder)
+}
+
+// writeChildren lists the content of a folder, or of the root when folder is nil, that the caller of the
+// request can read.
+func writeChildren(w http.ResponseWriter, r *http.Request, folder *models.Folder) {
+	var parentID *uint
+	if folder != nil {
+		parentID = &folder.ID
+	}
+	if !authorizeFolder(w, r, parentID, models.ScopeRead) {
+		return
+	}
+	folders, documents, err := service.GetChildren(parentID, service.PrincipalFrom(r.Context()))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving folder content: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, folderChildren{Folder: folder, Folders: folders, Documents: documents})
+}
+
+// folderFromPath retrieves the folder identified by the "id" path value.
+// On failure the error response is written and false is returned.
+func folderFromPath(w http.ResponseWriter, r *http.Request) (*models.Folder, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 0)
+	if err != nil {
+		http.Error(w, "Error parsing the folder id: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	folder, err := service.GetFolder(uint(id))
+	if err != nil {
+		writeFolderError(w, err)
+		return nil, false
+	}
+	return folder, true
+}
+
+// parseFolderRef reads an optional reference to a folder from a JSON body: a missing value means no change,
+// null (or "root") the root, and a number the folder with that id.
+func parseFolderRef(raw json.RawMessage) (bool, *uint, error) {
+	if len(raw) == 0 {
+		return false, nil, nil
+	}
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return false, nil, err
+	}
+	switch value {
+	case nil, rootFolder:
+		return true, nil, nil
+	}
+	var id uint
+	if err := json.Unmarshal(raw, &id); err != nil {
+		return false, nil, fmt.Errorf("folder id must be a number, null or %q", rootFolder)
+	}
+	return true, &id, nil
+}
+
+// parseFolderID reads the id of an existing folder from a form field, nil when the field is empty.
+func parseFolderID(value string) (*uint, error) {
+	if value == "" || value == rootFolder {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", service.ErrFolderNotFound, value)
+	}
+	folder, err := service.GetFolder(uint(id))
+	if err != nil {
+		return nil, err
+	}
+	return &folder.ID, nil
+}
+
+// writeFolderError maps the errors of the folder functions to status codes.
+func writeFolderError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrFolderNotFound), errors.Is(err, service.ErrPathNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrFolderExists), errors.Is(err, service.ErrFolderNotEmpty):
+		status = http.StatusConflict
+	case errors.Is(err, service.ErrFolderCycle), errors.Is(err, service.ErrInvalidFolderName):
+		status = http.StatusBadRequest
+	}
+	http.Error(w, err.Error(), status)
+}
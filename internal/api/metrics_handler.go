@@ -0,0 +1,15 @@
+package api
+
+import (
+	"fileserver/internal/metrics"
+	"net/http"
+)
+
+// metricsHandler serves the metrics in the Prometheus text format.
+var metricsHandler = metrics.Handler()
+
+// GetMetrics exposes the metrics of the server in the Prometheus text format, to be scraped by Prometheus
+// with an API key having the read scope.
+func GetMetrics(w http.ResponseWriter, r *http.Request) {
+	metricsHandler.ServeHTTP(w, r)
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"fileserver/internal/service"
+	"fileserver/internal/storage"
+	"fileserver/internal/utils"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// presignUploadRequest is the body of a presigned upload request.
+type presignUploadRequest struct {
+	Name        string          `json:"name"`        // Name of the document
+	Uploader    string          `json:"uploader"`    // Who uploads the document
+	Description string          `json:"description"` // Free text description of the document
+	Metadata    models.Metadata `json:"metadata"`    // Custom key/values attached to the document
+	FolderID    json.RawMessage `json:"folderId"`    // Folder of the document, the root when missing or null
+}
+
+// presignedURL is the response of the presigned URL endpoints.
+type presignedURL struct {
+	IdFile    uuid.UUID `json:"idFile"`    // Identifier of the document
+	Method    string    `json:"method"`    // HTTP method to use with the URL
+	URL       string    `json:"url"`       // Presigned URL of the content in the storage
+	ExpiresAt time.Time `json:"expiresAt"` // Time after which the URL is not valid anymore
+}
+
+// PresignUpload creates a pending document and returns a presigned PUT URL, so that the client can upload
+// the content directly to the storage. The document is placed in the folder of "folderId", or at the root,
+// where the caller must be allowed to write, and becomes available once the upload is confirmed with
+// POST /file/{idFile}/confirm.
+func PresignUpload(w http.ResponseWriter, r *http.Request) {
+	// Step 1: Read the name and the descriptive fields of the document from the body
+	var request presignUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Error parsing the request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := filepath.Base(request.Name)
+	if request.Name == "" || name == "." || name == "/" {
+		http.Error(w, "Missing document name", http.StatusBadRequest)
+		return
+	}
+	_, folderID, err := parseFolderRef(request.FolderID)
+	if err != nil {
+		http.Error(w, "Invalid folderId: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if folderID != nil {
+		if _, err := service.GetFolder(*folderID); err != nil {
+			writeFolderError(w, err)
+			return
+		}
+	}
+	if !authorizeFolder(w, r, folderID, models.ScopeWrite) {
+		return
+	}
+
+	// Step 2: Reserve the document and sign the upload URL
+	expiry := config.App.Storage.UploadURLTTL()
+	document, presigned, err := service.PresignUpload(r.Context(), service.StagedFile{
+		Name:        name,
+		Uploader:    utils.DefaultValue(request.Uploader, callerSubject(r)),
+		Owner:       callerSubject(r),
+		Description: request.Description,
+		Metadata:    request.Metadata,
+		FolderID:    folderID,
+	}, expiry)
+	if err != nil {
+		writePresignError(w, err)
+		return
+	}
+
+	// Step 3: Return the URL to the client
+	writePresignedURL(w, http.StatusCreated, presignedURL{
+		IdFile:    document.IdFile,
+		Method:    http.MethodPut,
+		URL:       presigned.String(),
+		ExpiresAt: time.Now().Add(expiry),
+	})
+}
+
+// ConfirmUpload makes a document uploaded through a presigned URL available. Byte-identical content is
+// rejected with 409 Conflict or linked to the stored content, depending on the "duplicates" query parameter
+// ("reject" or "link") or, when missing, on the configuration.
+func ConfirmUpload(w http.ResponseWriter, r *http.Request) {
+	// Extract the document id from the path value
+	idFile, err := uuid.Parse(r.PathValue("idFile"))
+	if err != nil {
+		http.Error(w, "Error parsing the idFile: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Resolve the policy for duplicated content
+	duplicates := utils.DefaultValue(r.URL.Query().Get("duplicates"), config.App.Upload.DuplicatesPolicy())
+	if duplicates != config.DuplicatesReject && duplicates != config.DuplicatesLink {
+		http.Error(w, "Invalid duplicates policy: "+duplicates, http.StatusBadRequest)
+		return
+	}
+
+	// Step 1: Get the pending document
+	document, err := service.GetPendingDocument(idFile)
+	if err != nil {
+		http.Error(w, "Document not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if !authorizeDocument(w, r, document, models.ScopeWrite) {
+		return
+	}
+
+	// Step 2: Check the uploaded content and make the document available
+	linked, err := service.ConfirmDocument(r.Context(), document, duplicates)
+	if err != nil {
+		writePresignError(w, err)
+		return
+	}
+
+	// Respond to the client with a success message
+	if linked {
+		fmt.Fprintf(w, "File %s linked to existing content as %v!\n", document.Name, document.IdFile)
+	} else {
+		fmt.Fprintf(w, "File %s uploaded successfully as %v!\n", document.Name, document.IdFile)
+	}
+}
+
+// GetFileLink returns a presigned GET URL to download a document directly from the storage. The URL is valid
+// for the time given by the "expires" query parameter (e.g. "10m"), or by the configuration when missing.
+func GetFileLink(w http.ResponseWriter, r *http.Request) {
+	// Extract the document id from the path value
+	idFile, err := uuid.Parse(r.PathValue("idFile"))
+	if err != nil {
+		http.Error(w, "Error parsing the idFile: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Read the validity of the URL
+	expiry := config.App.Storage.DownloadURLTTL()
+	if value := r.URL.Query().Get("expires"); value != "" {
+		if expiry, err = time.ParseDuration(value); err != nil || expiry <= 0 || expiry > storage.MaxPresignExpiry {
+			http.Error(w, fmt.Sprintf("Invalid expires parameter, it must be a duration up to %v", storage.MaxPresignExpiry), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Step 1: Get document from database
+	document, err := service.GetDocument(idFile)
+	if err != nil {
+		http.Error(w, "Document not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if !authorizeDocument(w, r, document, models.ScopeRead) {
+		return
+	}
+
+	// Step 2: Sign the download URL
+	presigned, err := service.PresignDownload(r.Context(), document, expiry)
+	if err != nil {
+		writePresignError(w, err)
+		return
+	}
+
+	// Step 3: Return the URL to the client
+	writePresignedURL(w, http.StatusOK, presignedURL{
+		IdFile:    document.IdFile,
+		Method:    http.MethodGet,
+		URL:       presigned.String(),
+		ExpiresAt: time.Now().Add(expiry),
+	})
+}
+
+// writePresignedURL encodes a presigned URL as the JSON response.
+func writePresignedURL(w http.ResponseWriter, status int, response presignedURL) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// writePresignError maps the errors of the presigned URL functions to status codes.
+func writePresignError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrPresignNotSupported):
+		status = http.StatusNotImplemented
+	case errors.Is(err, service.ErrContentNotUploaded), errors.Is(err, service.ErrDuplicateDocument):
+		status = http.StatusConflict
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -1,11 +1,89 @@
 package api
 
-import "net/http"
-
-var Routes = map[string]func(w http.ResponseWriter, r *http.Request){
-	"GET /":                 Hello,
-	"GET /files":            GetFiles,
-	"GET /file/{idFile}":    GetFile,
-	"POST /file":            LoadFile,
-	"DELETE /file/{idFile}": DeleteFile,
+import (
+	"fileserver/internal/middleware"
+	"fileserver/internal/models"
+	"net/http"
+)
+
+// Route is a handler together with the scope an API key needs to call it.
+type Route struct {
+	Handler http.HandlerFunc // Handler of the requests
+	Scope   string           // Scope required to call the route, empty for the public routes
+}
+
+var Routes = map[string]Route{
+	"GET /":                 {Hello, ""},
+	"GET /files":            {GetFiles, models.ScopeRead},
+	"GET /file/{idFile}":    {GetFile, models.ScopeRead},
+	"POST /file":            {LoadFile, models.ScopeWrite},
+	"DELETE /file/{idFile}": {DeleteFile, models.ScopeDelete},
+	"PATCH /file/{idFile}":  {UpdateFile, models.ScopeWrite},
+
+	"GET /trash":                  {GetTrash, models.ScopeRead},
+	"POST /file/{idFile}/restore": {RestoreFile, models.ScopeWrite},
+
+	"POST /file/presign-upload":   {PresignUpload, models.ScopeWrite},
+	"POST /file/{idFile}/confirm": {ConfirmUpload, models.ScopeWrite},
+	"GET /file/{idFile}/link":     {GetFileLink, models.ScopeRead},
+
+	"PUT /file/{idFile}":                       {UploadVersion, models.ScopeWrite},
+	"GET /file/{idFile}/versions":              {GetVersions, models.ScopeRead},
+	"POST /file/{idFile}/versions/{n}/restore": {RestoreVersion, models.ScopeWrite},
+
+	"GET /file/{idFile}/acl": {GetFileACL, models.ScopeRead},
+	"PUT /file/{idFile}/acl": {SetFileACL, models.ScopeWrite},
+
+	"POST /file/{idFile}/shares":              {CreateShare, models.ScopeWrite},
+	"GET /file/{idFile}/shares":               {GetShares, models.ScopeRead},
+	"DELETE /file/{idFile}/shares/{id}":       {RevokeShare, models.ScopeWrite},
+	"GET /file/{idFile}/shares/{id}/accesses": {GetShareAccesses, models.ScopeRead},
+	"GET /s/{token}":                          {GetSharedFile, ""},
+
+	"GET /tags":                        {GetTags, models.ScopeRead},
+	"POST /file/{idFile}/tags":         {AddFileTags, models.ScopeWrite},
+	"DELETE /file/{idFile}/tags/{tag}": {RemoveFileTag, models.ScopeWrite},
+
+	"POST /folders":              {CreateFolder, models.ScopeWrite},
+	"GET /folders/{id}":          {GetFolder, models.ScopeRead},
+	"PATCH /folders/{id}":        {UpdateFolder, models.ScopeWrite},
+	"DELETE /folders/{id}":       {DeleteFolder, models.ScopeDelete},
+	"GET /folders/{id}/children": {GetFolderChildren, models.ScopeRead},
+	"GET /folders/{id}/acl":      {GetFolderACL, models.ScopeRead},
+	"PUT /folders/{id}/acl":      {SetFolderACL, models.ScopeWrite},
+	"GET /path/{path...}":        {GetPath, models.ScopeRead},
+
+	"GET /search": {SearchFiles, models.ScopeRead},
+
+	"OPTIONS /uploads":           {TusOptions, ""},
+	"POST /uploads":              {CreateUpload, models.ScopeWrite},
+	"HEAD /uploads/{idUpload}":   {GetUploadOffset, models.ScopeWrite},
+	"PATCH /uploads/{idUpload}":  {PatchUpload, models.ScopeWrite},
+	"DELETE /uploads/{idUpload}": {TerminateUpload, models.ScopeWrite},
+
+	"GET /me": {GetCurrentPrincipal, models.ScopeRead},
+
+	"GET /metrics": {GetMetrics, models.ScopeRead},
+
+	"POST /admin/keys":        {CreateAPIKey, models.ScopeAdmin},
+	"GET /admin/keys":         {GetAPIKeys, models.ScopeAdmin},
+	"DELETE /admin/keys/{id}": {RevokeAPIKey, models.ScopeAdmin},
+}
+
+// compressed is the middleware of the routes returning JSON listings, which can be large.
+var compressed = []middleware.Middleware{middleware.Gzip}
+
+// RouteMiddlewares lists the middlewares wrapped around some routes only, outside of the authentication.
+// The middlewares applied to every route are chained in main.
+var RouteMiddlewares = map[string][]middleware.Middleware{
+	"GET /files":                              compressed,
+	"GET /trash":                              compressed,
+	"GET /file/{idFile}/versions":             compressed,
+	"GET /file/{idFile}/shares":               compressed,
+	"GET /file/{idFile}/shares/{id}/accesses": compressed,
+	"GET /tags":                               compressed,
+	"GET /folders/{id}/children":              compressed,
+	"GET /path/{path...}":                     compressed,
+	"GET /search":                             compressed,
+	"GET /admin/keys":                         compressed,
 }
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"errors"
+	"fileserver/internal/service"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Number of hits returned by a search, by default and at most.
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// SearchFiles searches the documents by name and content with the "q" query parameter, and returns the hits
+// ranked by relevance with a snippet of the content where the matching terms are wrapped in <mark> tags.
+// The "limit" query parameter sets the number of hits, 20 by default and 100 at most.
+func SearchFiles(w http.ResponseWriter, r *http.Request) {
+	// Step 1: Retrieve the query and the limit from the URL parameters
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		http.Error(w, "Missing search query", http.StatusBadRequest)
+		return
+	}
+	limit := defaultSearchLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > maxSearchLimit {
+			http.Error(w, fmt.Sprintf("Invalid limit, it must be a number between 1 and %d", maxSearchLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Step 2: Search the index, among the documents the caller can read
+	hits, err := service.SearchDocuments(query, limit, service.PrincipalFrom(r.Context()))
+	if errors.Is(err, service.ErrEmptyQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error searching documents: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Step 3: Return the hits
+	writeJSON(w, hits)
+}
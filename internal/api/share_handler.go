@@ -0,0 +1,320 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fileserver/internal/models"
+	"fileserver/internal/service"
+	"fileserver/internal/storage"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shareRealm is the realm of the Basic authentication asking the password of a share.
+const shareRealm = `Basic realm="shared file", charset="UTF-8"`
+
+// shareRequest is the body of a request creating a share.
+type shareRequest struct {
+	ExpiresAt    *time.Time `json:"expiresAt"`    // When the link expires, missing if it never expires
+	MaxDownloads *int       `json:"maxDownloads"` // Maximum number of downloads, missing if unlimited
+	Password     string     `json:"password"`     // Password asked to the recipients, empty for none
+}
+
+// shareView is a share as returned to the owners of the document, without the hashes.
+type shareView struct {
+	ID                uint       `json:"id"`                     // Identifier of the share
+	Prefix            string     `json:"prefix"`                 // First characters of the token
+	CreatedBy         string     `json:"createdBy,omitempty"`    // Who created the share
+	PasswordProtected bool       `json:"passwordProtected"`      // Whether the link asks a password
+	MaxDownloads      *int       `json:"maxDownloads,omitempty"` // Maximum number of downloads
+	Downloads         int        `json:"downloads"`              // Number of downloads so far
+	CreatedAt         time.Time  `json:"createdAt"`              // When the share was created
+	ExpiresAt         *time.Time `json:"expiresAt,omitempty"`    // When the link expires
+	LastAccessAt      *time.Time `json:"lastAccessAt,omitempty"` // When the link was last accessed
+	RevokedAt         *time.Time `json:"revokedAt,omitempty"`    // When the share was revoked
+	URL               string     `json:"url,omitempty"`          // Path of the public link, returned only on creation
+}
+
+// shareAccessView is an access to a share, as listed in its log.
+type shareAccessView struct {
+	Outcome    string    `json:"outcome"`             // Outcome of the access, e.g. "downloaded"
+	RemoteAddr string    `json:"remoteAddr"`          // Address of the client
+	UserAgent  string    `json:"userAgent,omitempty"` // User agent of the client
+	AccessedAt time.Time `json:"accessedAt"`          // When the link was accessed
+}
+
+// newShareView converts a stored share to its JSON view.
+func newShareView(share *models.Share) shareView {
+	return shareView{
+		ID:                share.ID,
+		Prefix:            share.Prefix,
+		CreatedBy:         share.CreatedBy,
+		PasswordProtected: share.PasswordHash != "",
+		MaxDownloads:      share.MaxDownloads,
+		Downloads:         share.Downloads,
+		CreatedAt:         share.CreatedAt,
+		ExpiresAt:         share.ExpiresAt,
+		LastAccessAt:      share.LastAccessAt,
+		RevokedAt:         share.RevokedAt,
+	}
+}
+
+// CreateShare creates a public link to a document from a JSON body such as
+// {"expiresAt": "2025-07-01T00:00:00Z", "maxDownloads": 3, "password": "s3cret"}; all the fields are
+// optional. The link, /s/{token}, is returned in the response only: it cannot be retrieved later.
+// The caller must be allowed to change the document.
+func CreateShare(w http.ResponseWriter, r *http.Request) {
+	document, ok := documentFromPath(w, r)
+	if !ok || !authorizeDocument(w, r, document, models.ScopeWrite) {
+		return
+	}
+
+	// Step 1: Read the limits of the share from the body
+	var request shareRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Error parsing the request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Step 2: Generate the token
+	share, token, err := service.CreateShare(document, callerSubject(r), service.ShareOptions{
+		ExpiresAt:    request.ExpiresAt,
+		MaxDownloads: request.MaxDownloads,
+		Password:     request.Password,
+	})
+	if errors.Is(err, service.ErrInvalidShare) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Error creating share: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Step 3: Return the link, for the only time
+	view := newShareView(share)
+	view.URL = "/s/" + token
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", view.URL)
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(view); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// GetShares retrieves the shares of a document, the revoked ones included.
+// The caller must be allowed to change the document.
+func GetShares(w http.ResponseWriter, r *http.Request) {
+	document, ok := documentFromPath(w, r)
+	if !ok || !authorizeDocument(w, r, document, models.ScopeWrite) {
+		return
+	}
+
+	// Step 1: Retrieve the shares
+	shares, err := service.GetShares(document)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving shares: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Step 2: Convert the shares to JSON format, without their hashes
+	views := make([]shareView, len(shares))
+	for i := range shares {
+		views[i] = newShareView(&shares[i])
+	}
+	writeJSON(w, views)
+}
+
+// RevokeShare revokes a share of a document, whose link is refused from then on.
+// The caller must be allowed to change the document.
+func RevokeShare(w http.ResponseWriter, r *http.Request) {
+	share, ok := shareFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// Revoke the share
+	if err := service.RevokeShare(share); err != nil {
+		http.Error(w, fmt.Sprintf("Error revoking share: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Share %d (%s) revoked", share.ID, share.Prefix)
+}
+
+// GetShareAccesses retrieves the log of the accesses to a share of a document, the most recent first,
+// including the refused ones. The caller must be allowed to change the document.
+func GetShareAccesses(w http.ResponseWriter, r *http.Request) {
+	share, ok := shareFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	// Step 1: Retrieve the accesses
+	accesses, err := service.GetShareAccesses(share)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving share accesses: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Step 2: Convert the accesses to JSON format
+	views := make([]shareAccessView, len(accesses))
+	for i, access := range accesses {
+		views[i] = shareAccessView{
+			Outcome:    access.Outcome,
+			RemoteAddr: access.RemoteAddr,
+			UserAgent:  access.UserAgent,
+			AccessedAt: access.AccessedAt,
+		}
+	}
+	writeJSON(w, views)
+}
+
+// GetSharedFile streams the current version of a shared document to anyone holding the link, without
+// credentials. The password of a protected share is sent with HTTP Basic authentication (any user name),
+// so that the browsers ask for it. Only a GET request sending the whole document counts as a download;
+// HEAD, range and conditional requests answered without the content do not.
+func GetSharedFile(w http.ResponseWriter, r *http.Request) {
+	// Step 1: Check the token, the limits and the password of the share
+	_, password, _ := r.BasicAuth()
+	request := service.ShareRequest{
+		Password:   password,
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+	}
+	share, document, err := service.OpenShare(r.PathValue("token"), request)
+	if err != nil {
+		writeShareError(w, err)
+		return
+	}
+
+	// Step 2: Open the current version, the shares never give access to the older ones
+	object, info, ok := openObject(w, r, document.Key())
+	if !ok {
+		return
+	}
+	defer object.Close() // Ensure that the file object is closed after use
+
+	// Step 3: Record the access, counting the download only if the whole content is going to be sent
+	request.Download = fullDownload(r, info)
+	if err := service.RecordShareAccess(share, request); err != nil {
+		writeShareError(w, err)
+		return
+	}
+
+	// Step 4: Stream the content
+	w.Header().Set("Cache-Control", "no-store")
+	sendObject(w, r, document, object, info, document.ContentType())
+}
+
+// fullDownload tells whether http.ServeContent answers the request with the whole content of the object:
+// a GET request whose conditional headers do not lead to 304 Not Modified or 412 Precondition Failed,
+// without a Range header or with an If-Range header that no longer matches the object.
+func fullDownload(r *http.Request, info storage.ObjectInfo) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	etag := ""
+	if info.ETag != "" {
+		etag = strconv.Quote(info.ETag)
+	}
+	modified := info.LastModified.Truncate(time.Second)
+
+	// Step 1: Preconditions answered with 412 Precondition Failed
+	if header := r.Header.Get("If-Match"); header != "" {
+		if !etagMatches(header, etag, false) {
+			return false
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && !info.LastModified.IsZero() {
+		if modified.After(since) {
+			return false
+		}
+	}
+
+	// Step 2: Revalidations answered with 304 Not Modified
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		if etagMatches(header, etag, true) {
+			return false
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !info.LastModified.IsZero() {
+		if !modified.After(since) {
+			return false
+		}
+	}
+
+	// Step 3: Ranges, served in full only when the If-Range validator is stale
+	if r.Header.Get("Range") == "" {
+		return true
+	}
+	ifRange := r.Header.Get("If-Range")
+	switch {
+	case ifRange == "":
+		return false
+	case strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/"):
+		return ifRange != etag
+	default:
+		date, err := http.ParseTime(ifRange)
+		return err != nil || !date.Equal(modified)
+	}
+}
+
+// etagMatches tells whether the entity tag matches the list of an If-Match (strong comparison) or
+// If-None-Match (weak comparison) header.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if etag == "" {
+			continue
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// shareFromPath retrieves the share identified by the "id" path value among the shares of the document
+// identified by the "idFile" path value, checking that the caller can change the document.
+// On failure the error response is written and false is returned.
+func shareFromPath(w http.ResponseWriter, r *http.Request) (*models.Share, bool) {
+	document, ok := documentFromPath(w, r)
+	if !ok || !authorizeDocument(w, r, document, models.ScopeWrite) {
+		return nil, false
+	}
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 0)
+	if err != nil {
+		http.Error(w, "Invalid share id: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	share, err := service.GetShare(document, uint(id))
+	if err != nil {
+		writeShareError(w, err)
+		return nil, false
+	}
+	return share, true
+}
+
+// writeShareError maps the errors of the share functions to status codes.
+func writeShareError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrShareNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrShareExpired), errors.Is(err, service.ErrShareExhausted):
+		status = http.StatusGone
+	case errors.Is(err, service.ErrSharePassword):
+		w.Header().Set("WWW-Authenticate", shareRealm)
+		status = http.StatusUnauthorized
+	}
+	http.Error(w, err.Error(), status)
+}
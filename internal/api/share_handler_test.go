@@ -0,0 +1,69 @@
+package api
+
+import (
+	"fileserver/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFullDownloadAgreesWithServeContent checks that a download is counted exactly when http.ServeContent
+// sends the whole content of the object.
+func TestFullDownloadAgreesWithServeContent(t *testing.T) {
+	const content = "the content of the shared document"
+	info := storage.ObjectInfo{
+		Size:         int64(len(content)),
+		ETag:         "abc123",
+		LastModified: time.Date(2025, 3, 1, 9, 30, 15, 500, time.UTC),
+	}
+	etag := strconv.Quote(info.ETag)
+	modified := info.LastModified.Format(http.TimeFormat)
+	before := info.LastModified.Add(-time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    bool
+	}{
+		{"plain GET", http.MethodGet, nil, true},
+		{"HEAD", http.MethodHead, nil, false},
+		{"range", http.MethodGet, map[string]string{"Range": "bytes=0-9"}, false},
+		{"range with matching If-Range etag", http.MethodGet, map[string]string{"Range": "bytes=0-9", "If-Range": etag}, false},
+		{"range with stale If-Range etag", http.MethodGet, map[string]string{"Range": "bytes=0-9", "If-Range": `"old"`}, true},
+		{"range with matching If-Range date", http.MethodGet, map[string]string{"Range": "bytes=0-9", "If-Range": modified}, false},
+		{"range with stale If-Range date", http.MethodGet, map[string]string{"Range": "bytes=0-9", "If-Range": before}, true},
+		{"If-None-Match matching", http.MethodGet, map[string]string{"If-None-Match": `"other", W/` + etag}, false},
+		{"If-None-Match star", http.MethodGet, map[string]string{"If-None-Match": "*"}, false},
+		{"If-None-Match stale", http.MethodGet, map[string]string{"If-None-Match": `"old"`}, true},
+		{"If-Modified-Since current", http.MethodGet, map[string]string{"If-Modified-Since": modified}, false},
+		{"If-Modified-Since older", http.MethodGet, map[string]string{"If-Modified-Since": before}, true},
+		{"If-None-Match stale wins over If-Modified-Since", http.MethodGet, map[string]string{"If-None-Match": `"old"`, "If-Modified-Since": modified}, true},
+		{"If-Match failing", http.MethodGet, map[string]string{"If-Match": `"old"`}, false},
+		{"If-Match weak", http.MethodGet, map[string]string{"If-Match": "W/" + etag}, false},
+		{"If-Match matching", http.MethodGet, map[string]string{"If-Match": etag}, true},
+		{"If-Unmodified-Since older", http.MethodGet, map[string]string{"If-Unmodified-Since": before}, false},
+		{"If-Unmodified-Since current", http.MethodGet, map[string]string{"If-Unmodified-Since": modified}, true},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, "/s/token", nil)
+		for name, value := range test.headers {
+			r.Header.Set(name, value)
+		}
+		if got := fullDownload(r, info); got != test.want {
+			t.Errorf("%s: fullDownload = %v, want %v", test.name, got, test.want)
+		}
+
+		// The same request served by http.ServeContent
+		w := httptest.NewRecorder()
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "document", info.LastModified, strings.NewReader(content))
+		served := test.method == http.MethodGet && w.Code == http.StatusOK && w.Body.String() == content
+		if served != test.want {
+			t.Errorf("%s: ServeContent answered %d with %d bytes, the download counting disagrees", test.name, w.Code, w.Body.Len())
+		}
+	}
+}
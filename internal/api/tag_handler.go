@@ -0,0 +1,138 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fileserver/internal/models"
+	"fileserver/internal/service"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"slices"
+)
+
+// tagsRequest is the body of a request tagging a document.
+type tagsRequest struct {
+	Tags []string `json:"tags"` // Names of the tags to attach
+}
+
+// AddFileTags attaches the tags of the JSON body (e.g. {"tags": ["contract", "acme"]}) to a document and
+// returns all the tags of the document.
+func AddFileTags(w http.ResponseWriter, r *http.Request) {
+	// Extract the document id from the path value
+	idFile, err := uuid.Parse(r.PathValue("idFile"))
+	if err != nil {
+		http.Error(w, "Error parsing the idFile: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Step 1: Read the tags from the body
+	var request tagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Error parsing the request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tags, err := parseTags(request.Tags)
+	if err != nil {
+		http.Error(w, "Invalid tag: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(tags) == 0 {
+		http.Error(w, "No tags in the request", http.StatusBadRequest)
+		return
+	}
+
+	// Step 2: Get document from database
+	document, err := service.GetDocument(idFile)
+	if err != nil {
+		http.Error(w, "Document not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if !authorizeDocument(w, r, document, models.ScopeWrite) {
+		return
+	}
+
+	// Step 3: Attach the tags
+	if err := service.AddTags(document, tags); err != nil {
+		http.Error(w, fmt.Sprintf("Error tagging document: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Step 4: Return the tags of the document
+	writeJSON(w, document.Tags)
+}
+
+// RemoveFileTag detaches a tag from a document.
+func RemoveFileTag(w http.ResponseWriter, r *http.Request) {
+	// Extract the document id and the tag from the path values
+	idFile, err := uuid.Parse(r.PathValue("idFile"))
+	if err != nil {
+		http.Error(w, "Error parsing the idFile: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tag, err := service.NormalizeTag(r.PathValue("tag"))
+	if err != nil {
+		http.Error(w, "Invalid tag: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Step 1: Get document from database
+	document, err := service.GetDocument(idFile)
+	if err != nil {
+		http.Error(w, "Document not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if !authorizeDocument(w, r, document, models.ScopeWrite) {
+		return
+	}
+
+	// Step 2: Detach the tag
+	if err := service.RemoveTag(document, tag); errors.Is(err, service.ErrTagNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, fmt.Sprintf("Error untagging document: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Tag %s removed from file with ID %v", tag, idFile)
+}
+
+// GetTags retrieves the list of tags in use, with the number of documents using each of them.
+func GetTags(w http.ResponseWriter, r *http.Request) {
+	// Step 1: Retrieve the tags and their counts, on the documents the caller can read
+	tags, err := service.GetTags(service.PrincipalFrom(r.Context()))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving tags: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Step 2: Convert the tags to JSON format
+	writeJSON(w, tags)
+}
+
+// parseTags normalizes a list of tag names, dropping the duplicates.
+func parseTags(names []string) ([]string, error) {
+	tags := make([]string, 0, len(names))
+	for _, name := range names {
+		tag, err := service.NormalizeTag(name)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// writeJSON encodes value as the JSON response, with status 200 OK.
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"fileserver/internal/models"
+	"fileserver/internal/service"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// GetTrash retrieves the list of documents moved to the trash and not purged yet.
+func GetTrash(w http.ResponseWriter, r *http.Request) {
+	// Step 1: Retrieve the logically deleted documents the caller can read
+	documents, err := service.GetTrash(service.PrincipalFrom(r.Context()))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving trash: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Step 2: Convert the documents to JSON format
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(documents); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// RestoreFile moves a document out of the trash.
+func RestoreFile(w http.ResponseWriter, r *http.Request) {
+	// Ensure that the request method is POST
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Extract the document id from the path value
+	idFile, err := uuid.Parse(r.PathValue("idFile"))
+	if err != nil {
+		http.Error(w, "Error parsing the idFile: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Step 1: Get the document, the caller must be allowed to change it
+	document, err := service.GetDocumentIncludingDeleted(idFile)
+	if err != nil {
+		http.Error(w, "Document not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if !authorizeDocument(w, r, document, models.ScopeWrite) {
+		return
+	}
+
+	// Step 2: Restore the document, which must be in the trash
+	if err := service.RestoreDocument(idFile); err != nil {
+		http.Error(w, "Error restoring document: "+err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "File with ID %v restored successfully", idFile)
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/metrics"
+	"fileserver/internal/models"
+	"fileserver/internal/service"
+	"fmt"
+	"github.com/google/uuid"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Constants for the tus resumable upload protocol (https://tus.io/protocols/resumable-upload).
+const (
+	tusVersion             = "1.0.0"                           // Supported version of the protocol
+	tusExtensions          = "creation,termination,checksum"   // Supported extensions
+	tusContentType         = "application/offset+octet-stream" // Content type of the PATCH requests
+	statusChecksumMismatch = 460                               // Status code of a chunk with a wrong checksum
+)
+
+// TusOptions describes the capabilities of the tus server.
+func TusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Checksum-Algorithm", strings.Join(service.ChecksumAlgorithms, ","))
+	if maxSize := config.App.Upload.MaxUploadSize(); maxSize > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxSize, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateUpload starts a resumable upload (tus creation extension). The Upload-Length header is required,
+// the file name is read from the "filename" (or "name") key of the Upload-Metadata header, the policy for
+// byte-identical content from its "duplicates" key and the folder of the document, where the caller must be
+// allowed to write, from its "folderId" key (the root when missing).
+func CreateUpload(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	// Step 1: Read the length of the upload, deferred lengths are not supported
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Invalid or missing Upload-Length header", http.StatusBadRequest)
+		return
+	}
+	if maxSize := config.App.Upload.MaxUploadSize(); maxSize > 0 && length > maxSize {
+		http.Error(w, fmt.Sprintf("Upload-Length exceeds the maximum size of %d bytes", maxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Step 2: Read the metadata of the upload
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "Invalid Upload-Metadata header: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := filepath.Base(metadata["filename"])
+	if metadata["filename"] == "" {
+		name = filepath.Base(metadata["name"])
+	}
+	if name == "." || name == "/" {
+		name = "upload"
+	}
+	duplicates := metadata["duplicates"]
+	if duplicates == "" {
+		duplicates = config.App.Upload.DuplicatesPolicy()
+	}
+	if duplicates != config.DuplicatesReject && duplicates != config.DuplicatesLink {
+		http.Error(w, "Invalid duplicates policy: "+duplicates, http.StatusBadRequest)
+		return
+	}
+	// The caller must be allowed to write in the folder of the document
+	folderID, err := parseFolderID(metadata["folderId"])
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+	if !authorizeFolder(w, r, folderID, models.ScopeWrite) {
+		return
+	}
+
+	// Step 3: Create the upload
+	upload, err := service.CreateUpload(r.Context(), name, r.Header.Get("Upload-Metadata"), length, duplicates, callerSubject(r), folderID)
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/uploads/"+upload.IdUpload.String())
+	if upload.IdFile != nil {
+		w.Header().Set("Content-Location", "/file/"+upload.IdFile.String())
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// GetUploadOffset returns the offset of a resumable upload, so that the client can resume it.
+func GetUploadOffset(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	idUpload, err := uuid.Parse(r.PathValue("idUpload"))
+	if err != nil {
+		http.Error(w, "Error parsing the idUpload: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	upload, ok := authorizeUpload(w, r, idUpload)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		w.Header().Set("Upload-Metadata", upload.Metadata)
+	}
+	if upload.IdFile != nil {
+		w.Header().Set("Content-Location", "/file/"+upload.IdFile.String())
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// PatchUpload appends the body of the request to a resumable upload at the given Upload-Offset.
+// The Upload-Checksum header, if present, is verified before the chunk is accepted (checksum extension).
+// Once the last byte is received the document is created and its location returned in Content-Location.
+func PatchUpload(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != tusContentType {
+		http.Error(w, "Content-Type must be "+tusContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	idUpload, err := uuid.Parse(r.PathValue("idUpload"))
+	if err != nil {
+		http.Error(w, "Error parsing the idUpload: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid or missing Upload-Offset header", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := authorizeUpload(w, r, idUpload); !ok {
+		return
+	}
+
+	// Append the chunk
+	defer metrics.StartUpload()()
+	upload, document, err := service.WriteUpload(r.Context(), idUpload, offset, metrics.CountUpload(r.Body), r.Header.Get("Upload-Checksum"))
+	if upload != nil {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	}
+	if err != nil {
+		writeUploadError(w, err)
+		return
+	}
+	if document != nil {
+		slog.InfoContext(r.Context(), "Upload completed", "document_id", document.IdFile)
+		w.Header().Set("Content-Location", "/file/"+document.IdFile.String())
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TerminateUpload drops a resumable upload and the content received so far (termination extension).
+func TerminateUpload(w http.ResponseWriter, r *http.Request) {
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	idUpload, err := uuid.Parse(r.PathValue("idUpload"))
+	if err != nil {
+		http.Error(w, "Error parsing the idUpload: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if _, ok := authorizeUpload(w, r, idUpload); !ok {
+		return
+	}
+	if err := service.TerminateUpload(r.Context(), idUpload); err != nil {
+		writeUploadError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeUpload retrieves a resumable upload and checks that the caller of a request owns it.
+// On failure the error response is written and false is returned.
+func authorizeUpload(w http.ResponseWriter, r *http.Request, idUpload uuid.UUID) (*models.Upload, bool) {
+	upload, err := service.GetUpload(idUpload)
+	if err == nil {
+		err = service.CheckUploadAccess(service.PrincipalFrom(r.Context()), upload)
+	}
+	if err != nil {
+		writeUploadError(w, err)
+		return nil, false
+	}
+	return upload, true
+}
+
+// checkTusResumable sets the Tus-Resumable header of the response and checks that the client speaks the
+// supported version of the protocol, replying 412 Precondition Failed otherwise.
+func checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported Tus-Resumable version", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// writeUploadError maps the errors of the resumable upload functions to the status codes of the protocol.
+func writeUploadError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, service.ErrUploadNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrOffsetMismatch), errors.Is(err, service.ErrDuplicateDocument):
+		status = http.StatusConflict
+	case errors.Is(err, service.ErrUploadLocked):
+		status = http.StatusLocked
+	case errors.Is(err, service.ErrUploadTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrChecksumMismatch):
+		status = statusChecksumMismatch
+	case errors.Is(err, service.ErrChecksumNotSupported):
+		status = http.StatusBadRequest
+	case errors.Is(err, service.ErrMultipartNotSupported):
+		status = http.StatusNotImplemented
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// parseUploadMetadata decodes the Upload-Metadata header: comma separated pairs made of a key and
+// an optional base64 encoded value, separated by a space.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("empty key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("value of %s is not base64 encoded", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
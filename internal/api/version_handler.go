@@ -0,0 +1,130 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fileserver/internal/models"
+	"fileserver/internal/service"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"strconv"
+)
+
+// UploadVersion handles the upload of a new version of an existing document. The file is streamed to the
+// storage as for POST /file and becomes the current version; the previous versions are kept.
+func UploadVersion(w http.ResponseWriter, r *http.Request) {
+	// Extract the document id from the path value
+	idFile, err := uuid.Parse(r.PathValue("idFile"))
+	if err != nil {
+		http.Error(w, "Error parsing the idFile: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Step 1: Get document from database
+	document, err := service.GetDocument(idFile)
+	if err != nil {
+		http.Error(w, "Document not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if !authorizeDocument(w, r, document, models.ScopeWrite) {
+		return
+	}
+
+	// Step 2: Stream the file part of the multipart body to the storage
+	upload, ok := receiveFile(w, r, nil)
+	if !ok {
+		return
+	}
+
+	// Step 3: Save the content as the new current version
+	version, err := service.AddVersion(r.Context(), document, service.StagedFile{
+		Name:        upload.name,
+		Key:         upload.key,
+		Fingerprint: upload.fingerprint,
+		Size:        upload.size,
+		MimeType:    upload.mimeType,
+	})
+	if err != nil {
+		http.Error(w, "Error adding version: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Respond to the client with a success message
+	fmt.Fprintf(w, "File %s uploaded successfully as version %d of %v! (%d bytes)\n", upload.name, version.Number, idFile, upload.size)
+}
+
+// GetVersions retrieves the list of versions of a document, from the oldest to the newest.
+func GetVersions(w http.ResponseWriter, r *http.Request) {
+	// Extract the document id from the path value
+	idFile, err := uuid.Parse(r.PathValue("idFile"))
+	if err != nil {
+		http.Error(w, "Error parsing the idFile: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Step 1: Get document from database
+	document, err := service.GetDocument(idFile)
+	if err != nil {
+		http.Error(w, "Document not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if !authorizeDocument(w, r, document, models.ScopeRead) {
+		return
+	}
+
+	// Step 2: Retrieve its versions
+	versions, err := service.GetVersions(r.Context(), document)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error retrieving versions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Step 3: Convert the versions to JSON format
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(versions); err != nil {
+		http.Error(w, fmt.Sprintf("Error encoding response: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// RestoreVersion rolls a document back to one of its versions, whose content becomes a new version.
+func RestoreVersion(w http.ResponseWriter, r *http.Request) {
+	// Extract the document id and the version number from the path values
+	idFile, err := uuid.Parse(r.PathValue("idFile"))
+	if err != nil {
+		http.Error(w, "Error parsing the idFile: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	number, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil {
+		http.Error(w, "Error parsing the version: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Step 1: Get document from database
+	document, err := service.GetDocument(idFile)
+	if err != nil {
+		http.Error(w, "Document not found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	if !authorizeDocument(w, r, document, models.ScopeWrite) {
+		return
+	}
+
+	// Step 2: Copy the content of the version to a new version
+	version, err := service.RestoreVersion(r.Context(), document, number)
+	if errors.Is(err, service.ErrVersionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error restoring version: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success response
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Version %d of file with ID %v restored as version %d", number, idFile, version.Number)
+}
@@ -0,0 +1,200 @@
+package extract
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/ledongthuc/pdf"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// MaxTextLength is the maximum number of bytes of text extracted from a content; the rest is ignored.
+// It keeps the search index small, and below the 1 MB limit of the Postgres tsvector.
+const MaxTextLength = 512 * 1024
+
+// ErrUnsupported is returned by Text when no text can be extracted from the format of the content.
+var ErrUnsupported = errors.New("unsupported format")
+
+// Formats supported by the extraction.
+const (
+	formatPlain = "plain"
+	formatPDF   = "pdf"
+	formatDOCX  = "docx"
+)
+
+// Supported reports whether text can be extracted from a content with the given MIME type and file extension.
+//
+// Parameters:
+// - mimeType (string): The MIME type of the content.
+// - extension (string): The lower case extension of the file name, including the dot (e.g. ".pdf").
+//
+// Returns:
+// - bool: True if Text handles the format.
+func Supported(mimeType, extension string) bool {
+	return format(mimeType, extension) != ""
+}
+
+// Text extracts the plain text of a PDF, DOCX, plain text or Markdown content.
+// The text is truncated to MaxTextLength bytes; invalid UTF-8 sequences and NUL characters are dropped.
+//
+// Parameters:
+// - content (io.ReadSeeker): The content to read. PDF and DOCX need random access to it.
+// - size (int64): The size of the content in bytes.
+// - mimeType (string): The MIME type of the content.
+// - extension (string): The lower case extension of the file name, including the dot (e.g. ".pdf").
+//
+// Returns:
+// - string: The text of the content.
+// - error: ErrUnsupported if the format is not supported, or an error if the content cannot be parsed.
+func Text(content io.ReadSeeker, size int64, mimeType, extension string) (string, error) {
+	var text string
+	var err error
+	switch format(mimeType, extension) {
+	case formatPlain:
+		var data []byte
+		data, err = io.ReadAll(io.LimitReader(content, MaxTextLength))
+		text = string(data)
+	case formatPDF:
+		text, err = pdfText(&readerAt{content: content}, size)
+	case formatDOCX:
+		text, err = docxText(&readerAt{content: content}, size)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupported, mimeType)
+	}
+	if err != nil {
+		return "", err
+	}
+	// NUL characters are not accepted by Postgres in text columns
+	return truncate(strings.ReplaceAll(strings.ToValidUTF8(text, ""), "\x00", "")), nil
+}
+
+// format returns the format of a content, preferring its extension, or "" when it is not supported.
+func format(mimeType, extension string) string {
+	switch extension {
+	case ".txt", ".text", ".md", ".markdown":
+		return formatPlain
+	case ".pdf":
+		return formatPDF
+	case ".docx":
+		return formatDOCX
+	}
+
+	base, _, _ := strings.Cut(mimeType, ";")
+	switch {
+	case base == "text/plain", base == "text/markdown", base == "text/x-markdown":
+		return formatPlain
+	case base == "application/pdf":
+		return formatPDF
+	case base == "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
+		return formatDOCX
+	}
+	return ""
+}
+
+// pdfText extracts the text of the pages of a PDF document.
+func pdfText(content io.ReaderAt, size int64) (text string, err error) {
+	// The PDF parser panics on some malformed documents
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("error parsing pdf: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(content, size)
+	if err != nil {
+		return "", fmt.Errorf("error parsing pdf: %v", err)
+	}
+	plain, err := reader.GetPlainText()
+	if err != nil {
+		return "", fmt.Errorf("error extracting pdf text: %v", err)
+	}
+	data, err := io.ReadAll(io.LimitReader(plain, MaxTextLength))
+	if err != nil {
+		return "", fmt.Errorf("error extracting pdf text: %v", err)
+	}
+	return string(data), nil
+}
+
+// docxText extracts the text of the paragraphs of the main part (word/document.xml) of a DOCX document.
+func docxText(content io.ReaderAt, size int64) (string, error) {
+	archive, err := zip.NewReader(content, size)
+	if err != nil {
+		return "", fmt.Errorf("error opening docx: %v", err)
+	}
+	part, err := archive.Open("word/document.xml")
+	if err != nil {
+		return "", fmt.Errorf("error opening docx document: %v", err)
+	}
+	defer part.Close()
+
+	// Collect the text runs (w:t), one line per paragraph (w:p); tabs and breaks become spaces
+	var text strings.Builder
+	decoder := xml.NewDecoder(part)
+	inText := false
+	for text.Len() < MaxTextLength {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("error parsing docx document: %v", err)
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "t":
+				inText = true
+			case "tab", "br":
+				text.WriteByte(' ')
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(element)
+			}
+		}
+	}
+	return text.String(), nil
+}
+
+// truncate cuts a text to MaxTextLength bytes without splitting a UTF-8 sequence.
+func truncate(text string) string {
+	if len(text) <= MaxTextLength {
+		return text
+	}
+	cut := MaxTextLength
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut]
+}
+
+// readerAt adapts a seekable content to io.ReaderAt, as needed by the PDF and ZIP readers.
+type readerAt struct {
+	mu      sync.Mutex
+	content io.ReadSeeker
+}
+
+// ReadAt reads len(p) bytes from the content starting at offset off.
+func (r *readerAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.content.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.content, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"log/slog"
+	"time"
+)
+
+// slowQueryThreshold is the duration above which a query is logged as slow.
+const slowQueryThreshold = 200 * time.Millisecond
+
+// GormLogger writes the logs of GORM with slog: the failed queries as errors, the slow ones as warnings
+// and the others at the debug level. The records not found are not errors: the callers handle them.
+// The values of the queries are not written, since they can hold secrets such as the hashes of the keys.
+type GormLogger struct{}
+
+// LogMode is ignored: the level of the logs is the one of slog.
+func (l GormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+// Info writes a message of GORM at the info level.
+func (GormLogger) Info(ctx context.Context, message string, args ...any) {
+	slog.InfoContext(ctx, fmt.Sprintf(message, args...))
+}
+
+// Warn writes a message of GORM at the warning level.
+func (GormLogger) Warn(ctx context.Context, message string, args ...any) {
+	slog.WarnContext(ctx, fmt.Sprintf(message, args...))
+}
+
+// Error writes a message of GORM at the error level.
+func (GormLogger) Error(ctx context.Context, message string, args ...any) {
+	slog.ErrorContext(ctx, fmt.Sprintf(message, args...))
+}
+
+// Trace writes a query once it is executed.
+func (GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	level, message := slog.LevelDebug, "Query executed"
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		level, message = slog.LevelError, "Query failed"
+	case elapsed > slowQueryThreshold:
+		level, message = slog.LevelWarn, "Slow query"
+	}
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Duration("duration", elapsed),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	slog.LogAttrs(ctx, level, message, attrs...)
+}
+
+// ParamsFilter leaves the placeholders of the queries in place of their values.
+func (GormLogger) ParamsFilter(_ context.Context, sql string, _ ...any) (string, []any) {
+	return sql, nil
+}
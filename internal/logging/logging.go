@@ -0,0 +1,130 @@
+// Package logging configures the structured logs of the application with log/slog, and carries the
+// attributes of a request, such as its ID, its caller and its document, to every log written while serving it.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// Formats of the logs.
+const (
+	FormatText = "text" // key=value pairs, for the terminals
+	FormatJSON = "json" // One JSON object per line, for the log pipelines
+)
+
+// NewHandler creates the handler writing the logs in a format, adding to every record the attributes of
+// the request carried by its context.
+//
+// Parameters:
+// - writer (io.Writer): Where the logs are written, usually os.Stderr.
+// - format (string): FormatText or FormatJSON.
+// - level (slog.Leveler): The minimum level of the records written.
+//
+// Returns:
+// - slog.Handler: The handler of the logs.
+// - error: An error is returned if the format is not supported.
+func NewHandler(writer io.Writer, format string, level slog.Leveler) (slog.Handler, error) {
+	options := &slog.HandlerOptions{Level: level}
+	switch format {
+	case FormatText:
+		return contextHandler{slog.NewTextHandler(writer, options)}, nil
+	case FormatJSON:
+		return contextHandler{slog.NewJSONHandler(writer, options)}, nil
+	default:
+		return nil, fmt.Errorf("log format %s is not supported", format)
+	}
+}
+
+// contextHandler is a slog.Handler adding the attributes of the request to the records.
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle adds the attributes of the request carried by ctx, if any, then writes the record.
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs := requestAttrsFrom(ctx); attrs != nil {
+		record.AddAttrs(attrs.list()...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs returns a handler adding attributes to the records, besides the ones of the request.
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns a handler nesting the attributes of the records in a group.
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// requestAttrs holds the attributes of a request, filled while the request goes through the middlewares
+// and the handlers.
+type requestAttrs struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// list returns a copy of the attributes.
+func (a *requestAttrs) list() []slog.Attr {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]slog.Attr(nil), a.attrs...)
+}
+
+// requestAttrsKey is the key of the attributes of the request in its context.
+type requestAttrsKey struct{}
+
+// requestAttrsFrom returns the attributes of the request carried by ctx, nil when there are none.
+func requestAttrsFrom(ctx context.Context) *requestAttrs {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(requestAttrsKey{}).(*requestAttrs)
+	return attrs
+}
+
+// WithRequest returns a copy of ctx carrying the attributes of a new request, added to every log written
+// with that context (slog.InfoContext, ...). More attributes can be added later with AddAttrs.
+//
+// Parameters:
+// - ctx (context.Context): The context of the request.
+// - attrs (...slog.Attr): The first attributes of the request, e.g. its ID.
+//
+// Returns:
+// - context.Context: The context carrying the attributes.
+func WithRequest(ctx context.Context, attrs ...slog.Attr) context.Context {
+	return context.WithValue(ctx, requestAttrsKey{}, &requestAttrs{attrs: attrs})
+}
+
+// AddAttrs adds attributes to the request carried by ctx, e.g. its caller once authenticated. An attribute
+// already set is replaced. Without a request in ctx nothing is done.
+//
+// Parameters:
+// - ctx (context.Context): The context of the request.
+// - attrs (...slog.Attr): The attributes to add.
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	requestAttrs := requestAttrsFrom(ctx)
+	if requestAttrs == nil {
+		return
+	}
+	requestAttrs.mu.Lock()
+	defer requestAttrs.mu.Unlock()
+	for _, attr := range attrs {
+		replaced := false
+		for i := range requestAttrs.attrs {
+			if requestAttrs.attrs[i].Key == attr.Key {
+				requestAttrs.attrs[i] = attr
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			requestAttrs.attrs = append(requestAttrs.attrs, attr)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"gorm.io/gorm"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newLogger returns a logger writing JSON records at the debug level into a buffer, and a function
+// decoding the records written so far.
+func newLogger(t *testing.T) (*slog.Logger, func() []map[string]any) {
+	t.Helper()
+	var buffer bytes.Buffer
+	handler, err := NewHandler(&buffer, FormatJSON, slog.LevelDebug)
+	if err != nil {
+		t.Fatalf("NewHandler: %v", err)
+	}
+	return slog.New(handler), func() []map[string]any {
+		var records []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var record map[string]any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("invalid log line %q: %v", line, err)
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+}
+
+func TestNewHandlerFormats(t *testing.T) {
+	var buffer bytes.Buffer
+	handler, err := NewHandler(&buffer, FormatText, slog.LevelWarn)
+	if err != nil {
+		t.Fatalf("NewHandler(text): %v", err)
+	}
+	logger := slog.New(handler)
+	logger.Info("dropped")
+	logger.Warn("written", "key", "value")
+	if output := buffer.String(); strings.Contains(output, "dropped") || !strings.Contains(output, "msg=written key=value") {
+		t.Errorf("text output = %q, want the warning only", output)
+	}
+	if _, err := NewHandler(&buffer, "xml", slog.LevelInfo); err == nil {
+		t.Errorf("NewHandler of an unsupported format succeeded")
+	}
+}
+
+func TestRequestAttributes(t *testing.T) {
+	logger, records := newLogger(t)
+	ctx := WithRequest(context.Background(), slog.String("request_id", "trace-42"))
+	logger.InfoContext(ctx, "started")
+
+	// The attributes added later are written too, an attribute set again is replaced
+	AddAttrs(ctx, slog.String("caller", "apikey:1"), slog.String("document_id", "first"))
+	AddAttrs(ctx, slog.String("document_id", "second"))
+	logger.With("component", "upload").InfoContext(ctx, "stored")
+
+	// Without request nothing is added
+	AddAttrs(context.Background(), slog.String("caller", "nobody"))
+	logger.Info("background")
+
+	logged := records()
+	if len(logged) != 3 {
+		t.Fatalf("records = %v, want 3", logged)
+	}
+	if logged[0]["request_id"] != "trace-42" || logged[0]["caller"] != nil {
+		t.Errorf("first record = %v, want the request ID only", logged[0])
+	}
+	if logged[1]["request_id"] != "trace-42" || logged[1]["caller"] != "apikey:1" ||
+		logged[1]["document_id"] != "second" || logged[1]["component"] != "upload" {
+		t.Errorf("second record = %v", logged[1])
+	}
+	if logged[2]["request_id"] != nil || logged[2]["caller"] != nil {
+		t.Errorf("record without request = %v", logged[2])
+	}
+}
+
+func TestGormLoggerLevels(t *testing.T) {
+	logger, records := newLogger(t)
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(previous)
+
+	query := func() (string, int64) { return "SELECT * FROM api_keys WHERE hash = $1", 1 }
+	ctx := context.Background()
+	GormLogger{}.Trace(ctx, time.Now(), query, nil)
+	GormLogger{}.Trace(ctx, time.Now(), query, gorm.ErrRecordNotFound)
+	GormLogger{}.Trace(ctx, time.Now().Add(-time.Second), query, nil)
+	GormLogger{}.Trace(ctx, time.Now(), query, errors.New("connection refused"))
+
+	want := []struct{ level, message string }{
+		{"DEBUG", "Query executed"},
+		{"DEBUG", "Query executed"},
+		{"WARN", "Slow query"},
+		{"ERROR", "Query failed"},
+	}
+	logged := records()
+	if len(logged) != len(want) {
+		t.Fatalf("records = %v, want %d", logged, len(want))
+	}
+	for i, record := range logged {
+		if record["level"] != want[i].level || record["msg"] != want[i].message || record["sql"] == nil {
+			t.Errorf("record %d = %v, want %s %q", i, record, want[i].level, want[i].message)
+		}
+	}
+	if logged[3]["error"] != "connection refused" {
+		t.Errorf("failed query logged without its error: %v", logged[3])
+	}
+
+	// The values of the queries are never written
+	if sql, values := (GormLogger{}).ParamsFilter(ctx, "SELECT 1 WHERE hash = ?", "secret"); sql != "SELECT 1 WHERE hash = ?" || values != nil {
+		t.Errorf("ParamsFilter = %q, %v; want the placeholders only", sql, values)
+	}
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// queryStartKey is the key of the start time of a query in the settings of its statement.
+const queryStartKey = "metrics:query_start"
+
+// InstrumentDB registers the callbacks of GORM measuring the duration of every query, by operation.
+//
+// Parameters:
+// - db (*gorm.DB): The database client.
+//
+// Returns:
+// - error: An error is returned if the callbacks cannot be registered.
+func InstrumentDB(db *gorm.DB) error {
+	callbacks := db.Callback()
+	operations := []struct {
+		name          string
+		before, after func(string, func(*gorm.DB)) error
+	}{
+		{"create", callbacks.Create().Before("*").Register, callbacks.Create().After("*").Register},
+		{"query", callbacks.Query().Before("*").Register, callbacks.Query().After("*").Register},
+		{"update", callbacks.Update().Before("*").Register, callbacks.Update().After("*").Register},
+		{"delete", callbacks.Delete().Before("*").Register, callbacks.Delete().After("*").Register},
+		{"row", callbacks.Row().Before("*").Register, callbacks.Row().After("*").Register},
+		{"raw", callbacks.Raw().Before("*").Register, callbacks.Raw().After("*").Register},
+	}
+	for _, operation := range operations {
+		name := operation.name
+		if err := operation.before("metrics:before_"+name, startQuery); err != nil {
+			return err
+		}
+		if err := operation.after("metrics:after_"+name, func(db *gorm.DB) { observeQuery(db, name) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startQuery records the start time of a query.
+func startQuery(db *gorm.DB) {
+	db.InstanceSet(queryStartKey, time.Now())
+}
+
+// observeQuery records the duration of a query, from the time recorded by startQuery.
+func observeQuery(db *gorm.DB, operation string) {
+	value, ok := db.InstanceGet(queryStartKey)
+	if !ok {
+		return
+	}
+	if start, ok := value.(time.Time); ok {
+		queryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DocumentCount holds the number and the total size of a set of documents.
+type DocumentCount struct {
+	Documents int64 // Number of documents
+	Bytes     int64 // Total size of their current contents, in bytes
+}
+
+// DocumentCounter counts the stored documents and the size of their contents, separating the available
+// documents from the ones in the trash.
+type DocumentCounter func() (available, trashed DocumentCount, err error)
+
+// Descriptions of the metrics of the stored documents, labelled with the state of the documents.
+var (
+	documentsDesc = prometheus.NewDesc(namespace+"_documents",
+		"Number of stored documents, by state (available or trash).", []string{"state"}, nil)
+	documentBytesDesc = prometheus.NewDesc(namespace+"_document_bytes",
+		"Total size in bytes of the current contents of the stored documents, by state (available or trash).",
+		[]string{"state"}, nil)
+)
+
+// RegisterDocuments registers the metrics of the stored documents, counted when the metrics are scraped.
+//
+// Parameters:
+// - count (DocumentCounter): The function counting the documents.
+//
+// Returns:
+// - error: An error is returned if the metrics are already registered.
+func RegisterDocuments(count DocumentCounter) error {
+	return prometheus.Register(documentCollector{count: count})
+}
+
+// documentCollector is a prometheus.Collector counting the stored documents at every scrape.
+type documentCollector struct {
+	count DocumentCounter
+}
+
+// Describe sends the descriptions of the metrics of the stored documents.
+func (c documentCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- documentsDesc
+	ch <- documentBytesDesc
+}
+
+// Collect counts the stored documents and sends the metrics, or an invalid metric if they cannot be counted.
+func (c documentCollector) Collect(ch chan<- prometheus.Metric) {
+	available, trashed, err := c.count()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(documentsDesc, err)
+		return
+	}
+	for state, count := range map[string]DocumentCount{"available": available, "trash": trashed} {
+		ch <- prometheus.MustNewConstMetric(documentsDesc, prometheus.GaugeValue, float64(count.Documents), state)
+		ch <- prometheus.MustNewConstMetric(documentBytesDesc, prometheus.GaugeValue, float64(count.Bytes), state)
+	}
+}
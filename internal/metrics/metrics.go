@@ -0,0 +1,152 @@
+// Package metrics holds the Prometheus metrics of the server: the HTTP requests, the transferred bytes, the
+// storage operations, the database queries and the stored documents. They are exposed by Handler in the
+// Prometheus text format, together with the metrics of the Go runtime and of the process.
+package metrics
+
+import (
+	"errors"
+	"fileserver/internal/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// namespace prefixes the names of the metrics of the server.
+const namespace = "fileserver"
+
+// Metrics of the HTTP requests, labelled with the pattern of the route (e.g. "GET /file/{idFile}").
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests served, by route and status code.",
+	}, []string{"route", "code"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of the HTTP requests, by route.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"route"})
+)
+
+// Metrics of the file contents received and sent by the server.
+var (
+	uploadedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_bytes_total",
+		Help:      "Number of bytes of file content received by the uploads.",
+	})
+	downloadedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "download_bytes_total",
+		Help:      "Number of bytes of file content sent by the downloads.",
+	})
+	uploadsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "uploads_in_flight",
+		Help:      "Number of requests receiving a file content.",
+	})
+)
+
+// Metrics of the operations of the storage backend.
+var (
+	storageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Duration of the operations of the storage backend, by backend and operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend", "operation"})
+	storageErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_errors_total",
+		Help:      "Number of failed operations of the storage backend, by backend and operation.",
+	}, []string{"backend", "operation"})
+)
+
+// queryDuration measures the database queries, by GORM operation.
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "db_query_duration_seconds",
+	Help:      "Duration of the database queries, by operation.",
+	Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+}, []string{"operation"})
+
+// Handler returns the handler exposing the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRequest records a served HTTP request.
+//
+// Parameters:
+// - route (string): The pattern of the route, as registered in the ServeMux.
+// - status (int): The status code of the response.
+// - duration (time.Duration): How long the request took to be served.
+func ObserveRequest(route string, status int, duration time.Duration) {
+	requestsTotal.WithLabelValues(route, strconv.Itoa(status)).Inc()
+	requestDuration.WithLabelValues(route).Observe(duration.Seconds())
+}
+
+// StorageObserver returns the function recording the operations of a storage backend, to be passed to
+// storage.Instrument. A missing object is not counted as an error, since it is an expected answer.
+//
+// Parameters:
+// - backend (string): The type of the backend, e.g. "minio".
+//
+// Returns:
+// - storage.Observer: The function recording the operations.
+func StorageObserver(backend string) storage.Observer {
+	return func(operation string, duration time.Duration, err error) {
+		storageDuration.WithLabelValues(backend, operation).Observe(duration.Seconds())
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			storageErrors.WithLabelValues(backend, operation).Inc()
+		}
+	}
+}
+
+// StartUpload counts a request receiving a file content among the uploads in flight, until the returned
+// function is called.
+func StartUpload() (done func()) {
+	uploadsInFlight.Inc()
+	return uploadsInFlight.Dec
+}
+
+// CountUpload returns a reader counting the bytes read from an uploaded content.
+func CountUpload(reader io.Reader) io.Reader {
+	return &countingReader{Reader: reader, counter: uploadedBytes}
+}
+
+// CountDownload returns a reader counting the bytes read from a content being downloaded.
+func CountDownload(reader io.ReadSeeker) io.ReadSeeker {
+	return &countingReadSeeker{countingReader{Reader: reader, counter: downloadedBytes}, reader}
+}
+
+// countingReader is a reader adding the bytes read to a counter.
+type countingReader struct {
+	io.Reader
+	counter prometheus.Counter
+}
+
+// Read reads from the wrapped reader and counts the bytes read.
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	if n > 0 {
+		c.counter.Add(float64(n))
+	}
+	return n, err
+}
+
+// countingReadSeeker is a seekable countingReader.
+type countingReadSeeker struct {
+	countingReader
+	seeker io.Seeker
+}
+
+// Seek moves the wrapped reader, nothing is counted.
+func (c *countingReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return c.seeker.Seek(offset, whence)
+}
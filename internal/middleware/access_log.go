@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// AccessLog logs every request once it is served, with the method, the path, the status, the size of the
+// response body, the duration, the address and the user agent of the client, besides the attributes of
+// the request such as its ID and its caller.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := recorderOf(w)
+		next.ServeHTTP(recorder, r)
+
+		// A handler that wrote nothing answered 200 OK
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		slog.LogAttrs(r.Context(), slog.LevelInfo, "Request served",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int64("bytes", recorder.bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote", r.RemoteAddr),
+			slog.String("user_agent", r.UserAgent()),
+		)
+	})
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"fileserver/config"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// anyOrigin is the allowed origin matching every origin.
+const anyOrigin = "*"
+
+// CORS answers the preflight requests of the browsers and adds the CORS headers to the responses of the
+// cross-origin requests coming from the allowed origins. The requests of the other origins are served
+// without the headers, so that the browsers keep their responses from the scripts; their preflight requests
+// are refused with 403 Forbidden. Without a configuration, or without allowed origins, the requests are
+// served unchanged.
+//
+// Parameters:
+// - settings (*config.CORS): The allowed origins, methods and headers.
+//
+// Returns:
+// - Middleware: The middleware handling the cross-origin requests.
+func CORS(settings *config.CORS) Middleware {
+	if settings == nil || len(settings.AllowedOrigins) == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	wildcard := slices.Contains(settings.AllowedOrigins, anyOrigin)
+	methods := strings.Join(settings.Methods(), ", ")
+	exposed := strings.Join(settings.Exposed(), ", ")
+	maxAge := strconv.Itoa(int(settings.PreflightMaxAge().Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			allowed := wildcard || slices.Contains(settings.AllowedOrigins, origin)
+
+			// Step 1: Refuse the preflight requests of the other origins, serve their requests unchanged
+			if !allowed {
+				if preflight {
+					http.Error(w, "Origin not allowed", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Step 2: Allow the origin; the wildcard cannot be used together with the credentials
+			header := w.Header()
+			if wildcard && !settings.AllowCredentials {
+				header.Set("Access-Control-Allow-Origin", anyOrigin)
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			if settings.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			// Step 3: Answer the preflight requests, without calling the route
+			if preflight {
+				header.Add("Vary", "Access-Control-Request-Method")
+				header.Add("Vary", "Access-Control-Request-Headers")
+				header.Set("Access-Control-Allow-Methods", methods)
+				if len(settings.AllowedHeaders) > 0 {
+					header.Set("Access-Control-Allow-Headers", strings.Join(settings.AllowedHeaders, ", "))
+				} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+					header.Set("Access-Control-Allow-Headers", requested)
+				}
+				header.Set("Access-Control-Max-Age", maxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			// Step 4: Let the scripts read the headers of the response
+			header.Set("Access-Control-Expose-Headers", exposed)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
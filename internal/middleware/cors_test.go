@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"fileserver/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serveCORS serves a request from an origin through CORS, optionally as a preflight request, and tells
+// whether the route was called.
+func serveCORS(settings *config.CORS, method, origin string, preflight bool) (*httptest.ResponseRecorder, bool) {
+	called := false
+	handler := CORS(settings)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		called = true
+	}))
+	r := httptest.NewRequest(method, "/files", nil)
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	if preflight {
+		r.Header.Set("Access-Control-Request-Method", http.MethodPut)
+		r.Header.Set("Access-Control-Request-Headers", "X-API-Key")
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w, called
+}
+
+func TestCORSAllowedOrigin(t *testing.T) {
+	settings := &config.CORS{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true}
+
+	// The preflight request is answered without calling the route
+	w, called := serveCORS(settings, http.MethodOptions, "https://app.example.com", true)
+	if called || w.Code != http.StatusNoContent {
+		t.Errorf("preflight: status %d, route called %v; want 204 without the route", w.Code, called)
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "true" ||
+		w.Header().Get("Access-Control-Allow-Headers") != "X-API-Key" ||
+		w.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Errorf("preflight headers = %v", w.Header())
+	}
+
+	// The request itself reaches the route, with the headers readable by the scripts
+	w, called = serveCORS(settings, http.MethodGet, "https://app.example.com", false)
+	if !called || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		w.Header().Get("Access-Control-Expose-Headers") == "" {
+		t.Errorf("request: route called %v, headers %v", called, w.Header())
+	}
+}
+
+func TestCORSOtherOrigins(t *testing.T) {
+	settings := &config.CORS{AllowedOrigins: []string{"https://app.example.com"}}
+	if w, called := serveCORS(settings, http.MethodOptions, "https://evil.example.com", true); called || w.Code != http.StatusForbidden {
+		t.Errorf("preflight of another origin: status %d, route called %v; want 403", w.Code, called)
+	}
+	w, called := serveCORS(settings, http.MethodGet, "https://evil.example.com", false)
+	if !called || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("request of another origin: route called %v, headers %v; want the route without CORS headers", called, w.Header())
+	}
+	if w, called := serveCORS(settings, http.MethodGet, "", false); !called || w.Header().Get("Vary") != "" {
+		t.Errorf("same-origin request: route called %v, headers %v", called, w.Header())
+	}
+}
+
+func TestCORSWildcard(t *testing.T) {
+	w, _ := serveCORS(&config.CORS{AllowedOrigins: []string{"*"}}, http.MethodGet, "https://any.example.com", false)
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "*" {
+		t.Errorf("wildcard without credentials: Access-Control-Allow-Origin %q, want *", origin)
+	}
+	w, _ = serveCORS(&config.CORS{AllowedOrigins: []string{"*"}, AllowCredentials: true}, http.MethodGet, "https://any.example.com", false)
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "https://any.example.com" {
+		t.Errorf("wildcard with credentials: Access-Control-Allow-Origin %q, want the origin", origin)
+	}
+
+	// Without allowed origins the requests are served unchanged
+	w, called := serveCORS(nil, http.MethodOptions, "https://any.example.com", true)
+	if !called || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("without configuration: route called %v, headers %v", called, w.Header())
+	}
+}
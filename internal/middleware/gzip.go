@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// gzipWriters recycles the gzip writers between the responses.
+var gzipWriters = sync.Pool{
+	New: func() any { return gzip.NewWriter(nil) },
+}
+
+// Gzip compresses the JSON responses with gzip when the client accepts it. The other responses, e.g. the
+// error messages and the file contents, are sent unchanged: the contents are often compressed already and
+// their ranges must keep matching the stored bytes.
+func Gzip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writer := &gzipResponseWriter{ResponseWriter: w}
+		defer writer.close()
+		next.ServeHTTP(writer, r)
+	})
+}
+
+// gzipResponseWriter is a http.ResponseWriter compressing the body when its content type is JSON.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gzip        *gzip.Writer // Writer of the compressed body, nil when the body is sent unchanged
+	wroteHeader bool         // Whether the headers were sent
+}
+
+// WriteHeader decides whether the body is compressed, from its status and its content type, then sends
+// the headers.
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.wroteHeader {
+		g.ResponseWriter.WriteHeader(status)
+		return
+	}
+	g.wroteHeader = true
+
+	header := g.Header()
+	if status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified &&
+		header.Get("Content-Encoding") == "" && isJSON(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		g.gzip = gzipWriters.Get().(*gzip.Writer)
+		g.gzip.Reset(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes the body, compressed when decided by WriteHeader.
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.gzip != nil {
+		return g.gzip.Write(p)
+	}
+	return g.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// Flush sends the compressed data written so far to the client.
+func (g *gzipResponseWriter) Flush() {
+	if g.gzip != nil {
+		g.gzip.Flush()
+	}
+	http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+// close ends the compressed body and gives the gzip writer back to the pool.
+func (g *gzipResponseWriter) close() {
+	if g.gzip == nil {
+		return
+	}
+	g.gzip.Close()
+	g.gzip.Reset(nil)
+	gzipWriters.Put(g.gzip)
+	g.gzip = nil
+}
+
+// acceptsGzip reports whether an Accept-Encoding header accepts gzip, e.g. "gzip, deflate, br".
+func acceptsGzip(acceptEncoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.TrimSpace(coding)
+		if !strings.EqualFold(coding, "gzip") && coding != "*" {
+			continue
+		}
+		quality := strings.ReplaceAll(params, " ", "")
+		return quality != "q=0" && quality != "q=0.0" && quality != "q=0.00" && quality != "q=0.000"
+	}
+	return false
+}
+
+// isJSON reports whether a content type is JSON, e.g. "application/json" or "application/problem+json".
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// serveGzip serves a response with a status and a content type through Gzip.
+func serveGzip(method, acceptEncoding string, status int, contentType, body string) *httptest.ResponseRecorder {
+	handler := Gzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(status)
+		if status != http.StatusNoContent {
+			io.WriteString(w, body)
+		}
+	}))
+	r := httptest.NewRequest(method, "/files", nil)
+	if acceptEncoding != "" {
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestGzipCompressesJSON(t *testing.T) {
+	const body = `{"documents": [], "total": 0}`
+	for _, contentType := range []string{"application/json", "application/json; charset=utf-8", "application/problem+json"} {
+		w := serveGzip(http.MethodGet, "br;q=1.0, gzip;q=0.8", http.StatusOK, contentType, body)
+		if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Content-Length") != "" {
+			t.Errorf("%s: Content-Encoding %q, Content-Length %q; want gzip without length", contentType,
+				w.Header().Get("Content-Encoding"), w.Header().Get("Content-Length"))
+			continue
+		}
+		reader, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("%s: invalid gzip body: %v", contentType, err)
+		}
+		if decoded, err := io.ReadAll(reader); err != nil || string(decoded) != body {
+			t.Errorf("%s: decoded body %q, %v; want %q", contentType, decoded, err, body)
+		}
+		if w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s: Vary %q, want Accept-Encoding", contentType, w.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestGzipSkipsOtherResponses(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		acceptEncoding string
+		status         int
+		contentType    string
+	}{
+		{"file content", http.MethodGet, "gzip", http.StatusOK, "application/pdf"},
+		{"error message", http.MethodGet, "gzip", http.StatusNotFound, "text/plain; charset=utf-8"},
+		{"gzip not accepted", http.MethodGet, "", http.StatusOK, "application/json"},
+		{"gzip refused", http.MethodGet, "gzip;q=0, deflate", http.StatusOK, "application/json"},
+		{"HEAD request", http.MethodHead, "gzip", http.StatusOK, "application/json"},
+		{"no content", http.MethodDelete, "gzip", http.StatusNoContent, "application/json"},
+	}
+	for _, test := range tests {
+		w := serveGzip(test.method, test.acceptEncoding, test.status, test.contentType, "content")
+		if w.Header().Get("Content-Encoding") != "" || w.Code != test.status {
+			t.Errorf("%s: status %d, Content-Encoding %q; want %d uncompressed", test.name, w.Code, w.Header().Get("Content-Encoding"), test.status)
+		}
+		if test.status != http.StatusNoContent && test.method != http.MethodHead && w.Body.String() != "content" {
+			t.Errorf("%s: body %q, want it unchanged", test.name, w.Body.String())
+		}
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"":                   false,
+		"gzip":               true,
+		"GZIP":               true,
+		"deflate, gzip":      true,
+		"gzip;q=0.5":         true,
+		"gzip; q=0":          false,
+		"gzip;q=0.000":       false,
+		"*":                  true,
+		"identity, deflate":  false,
+		"x-gzip, br":         false,
+		"br, *;q=0.1":        true,
+		"deflate;q=1, *;q=0": false,
+	}
+	for header, want := range tests {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
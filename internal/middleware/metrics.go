@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"fileserver/internal/metrics"
+	"net/http"
+	"time"
+)
+
+// Metrics records the requests of a route, by its pattern rather than by its path, so that the number of
+// series does not grow with the IDs in the paths. A panic is recorded as a 500 Internal Server Error, as
+// answered by Recover, before being let through.
+//
+// Parameters:
+// - route (string): The pattern of the route, as registered in the ServeMux (e.g. "GET /file/{idFile}").
+//
+// Returns:
+// - Middleware: The middleware recording the requests of the route.
+func Metrics(route string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := recorderOf(w)
+			defer func() {
+				if value := recover(); value != nil {
+					metrics.ObserveRequest(route, http.StatusInternalServerError, time.Since(start))
+					panic(value)
+				}
+			}()
+			next.ServeHTTP(recorder, r)
+
+			// A handler that wrote nothing answered 200 OK
+			status := recorder.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			metrics.ObserveRequest(route, status, time.Since(start))
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// Package middleware holds the HTTP middlewares wrapped around the routes: request IDs, panic recovery,
+// access logs, CORS, response compression and metrics.
+package middleware
+
+import (
+	"net/http"
+)
+
+// Middleware wraps a handler with a behaviour run around every request.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps a handler with a list of middlewares. The first middleware is the outermost one: it sees the
+// request first and the response last.
+//
+// Parameters:
+// - handler (http.Handler): The handler to wrap.
+// - middlewares (...Middleware): The middlewares, from the outermost to the innermost.
+//
+// Returns:
+// - http.Handler: The wrapped handler.
+func Chain(handler http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// responseRecorder is a http.ResponseWriter recording the status and the size of the response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int   // Status code sent, 0 until the headers are written
+	bytes  int64 // Number of bytes of the body written
+}
+
+// WriteHeader records the status code and sends the headers.
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the size of the body written, sending the headers with 200 OK when not sent yet.
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Flush sends the buffered data to the client, when the wrapped writer supports it.
+func (r *responseRecorder) Flush() {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+// recorderOf returns the recorder of a response, wrapping the writer when it is not one yet.
+func recorderOf(w http.ResponseWriter) *responseRecorder {
+	if recorder, ok := w.(*responseRecorder); ok {
+		return recorder
+	}
+	return &responseRecorder{ResponseWriter: w}
+}
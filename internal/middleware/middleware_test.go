@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fileserver/config"
+	"fileserver/internal/logging"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// captureLogs sends the logs to a buffer for the duration of a test, and returns a function decoding the
+// records written so far.
+func captureLogs(t *testing.T) func() []map[string]any {
+	t.Helper()
+	var buffer bytes.Buffer
+	handler, err := logging.NewHandler(&buffer, logging.FormatJSON, slog.LevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(slog.New(handler))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	return func() []map[string]any {
+		var records []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var record map[string]any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatalf("invalid log line %q: %v", line, err)
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name+" in")
+				next.ServeHTTP(w, r)
+				calls = append(calls, name+" out")
+			})
+		}
+	}
+	handler := Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		calls = append(calls, "handler")
+	}), trace("first"), trace("second"), trace("third"))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	want := []string{"first in", "second in", "third in", "handler", "third out", "second out", "first out"}
+	if !slices.Equal(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+	if Chain(handler) == nil {
+		t.Errorf("Chain without middlewares returned nil")
+	}
+}
+
+// TestServerChain checks the global middlewares in the order of the server: the panic of a route is answered
+// with 500, logged with the request ID and recorded by the access log, with the CORS headers.
+func TestServerChain(t *testing.T) {
+	records := captureLogs(t)
+	handler := Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("route failed")
+	}), RequestID, AccessLog, Recover, CORS(&config.CORS{AllowedOrigins: []string{"https://app.example.com"}}))
+
+	r := httptest.NewRequest(http.MethodGet, "/files", nil)
+	r.Header.Set(RequestIDHeader, "trace-42")
+	r.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError || w.Header().Get(RequestIDHeader) != "trace-42" {
+		t.Errorf("response %d with request ID %q, want 500 with trace-42", w.Code, w.Header().Get(RequestIDHeader))
+	}
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the origin of the request", origin)
+	}
+	var messages []string
+	for _, record := range records() {
+		messages = append(messages, record["msg"].(string))
+		if record["request_id"] != "trace-42" {
+			t.Errorf("log %q without the request ID: %v", record["msg"], record)
+		}
+		if record["msg"] == "Request served" && record["status"] != float64(http.StatusInternalServerError) {
+			t.Errorf("access log with status %v, want 500", record["status"])
+		}
+	}
+	if !slices.Equal(messages, []string{"Panic serving request", "Request served"}) {
+		t.Errorf("logs = %v, want the panic then the access log", messages)
+	}
+}
+
+func TestAccessLogRecordsStatusAndSize(t *testing.T) {
+	records := captureLogs(t)
+	handler := AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/files?folder=1", nil))
+
+	logged := records()
+	if len(logged) != 1 {
+		t.Fatalf("logs = %v, want the access log only", logged)
+	}
+	record := logged[0]
+	if record["method"] != http.MethodPost || record["path"] != "/files" ||
+		record["status"] != float64(http.StatusCreated) || record["bytes"] != float64(len("created")) {
+		t.Errorf("access log = %v", record)
+	}
+}
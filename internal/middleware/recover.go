@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recover catches the panics of the handlers: the panic is logged with its stack and the request is
+// answered with 500 Internal Server Error, unless the response was already started. The server keeps
+// serving the other requests. The http.ErrAbortHandler panics, used to abort a response, are let through.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := recorderOf(w)
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+			if err, ok := value.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(value)
+			}
+
+			slog.ErrorContext(r.Context(), "Panic serving request",
+				"method", r.Method, "path", r.URL.Path, "panic", fmt.Sprint(value), "stack", string(debug.Stack()))
+			if recorder.status == 0 {
+				http.Error(recorder, "Internal server error", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecoverAnswersPanics(t *testing.T) {
+	captureLogs(t)
+	handler := Recover(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("nil map")
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusInternalServerError || w.Body.String() != "Internal server error\n" {
+		t.Errorf("response %d %q, want 500 Internal server error", w.Code, w.Body.String())
+	}
+}
+
+func TestRecoverKeepsStartedResponses(t *testing.T) {
+	captureLogs(t)
+	handler := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte("partial"))
+		panic("connection lost")
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusPartialContent || w.Body.String() != "partial" {
+		t.Errorf("response %d %q, want the started 206 response unchanged", w.Code, w.Body.String())
+	}
+}
+
+func TestRecoverLetsAbortThrough(t *testing.T) {
+	captureLogs(t)
+	handler := Recover(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if value := recover(); value != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", value)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	t.Errorf("the abort panic was swallowed")
+}
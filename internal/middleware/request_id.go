@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"fileserver/internal/logging"
+	"github.com/google/uuid"
+	"log/slog"
+	"net/http"
+)
+
+// RequestIDHeader is the header carrying the identifier of a request, from the client or a proxy in front
+// of the server, and back to the client in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the maximum length of a request ID accepted from the client.
+const maxRequestIDLength = 128
+
+// requestIDKey is the key of the request ID in the context of a request.
+type requestIDKey struct{}
+
+// RequestID gives every request an identifier: the X-Request-ID header sent by the client when it is
+// valid, a new UUID otherwise. The identifier is returned in the X-Request-ID header of the response and
+// carried by the context of the request, see RequestIDFrom; the context also carries the attributes of
+// the request added to its logs, starting with the identifier.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := logging.WithRequest(context.WithValue(r.Context(), requestIDKey{}, id), slog.String("request_id", id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFrom returns the identifier of the request carried by ctx, empty when there is none.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID reports whether a request ID sent by the client can be trusted in the logs: not empty,
+// not too long and made of printable ASCII characters without spaces.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"github.com/google/uuid"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveRequestID serves a request with an X-Request-ID header through RequestID, and returns the ID seen by
+// the handler and the one of the response.
+func serveRequestID(header string) (string, string) {
+	seen := ""
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFrom(r.Context())
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if header != "" {
+		r.Header.Set(RequestIDHeader, header)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return seen, w.Header().Get(RequestIDHeader)
+}
+
+func TestRequestIDKeepsValidIDs(t *testing.T) {
+	for _, id := range []string{"trace-42", "0f9c8e1a-6b7d-4c1e-9a3b-2d5e7f8a9b0c", strings.Repeat("a", maxRequestIDLength)} {
+		if seen, returned := serveRequestID(id); seen != id || returned != id {
+			t.Errorf("request ID %q: handler saw %q, response %q", id, seen, returned)
+		}
+	}
+}
+
+func TestRequestIDReplacesInvalidIDs(t *testing.T) {
+	for _, id := range []string{"", "two words", "line\nbreak", "tab\tid", "café", strings.Repeat("a", maxRequestIDLength+1)} {
+		seen, returned := serveRequestID(id)
+		if _, err := uuid.Parse(returned); err != nil || seen != returned {
+			t.Errorf("request ID %q: handler saw %q, response %q; want the same new UUID", id, seen, returned)
+		}
+	}
+
+	// Every request without ID gets its own
+	first, _ := serveRequestID("")
+	second, _ := serveRequestID("")
+	if first == second {
+		t.Errorf("two requests got the same ID %s", first)
+	}
+}
+
+func TestRequestIDFromWithoutRequest(t *testing.T) {
+	if id := RequestIDFrom(httptest.NewRequest(http.MethodGet, "/", nil).Context()); id != "" {
+		t.Errorf("RequestIDFrom outside RequestID = %q, want empty", id)
+	}
+}
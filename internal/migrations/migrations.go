@@ -0,0 +1,246 @@
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"gorm.io/gorm"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// files holds the SQL scripts of the migrations, one directory per database driver. Every migration is a
+// pair of scripts named <version>_<name>.up.sql and <version>_<name>.down.sql.
+//
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// lockID is the key of the Postgres advisory lock taken while migrating, so that several servers starting
+// together do not apply the same migration twice.
+const lockID = 7_402_351_680
+
+// Migration is a versioned change of the database schema.
+type Migration struct {
+	Version int    // Version reached once the migration is applied
+	Name    string // Name of the migration, from its file name
+	Up      string // SQL applying the migration
+	Down    string // SQL reverting the migration
+}
+
+// Status is a migration together with the time it was applied.
+type Status struct {
+	Migration
+	AppliedAt *time.Time // Time the migration was applied, nil if it is pending
+}
+
+// schemaMigration is a row of the schema_migrations table, recording an applied migration.
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"` // Version of the migration
+	Name      string    // Name of the migration
+	AppliedAt time.Time // Time the migration was applied
+}
+
+// TableName overrides the default table name used by GORM.
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Load reads the migrations of a database driver, ordered by version.
+//
+// Parameters:
+// - driver (string): The database driver, "postgres" or "sqlite".
+//
+// Returns:
+// - []Migration: The migrations of the driver.
+// - error: An error is returned if the driver is not supported or a script is missing or misnamed.
+func Load(driver string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, driver)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for database driver %s", driver)
+	}
+
+	// Group the up and down scripts by version
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		prefix, name, found := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || !found || err != nil || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+		content, err := fs.ReadFile(files, path.Join(driver, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %v", entry.Name(), err)
+		}
+
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both the up and the down script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies the pending migrations, in order. Every migration runs in its own transaction together with
+// its record in schema_migrations, so a failure leaves the schema at the previous version.
+//
+// Parameters:
+// - db (*gorm.DB): The database to migrate.
+//
+// Returns:
+// - []Migration: The migrations applied, none if the schema is up to date.
+// - error: An error is returned if a migration fails; the migrations applied before it are kept.
+func Up(db *gorm.DB) ([]Migration, error) {
+	migrations, err := Load(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	if err := createTable(db); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range migrations {
+		done := false
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lock(tx); err != nil {
+				return err
+			}
+			// Another server may have applied it in the meantime
+			var count int64
+			if err := tx.Model(&schemaMigration{}).Where("version = ?", migration.Version).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return nil
+			}
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return err
+			}
+			done = true
+			return tx.Create(&schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return applied, fmt.Errorf("error applying migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+		if done {
+			applied = append(applied, migration)
+		}
+	}
+	return applied, nil
+}
+
+// Down reverts the last applied migrations, the newest first.
+//
+// Parameters:
+// - db (*gorm.DB): The database to migrate.
+// - steps (int): The number of migrations to revert.
+//
+// Returns:
+// - []Migration: The migrations reverted, none if no migration is applied.
+// - error: An error is returned if a migration fails; the migrations reverted before it stay reverted.
+func Down(db *gorm.DB, steps int) ([]Migration, error) {
+	statuses, err := GetStatus(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(statuses) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration := statuses[i].Migration
+		if statuses[i].AppliedAt == nil {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lock(tx); err != nil {
+				return err
+			}
+			if err := tx.Exec(migration.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("error reverting migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+		reverted = append(reverted, migration)
+	}
+	return reverted, nil
+}
+
+// GetStatus returns the migrations of the database driver and whether they are applied.
+//
+// Parameters:
+// - db (*gorm.DB): The database to inspect.
+//
+// Returns:
+// - []Status: The migrations, ordered by version, with the time they were applied.
+// - error: An error is returned if the migrations or the schema_migrations table cannot be read.
+func GetStatus(db *gorm.DB) ([]Status, error) {
+	migrations, err := Load(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	if err := createTable(db); err != nil {
+		return nil, err
+	}
+
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("error reading schema_migrations: %v", err)
+	}
+	appliedAt := make(map[int]time.Time, len(rows))
+	for _, row := range rows {
+		appliedAt[row.Version] = row.AppliedAt
+	}
+
+	statuses := make([]Status, len(migrations))
+	for i, migration := range migrations {
+		statuses[i].Migration = migration
+		if at, ok := appliedAt[migration.Version]; ok {
+			statuses[i].AppliedAt = &at
+		}
+	}
+	return statuses, nil
+}
+
+// createTable creates the schema_migrations table when it does not exist yet.
+func createTable(db *gorm.DB) error {
+	err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations
+(
+    version    BIGINT PRIMARY KEY,
+    name       TEXT      NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+)`).Error
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations: %v", err)
+	}
+	return nil
+}
+
+// lock serializes the migrations of concurrent servers on Postgres, until the end of the transaction.
+// SQLite locks the whole database on the first write, so it needs nothing more.
+func lock(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return tx.Exec("SELECT pg_advisory_xact_lock(?)", lockID).Error
+}
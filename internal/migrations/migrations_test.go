@@ -0,0 +1,260 @@
+package migrations
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// postgresDSNVariable is the environment variable holding the connection string of a PostgreSQL database for
+// the tests; the tests against PostgreSQL are skipped when it is not set.
+const postgresDSNVariable = "FILESERVER_TEST_POSTGRES_DSN"
+
+// openSQLite opens a private in-memory SQLite database, kept until the end of the test.
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", uuid.NewString())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("cannot open the SQLite database: %v", err)
+	}
+	closeOnCleanup(t, db)
+	return db
+}
+
+// openPostgres opens the PostgreSQL database named by postgresDSNVariable, in a new schema dropped at the end
+// of the test.
+func openPostgres(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv(postgresDSNVariable)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNVariable)
+	}
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("cannot connect to PostgreSQL: %v", err)
+	}
+	closeOnCleanup(t, admin)
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("cannot create the schema %s: %v", schema, err)
+	}
+	t.Cleanup(func() {
+		if err := admin.Exec("DROP SCHEMA " + schema + " CASCADE").Error; err != nil {
+			t.Errorf("cannot drop the schema %s: %v", schema, err)
+		}
+	})
+
+	if parsed, err := url.Parse(dsn); err == nil && parsed.Scheme != "" {
+		query := parsed.Query()
+		query.Set("search_path", schema)
+		parsed.RawQuery = query.Encode()
+		dsn = parsed.String()
+	} else {
+		dsn += " search_path=" + schema
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("cannot connect to PostgreSQL: %v", err)
+	}
+	closeOnCleanup(t, db)
+	return db
+}
+
+// closeOnCleanup closes the connections of a database at the end of a test.
+func closeOnCleanup(t *testing.T, db *gorm.DB) {
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+}
+
+// hasFTS5 reports whether the SQLite driver is built with FTS5, needed by the full-text search migration.
+func hasFTS5(t *testing.T, db *gorm.DB) bool {
+	t.Helper()
+	var fts5 bool
+	if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5).Error; err != nil {
+		t.Fatalf("cannot check the SQLite features: %v", err)
+	}
+	return fts5
+}
+
+// appliedVersions returns the versions of the applied migrations, as reported by GetStatus.
+func appliedVersions(t *testing.T, db *gorm.DB) []int {
+	t.Helper()
+	statuses, err := GetStatus(db)
+	if err != nil {
+		t.Fatalf("GetStatus: %v", err)
+	}
+	var versions []int
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			versions = append(versions, status.Version)
+		}
+	}
+	return versions
+}
+
+// versions returns the versions of a list of migrations.
+func versions(migrations []Migration) []int {
+	list := make([]int, len(migrations))
+	for i, migration := range migrations {
+		list[i] = migration.Version
+	}
+	return list
+}
+
+func TestLoadPairsTheScriptsOfBothDrivers(t *testing.T) {
+	postgresMigrations, err := Load("postgres")
+	if err != nil {
+		t.Fatalf("Load(postgres): %v", err)
+	}
+	sqliteMigrations, err := Load("sqlite")
+	if err != nil {
+		t.Fatalf("Load(sqlite): %v", err)
+	}
+	if len(postgresMigrations) != len(sqliteMigrations) {
+		t.Fatalf("%d postgres migrations, %d sqlite migrations", len(postgresMigrations), len(sqliteMigrations))
+	}
+	for i, migration := range postgresMigrations {
+		if migration.Version != i+1 || migration.Up == "" || migration.Down == "" {
+			t.Errorf("migration %d = %d_%s, want version %d with both scripts", i, migration.Version, migration.Name, i+1)
+		}
+		if other := sqliteMigrations[i]; other.Version != migration.Version || other.Name != migration.Name {
+			t.Errorf("migration %d: postgres %d_%s, sqlite %d_%s", i, migration.Version, migration.Name, other.Version, other.Name)
+		}
+	}
+	if _, err := Load("mysql"); err == nil {
+		t.Errorf("Load of an unsupported driver succeeded")
+	}
+}
+
+func TestUpDownUp(t *testing.T) {
+	db := openSQLite(t)
+	if !hasFTS5(t, db) {
+		t.Skip("SQLite is built without FTS5, run the tests with -tags sqlite_fts5")
+	}
+	all, err := Load("sqlite")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	// Step 1: Apply all the migrations, then nothing more
+	applied, err := Up(db)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if !slices.Equal(versions(applied), versions(all)) || !slices.Equal(appliedVersions(t, db), versions(all)) {
+		t.Fatalf("Up applied %v, status %v; want %v", versions(applied), appliedVersions(t, db), versions(all))
+	}
+	if applied, err := Up(db); err != nil || len(applied) != 0 {
+		t.Errorf("Up of an up to date schema = %v, %v; want nothing", versions(applied), err)
+	}
+
+	// Step 2: Revert the last two migrations, then all the others
+	reverted, err := Down(db, 2)
+	if err != nil {
+		t.Fatalf("Down(2): %v", err)
+	}
+	last := len(all)
+	if want := []int{last, last - 1}; !slices.Equal(versions(reverted), want) {
+		t.Errorf("Down(2) reverted %v, want %v", versions(reverted), want)
+	}
+	if want := versions(all[:last-2]); !slices.Equal(appliedVersions(t, db), want) {
+		t.Errorf("status after Down(2) = %v, want %v", appliedVersions(t, db), want)
+	}
+	if reverted, err := Down(db, 100); err != nil || len(reverted) != last-2 {
+		t.Fatalf("Down of all the migrations = %v, %v", versions(reverted), err)
+	}
+	for _, table := range []string{"documents", "document_texts", "api_keys", "acl_entries", "shares"} {
+		if db.Migrator().HasTable(table) {
+			t.Errorf("table %s is still there after reverting all the migrations", table)
+		}
+	}
+	if reverted, err := Down(db, 1); err != nil || len(reverted) != 0 {
+		t.Errorf("Down of an empty schema = %v, %v; want nothing", versions(reverted), err)
+	}
+
+	// Step 3: The down scripts leave a schema the up scripts can create again
+	if applied, err := Up(db); err != nil || !slices.Equal(versions(applied), versions(all)) {
+		t.Fatalf("Up after Down = %v, %v; want %v", versions(applied), err, versions(all))
+	}
+	if !db.Migrator().HasTable("document_texts") || !db.Migrator().HasColumn("uploads", "folder_id") {
+		t.Errorf("the schema is not created again")
+	}
+}
+
+func TestUpKeepsTheMigrationsBeforeAFailure(t *testing.T) {
+	db := openSQLite(t)
+	if hasFTS5(t, db) {
+		t.Skip("SQLite is built with FTS5, the search migration does not fail")
+	}
+
+	// Without FTS5 the search migration fails, the ones before it stay applied
+	applied, err := Up(db)
+	if err == nil || !strings.Contains(err.Error(), "full_text_search") {
+		t.Fatalf("Up without FTS5: %v, want the search migration to fail", err)
+	}
+	if !slices.Equal(versions(applied), []int{1}) || !slices.Equal(appliedVersions(t, db), []int{1}) {
+		t.Errorf("Up applied %v, status %v; want the first migration only", versions(applied), appliedVersions(t, db))
+	}
+	if !db.Migrator().HasTable("documents") || db.Migrator().HasTable("api_keys") {
+		t.Errorf("the schema is not left at the first migration")
+	}
+
+	// The applied migration can be reverted
+	if reverted, err := Down(db, 1); err != nil || !slices.Equal(versions(reverted), []int{1}) {
+		t.Fatalf("Down(1) = %v, %v", versions(reverted), err)
+	}
+	if db.Migrator().HasTable("documents") || len(appliedVersions(t, db)) != 0 {
+		t.Errorf("the first migration is not reverted")
+	}
+}
+
+// TestConcurrentUp checks that servers starting together on PostgreSQL apply every migration once, thanks
+// to the advisory lock.
+func TestConcurrentUp(t *testing.T) {
+	db := openPostgres(t)
+	all, err := Load("postgres")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	const servers = 4
+	var wg sync.WaitGroup
+	applied := make([][]Migration, servers)
+	errs := make([]error, servers)
+	for i := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			applied[i], errs[i] = Up(db)
+		}()
+	}
+	wg.Wait()
+
+	var total []int
+	for i := range servers {
+		if errs[i] != nil {
+			t.Errorf("Up of server %d: %v", i, errs[i])
+		}
+		total = append(total, versions(applied[i])...)
+	}
+	slices.Sort(total)
+	if !slices.Equal(total, versions(all)) {
+		t.Errorf("migrations applied by the servers = %v, want each of %v once", total, versions(all))
+	}
+	if !slices.Equal(appliedVersions(t, db), versions(all)) {
+		t.Errorf("status = %v, want %v", appliedVersions(t, db), versions(all))
+	}
+}
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS document_texts
+(
+    document_id INTEGER PRIMARY KEY REFERENCES documents (id) ON DELETE CASCADE,
+    fingerprint TEXT,
+    content     TEXT                        NOT NULL DEFAULT '',
+    tsv         TSVECTOR                    NOT NULL,
+    indexed_at  TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+);
+
+-- Crea un indice GIN su tsv per la ricerca full-text
+CREATE INDEX IF NOT EXISTS idx_document_texts_tsv ON document_texts USING GIN (tsv);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    id           SERIAL PRIMARY KEY,
+    name         TEXT                        NOT NULL,
+    prefix       TEXT                        NOT NULL,
+    hash         TEXT UNIQUE                 NOT NULL,
+    scopes       TEXT                        NOT NULL,
+    created_at   TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMP WITHOUT TIME ZONE,
+    last_used_at TIMESTAMP WITHOUT TIME ZONE,
+    revoked_at   TIMESTAMP WITHOUT TIME ZONE
+);
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS acl_entries;
+
+DROP INDEX IF EXISTS idx_documents_owner;
+
+ALTER TABLE uploads DROP COLUMN IF EXISTS owner;
+ALTER TABLE folders DROP COLUMN IF EXISTS owner;
+ALTER TABLE documents DROP COLUMN IF EXISTS owner;
@@ -0,0 +1,2 @@
+-- Aggiunge la cartella di destinazione agli upload ripristinabili (NULL per la radice)
+ALTER TABLE uploads ADD COLUMN IF NOT EXISTS folder_id INTEGER REFERENCES folders (id);
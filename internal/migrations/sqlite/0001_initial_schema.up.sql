@@ -0,0 +1,121 @@
+CREATE TABLE IF NOT EXISTS blobs
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    fingerprint TEXT UNIQUE NOT NULL,
+    object_key  TEXT        NOT NULL,
+    size        INTEGER     NOT NULL DEFAULT 0,
+    ref_count   INTEGER     NOT NULL DEFAULT 0,
+    created_at  DATETIME,
+    updated_at  DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS folders
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    name       TEXT NOT NULL,
+    parent_id  INTEGER REFERENCES folders (id),
+    created_at DATETIME,
+    updated_at DATETIME,
+    UNIQUE (name, parent_id)
+);
+
+-- Crea un indice unico sui nomi delle cartelle alla radice (parent_id NULL non è coperto dal vincolo UNIQUE)
+CREATE UNIQUE INDEX IF NOT EXISTS idx_folders_root_name ON folders (name) WHERE parent_id IS NULL;
+
+CREATE TABLE IF NOT EXISTS documents
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    name        TEXT        NOT NULL,
+    id_file     TEXT UNIQUE NOT NULL,
+    object_key  TEXT,
+    fingerprint TEXT        NOT NULL,
+    blob_id     INTEGER REFERENCES blobs (id),
+    status      TEXT        NOT NULL DEFAULT 'available',
+    version     INTEGER     NOT NULL DEFAULT 1,
+    size        INTEGER     NOT NULL DEFAULT 0,
+    mime_type   TEXT,
+    extension   TEXT,
+    uploader    TEXT,
+    description TEXT,
+    metadata    TEXT,
+    folder_id   INTEGER REFERENCES folders (id),
+    created_at  DATETIME,
+    updated_at  DATETIME,
+    deleted_at  DATETIME
+);
+
+-- Crea un indice su deleted_at per il supporto soft delete
+CREATE INDEX IF NOT EXISTS idx_documents_deleted_at ON documents (deleted_at);
+
+-- Crea un indice su fingerprint per la ricerca dei duplicati
+CREATE INDEX IF NOT EXISTS idx_documents_fingerprint ON documents (fingerprint);
+
+-- Crea un indice su blob_id per il conteggio dei riferimenti
+CREATE INDEX IF NOT EXISTS idx_documents_blob_id ON documents (blob_id);
+
+-- Crea un indice su folder_id per la navigazione delle cartelle
+CREATE INDEX IF NOT EXISTS idx_documents_folder_id ON documents (folder_id);
+
+CREATE TABLE IF NOT EXISTS document_versions
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    document_id INTEGER NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    number      INTEGER NOT NULL,
+    object_key  TEXT    NOT NULL,
+    size        INTEGER NOT NULL DEFAULT 0,
+    fingerprint TEXT    NOT NULL,
+    mime_type   TEXT,
+    blob_id     INTEGER REFERENCES blobs (id),
+    created_at  DATETIME,
+    UNIQUE (document_id, number)
+);
+
+-- Crea un indice su blob_id per il conteggio dei riferimenti delle versioni
+CREATE INDEX IF NOT EXISTS idx_document_versions_blob_id ON document_versions (blob_id);
+
+CREATE TABLE IF NOT EXISTS tags
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    name       TEXT UNIQUE NOT NULL,
+    created_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS document_tags
+(
+    document_id INTEGER NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    tag_id      INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (document_id, tag_id)
+);
+
+-- Crea un indice su tag_id per il filtro dei documenti per tag
+CREATE INDEX IF NOT EXISTS idx_document_tags_tag_id ON document_tags (tag_id);
+
+CREATE TABLE IF NOT EXISTS uploads
+(
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    id_upload     TEXT UNIQUE NOT NULL,
+    name          TEXT        NOT NULL,
+    metadata      TEXT,
+    upload_length INTEGER     NOT NULL,
+    upload_offset INTEGER     NOT NULL DEFAULT 0,
+    object_key    TEXT        NOT NULL,
+    multipart_id  TEXT        NOT NULL,
+    tail_key      TEXT,
+    tail_size     INTEGER     NOT NULL DEFAULT 0,
+    duplicates    TEXT,
+    id_file       TEXT,
+    created_at    DATETIME,
+    updated_at    DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS upload_parts
+(
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    upload_id INTEGER NOT NULL REFERENCES uploads (id) ON DELETE CASCADE,
+    number    INTEGER NOT NULL,
+    etag      TEXT    NOT NULL,
+    size      INTEGER NOT NULL
+);
+
+-- Crea un indice sulle parti di ogni upload
+CREATE INDEX IF NOT EXISTS idx_upload_parts_upload_id ON upload_parts (upload_id);
@@ -0,0 +1,10 @@
+-- Crea la tabella virtuale FTS5 per la ricerca full-text sul nome e sul contenuto dei documenti
+-- (richiede SQLite compilato con FTS5, build tag sqlite_fts5)
+CREATE VIRTUAL TABLE IF NOT EXISTS document_texts USING fts5
+(
+    name,
+    content,
+    document_id UNINDEXED,
+    fingerprint UNINDEXED,
+    tokenize = 'unicode61 remove_diacritics 2'
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    name         TEXT        NOT NULL,
+    prefix       TEXT        NOT NULL,
+    hash         TEXT UNIQUE NOT NULL,
+    scopes       TEXT        NOT NULL,
+    created_at   DATETIME,
+    expires_at   DATETIME,
+    last_used_at DATETIME,
+    revoked_at   DATETIME
+);
@@ -0,0 +1,24 @@
+-- Aggiunge il proprietario a documenti, cartelle e upload (vuoto per i contenuti aperti a tutti)
+ALTER TABLE documents ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE folders ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE uploads ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_documents_owner ON documents (owner);
+
+CREATE TABLE IF NOT EXISTS acl_entries
+(
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    document_id    INTEGER REFERENCES documents (id) ON DELETE CASCADE,
+    folder_id      INTEGER REFERENCES folders (id) ON DELETE CASCADE,
+    principal_type TEXT    NOT NULL,
+    principal      TEXT    NOT NULL,
+    can_read       BOOLEAN NOT NULL DEFAULT FALSE,
+    can_write      BOOLEAN NOT NULL DEFAULT FALSE,
+    can_delete     BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at     DATETIME,
+    CHECK ((document_id IS NULL) <> (folder_id IS NULL))
+);
+
+-- Crea gli indici per la ricerca delle voci di un documento o di una cartella
+CREATE INDEX IF NOT EXISTS idx_acl_entries_document_id ON acl_entries (document_id);
+CREATE INDEX IF NOT EXISTS idx_acl_entries_folder_id ON acl_entries (folder_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS share_accesses;
+DROP TABLE IF EXISTS shares;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS shares
+(
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    document_id    INTEGER     NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+    prefix         TEXT        NOT NULL,
+    token_hash     TEXT UNIQUE NOT NULL,
+    password_hash  TEXT        NOT NULL DEFAULT '',
+    created_by     TEXT        NOT NULL DEFAULT '',
+    max_downloads  INTEGER,
+    downloads      INTEGER     NOT NULL DEFAULT 0,
+    created_at     DATETIME,
+    expires_at     DATETIME,
+    last_access_at DATETIME,
+    revoked_at     DATETIME
+);
+
+-- Registro degli accessi ai link condivisi, riusciti o rifiutati
+CREATE TABLE IF NOT EXISTS share_accesses
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    share_id    INTEGER NOT NULL REFERENCES shares (id) ON DELETE CASCADE,
+    outcome     TEXT    NOT NULL,
+    remote_addr TEXT    NOT NULL DEFAULT '',
+    user_agent  TEXT    NOT NULL DEFAULT '',
+    accessed_at DATETIME
+);
+
+-- Crea gli indici per la ricerca delle condivisioni di un documento e degli accessi di una condivisione
+CREATE INDEX IF NOT EXISTS idx_shares_document_id ON shares (document_id);
+CREATE INDEX IF NOT EXISTS idx_share_accesses_share_id ON share_accesses (share_id);
@@ -0,0 +1,3 @@
+-- Aggiunge la cartella di destinazione agli upload ripristinabili (NULL per la radice); senza vincolo di
+-- chiave esterna, che impedirebbe a SQLite di eliminare la colonna nel down
+ALTER TABLE uploads ADD COLUMN folder_id INTEGER;
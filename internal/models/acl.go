@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Kinds of the principals an ACL entry grants permissions to.
+const (
+	PrincipalUser  = "user"  // A single caller, matched on its identity
+	PrincipalGroup = "group" // The callers belonging to a group of the identity provider
+)
+
+// ACLEntry represents the structure of the acl_entries table in the database.
+// An entry grants permissions on a document, or on a folder and everything below it, to a user or a group.
+// Exactly one of DocumentID and FolderID is set.
+type ACLEntry struct {
+	ID            uint      `gorm:"primaryKey"`            // Primary key for the entry
+	DocumentID    *uint     `gorm:"column:document_id"`    // Document the entry applies to
+	FolderID      *uint     `gorm:"column:folder_id"`      // Folder the entry applies to, inherited by its content
+	PrincipalType string    `gorm:"column:principal_type"` // Kind of principal: "user" or "group"
+	Principal     string    `gorm:"column:principal"`      // Identity of the user, or name of the group
+	CanRead       bool      `gorm:"column:can_read"`       // Whether the principal can read the content
+	CanWrite      bool      `gorm:"column:can_write"`      // Whether the principal can change the content
+	CanDelete     bool      `gorm:"column:can_delete"`     // Whether the principal can delete the content
+	CreatedAt     time.Time `gorm:"column:created_at"`     // Timestamp of when the entry was created
+}
+
+// TableName overrides the default table name used by GORM.
+func (ACLEntry) TableName() string {
+	// Returns the name of the table where ACL entries are stored
+	return "acl_entries"
+}
+
+// Grants reports whether the entry grants a permission: ScopeRead, ScopeWrite or ScopeDelete.
+func (e *ACLEntry) Grants(permission string) bool {
+	switch permission {
+	case ScopeRead:
+		return e.CanRead
+	case ScopeWrite:
+		return e.CanWrite
+	case ScopeDelete:
+		return e.CanDelete
+	default:
+		return false
+	}
+}
+
+// Permissions returns the list of the permissions granted by the entry.
+func (e *ACLEntry) Permissions() []string {
+	permissions := make([]string, 0, 3)
+	for _, permission := range []string{ScopeRead, ScopeWrite, ScopeDelete} {
+		if e.Grants(permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
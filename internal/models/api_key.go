@@ -0,0 +1,74 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Permission scopes of the API keys.
+const (
+	ScopeRead   = "read"   // Read the documents, folders and tags
+	ScopeWrite  = "write"  // Upload and edit the documents, folders and tags
+	ScopeDelete = "delete" // Delete the documents and folders
+	ScopeAdmin  = "admin"  // Manage the API keys; implies all the other scopes
+)
+
+// Scopes is a set of permission scopes, stored as a comma separated text column.
+type Scopes []string
+
+// Allows reports whether the scopes grant the given scope, the admin scope granting all of them.
+func (s Scopes) Allows(scope string) bool {
+	return slices.Contains(s, scope) || slices.Contains(s, ScopeAdmin)
+}
+
+// Value encodes the scopes as a comma separated list when they are written to the database.
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, ","), nil
+}
+
+// Scan decodes the comma separated list read from the database.
+func (s *Scopes) Scan(value any) error {
+	var text string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Scopes", value)
+	}
+	*s = nil
+	if text != "" {
+		*s = strings.Split(text, ",")
+	}
+	return nil
+}
+
+// APIKey represents the structure of the api_keys table in the database.
+// Only the SHA-256 hash of a key is stored: the key itself is shown once, when it is created.
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey"`          // Primary key for the key
+	Name       string     `gorm:"column:name"`         // Name describing who or what uses the key
+	Prefix     string     `gorm:"column:prefix"`       // First characters of the key, to recognise it
+	Hash       string     `gorm:"column:hash;unique"`  // Hex encoded SHA-256 hash of the key
+	Scopes     Scopes     `gorm:"column:scopes"`       // Scopes granted to the key
+	CreatedAt  time.Time  `gorm:"column:created_at"`   // Timestamp of when the key was created
+	ExpiresAt  *time.Time `gorm:"column:expires_at"`   // Timestamp after which the key is refused (nil if it never expires)
+	LastUsedAt *time.Time `gorm:"column:last_used_at"` // Timestamp of when the key was last used, to the minute
+	RevokedAt  *time.Time `gorm:"column:revoked_at"`   // Timestamp of when the key was revoked (nil if it is active)
+}
+
+// TableName overrides the default table name used by GORM.
+func (APIKey) TableName() string {
+	// Returns the name of the table where API keys are stored
+	return "api_keys"
+}
+
+// Active reports whether the key can be used at the given time: it is neither revoked nor expired.
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
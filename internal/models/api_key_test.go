@@ -0,0 +1,19 @@
+package models
+
+import "testing"
+
+func TestScopesAllows(t *testing.T) {
+	all := []string{ScopeRead, ScopeWrite, ScopeDelete, ScopeAdmin}
+	for _, scope := range all {
+		if !(Scopes{ScopeAdmin}).Allows(scope) {
+			t.Errorf("the admin scope does not allow %s", scope)
+		}
+	}
+	granted := Scopes{ScopeRead, ScopeWrite}
+	for _, scope := range all {
+		want := scope == ScopeRead || scope == ScopeWrite
+		if granted.Allows(scope) != want {
+			t.Errorf("%v allows %s: %v, want %v", granted, scope, !want, want)
+		}
+	}
+}
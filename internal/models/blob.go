@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Blob represents the structure of the blobs table in the database.
+// A blob is a content stored once in the storage, keyed by its fingerprint, and shared by all the documents
+// with the same content. RefCount tracks how many documents reference it.
+type Blob struct {
+	ID          uint      `gorm:"primaryKey"`                // Primary key for the blob
+	Fingerprint string    `gorm:"column:fingerprint;unique"` // Unique fingerprint (hash) of the content
+	ObjectKey   string    `gorm:"column:object_key"`         // Key of the content in the storage
+	Size        int64     `gorm:"column:size"`               // Size of the content in bytes
+	RefCount    int       `gorm:"column:ref_count"`          // Number of documents referencing the blob
+	CreatedAt   time.Time `gorm:"column:created_at"`         // Timestamp of when the blob was created
+	UpdatedAt   time.Time `gorm:"column:updated_at"`         // Timestamp of when the blob was last updated
+}
+
+// TableName overrides the default table name used by GORM.
+func (Blob) TableName() string {
+	// Returns the name of the table where blobs are stored
+	return "blobs"
+}
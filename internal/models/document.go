@@ -11,12 +11,48 @@ type Document struct {
 	ID          uint           `gorm:"primaryKey"`                      // Primary key for the document
 	Name        string         `gorm:"column:name"`                     // Name of the document
 	IdFile      uuid.UUID      `gorm:"type:uuid;column:id_file;unique"` // Unique identifier for the document's file
-	Fingerprint string         `gorm:"column:fingerprint;unique"`       // Unique fingerprint (hash) for the document
+	ObjectKey   string         `gorm:"column:object_key"`               // Key of the content in the storage, shared by linked duplicates
+	Fingerprint string         `gorm:"column:fingerprint;index"`        // Fingerprint (hash) of the document's content
+	BlobID      *uint          `gorm:"column:blob_id;index"`            // Blob holding the document's content (nil for legacy documents)
+	Status      string         `gorm:"column:status;default:available"` // Status of the document: "available" or "pending"
+	Version     int            `gorm:"column:version;default:1"`        // Number of the current version of the document
+	Size        int64          `gorm:"column:size"`                     // Size of the current content in bytes
+	MimeType    string         `gorm:"column:mime_type"`                // MIME type of the current content
+	Extension   string         `gorm:"column:extension"`                // Extension of the original file name (e.g. ".pdf")
+	Uploader    string         `gorm:"column:uploader"`                 // Who uploaded the document
+	Owner       string         `gorm:"column:owner"`                    // Identity of the owner, empty for the documents open to everyone
+	Description string         `gorm:"column:description"`              // Free text description of the document
+	Metadata    Metadata       `gorm:"column:metadata;type:text"`       // Custom key/values attached to the document
+	FolderID    *uint          `gorm:"column:folder_id;index"`          // Folder containing the document (nil for the root)
+	Tags        []Tag          `gorm:"many2many:document_tags"`         // Tags attached to the document
 	CreatedAt   time.Time      `gorm:"column:created_at"`               // Timestamp of when the document was created
 	UpdatedAt   time.Time      `gorm:"column:updated_at"`               // Timestamp of when the document was last updated
 	DeletedAt   gorm.DeletedAt `gorm:"index;column:deleted_at"`         // Timestamp for soft deletion (if applicable)
 }
 
+// Document statuses.
+const (
+	DocumentAvailable = "available" // The content is stored and the document can be downloaded
+	DocumentPending   = "pending"   // The content is being uploaded directly to the storage by the client
+)
+
+// Key returns the key of the document's content in the storage.
+// Documents uploaded before the object key was recorded are stored under their idFile.
+func (d *Document) Key() string {
+	if d.ObjectKey != "" {
+		return d.ObjectKey
+	}
+	return d.IdFile.String()
+}
+
+// ContentType returns the MIME type of the document's content, application/octet-stream when unknown.
+func (d *Document) ContentType() string {
+	if d.MimeType != "" {
+		return d.MimeType
+	}
+	return "application/octet-stream"
+}
+
 // TableName overrides the default table name used by GORM.
 func (Document) TableName() string {
 	// Returns the name of the table where documents are stored
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// DocumentVersion represents the structure of the document_versions table in the database.
+// Every upload of a document creates a new version; the document itself points to the content of its
+// current version. Each version holds its own reference to the blob of its content.
+type DocumentVersion struct {
+	ID          uint      `gorm:"primaryKey"`                                          // Primary key for the version
+	DocumentID  uint      `gorm:"column:document_id;uniqueIndex:idx_document_version"` // Document the version belongs to
+	Number      int       `gorm:"column:number;uniqueIndex:idx_document_version"`      // Number of the version, starting from 1
+	ObjectKey   string    `gorm:"column:object_key"`                                   // Key of the content in the storage
+	Size        int64     `gorm:"column:size"`                                         // Size of the content in bytes
+	Fingerprint string    `gorm:"column:fingerprint"`                                  // Fingerprint (hash) of the content
+	MimeType    string    `gorm:"column:mime_type"`                                    // MIME type of the content
+	BlobID      *uint     `gorm:"column:blob_id;index"`                                // Blob holding the content (nil for legacy documents)
+	CreatedAt   time.Time `gorm:"column:created_at"`                                   // Timestamp of when the version was created
+}
+
+// TableName overrides the default table name used by GORM.
+func (DocumentVersion) TableName() string {
+	// Returns the name of the table where document versions are stored
+	return "document_versions"
+}
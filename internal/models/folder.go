@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Folder represents the structure of the folders table in the database.
+// Folders form a tree: a folder without parent is at the root. Documents reference their folder.
+type Folder struct {
+	ID        uint      `gorm:"primaryKey"`                                   // Primary key for the folder
+	Name      string    `gorm:"column:name;uniqueIndex:idx_folder_name"`      // Name of the folder, unique among its siblings
+	ParentID  *uint     `gorm:"column:parent_id;uniqueIndex:idx_folder_name"` // Parent folder (nil for the root folders)
+	Owner     string    `gorm:"column:owner"`                                 // Identity of the owner, empty for the folders open to everyone
+	CreatedAt time.Time `gorm:"column:created_at"`                            // Timestamp of when the folder was created
+	UpdatedAt time.Time `gorm:"column:updated_at"`                            // Timestamp of when the folder was last updated
+}
+
+// TableName overrides the default table name used by GORM.
+func (Folder) TableName() string {
+	// Returns the name of the table where folders are stored
+	return "folders"
+}
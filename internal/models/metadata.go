@@ -0,0 +1,43 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Metadata is a map of custom key/values attached to a document, stored as a JSON text column.
+type Metadata map[string]any
+
+// Value encodes the map as JSON when it is written to the database.
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	encoded, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding metadata: %v", err)
+	}
+	return string(encoded), nil
+}
+
+// Scan decodes the JSON read from the database.
+func (m *Metadata) Scan(value any) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot scan %T into Metadata", value)
+	}
+	if len(data) == 0 {
+		*m = nil
+		return nil
+	}
+	return json.Unmarshal(data, m)
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Outcomes of the accesses to a share, as recorded in the share_accesses table.
+const (
+	ShareDownloaded       = "downloaded"        // The whole content was sent
+	ShareInspected        = "inspected"         // The content was not sent in full (HEAD, range or conditional request)
+	SharePasswordRequired = "password_required" // The password was missing or wrong
+	ShareExpired          = "expired"           // The share has expired
+	ShareExhausted        = "exhausted"         // The share reached its maximum number of downloads
+	ShareRevoked          = "revoked"           // The share has been revoked
+)
+
+// Share represents the structure of the shares table in the database.
+// A share is a public link to a document; only the SHA-256 hash of its token is stored, the token itself
+// is shown once, when the share is created.
+type Share struct {
+	ID           uint       `gorm:"primaryKey"`            // Primary key for the share
+	DocumentID   uint       `gorm:"column:document_id"`    // Document shared by the link
+	Prefix       string     `gorm:"column:prefix"`         // First characters of the token, to recognise it
+	TokenHash    string     `gorm:"column:token_hash"`     // Hex encoded SHA-256 hash of the token
+	PasswordHash string     `gorm:"column:password_hash"`  // Bcrypt hash of the password, empty if there is none
+	CreatedBy    string     `gorm:"column:created_by"`     // Identity of the caller who created the share
+	MaxDownloads *int       `gorm:"column:max_downloads"`  // Maximum number of downloads (nil if unlimited)
+	Downloads    int        `gorm:"column:downloads"`      // Number of downloads so far
+	CreatedAt    time.Time  `gorm:"column:created_at"`     // Timestamp of when the share was created
+	ExpiresAt    *time.Time `gorm:"column:expires_at"`     // Timestamp after which the link is refused (nil if it never expires)
+	LastAccessAt *time.Time `gorm:"column:last_access_at"` // Timestamp of the last access to the link
+	RevokedAt    *time.Time `gorm:"column:revoked_at"`     // Timestamp of when the share was revoked (nil if it is active)
+}
+
+// TableName overrides the default table name used by GORM.
+func (Share) TableName() string {
+	// Returns the name of the table where shares are stored
+	return "shares"
+}
+
+// ShareAccess represents the structure of the share_accesses table in the database: an access to a share,
+// successful or not.
+type ShareAccess struct {
+	ID         uint      `gorm:"primaryKey"`         // Primary key for the access
+	ShareID    uint      `gorm:"column:share_id"`    // Share accessed
+	Outcome    string    `gorm:"column:outcome"`     // Outcome of the access, e.g. ShareDownloaded
+	RemoteAddr string    `gorm:"column:remote_addr"` // Address of the client
+	UserAgent  string    `gorm:"column:user_agent"`  // User agent of the client
+	AccessedAt time.Time `gorm:"column:accessed_at"` // Timestamp of the access
+}
+
+// TableName overrides the default table name used by GORM.
+func (ShareAccess) TableName() string {
+	// Returns the name of the table where share accesses are stored
+	return "share_accesses"
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Tag represents the structure of the tags table in the database.
+// Tags are attached to documents through the document_tags join table.
+type Tag struct {
+	ID        uint      `gorm:"primaryKey"`         // Primary key for the tag
+	Name      string    `gorm:"column:name;unique"` // Unique, lower case name of the tag
+	CreatedAt time.Time `gorm:"column:created_at"`  // Timestamp of when the tag was created
+}
+
+// TableName overrides the default table name used by GORM.
+func (Tag) TableName() string {
+	// Returns the name of the table where tags are stored
+	return "tags"
+}
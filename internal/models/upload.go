@@ -0,0 +1,55 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Upload represents the structure of the uploads table in the database.
+// An upload tracks a resumable (tus) upload: its content is stored as the parts of a multipart upload
+// of the storage, plus a tail shorter than the minimum part size that is waiting for more data.
+type Upload struct {
+	ID          uint         `gorm:"primaryKey"`                        // Primary key for the upload
+	IdUpload    uuid.UUID    `gorm:"type:uuid;column:id_upload;unique"` // Unique identifier for the upload, used in its URL
+	Name        string       `gorm:"column:name"`                       // Name of the uploaded file, from the upload metadata
+	Metadata    string       `gorm:"column:metadata"`                   // Raw Upload-Metadata header sent on creation
+	Length      int64        `gorm:"column:upload_length"`              // Total size of the upload in bytes
+	Offset      int64        `gorm:"column:upload_offset"`              // Number of bytes received so far
+	ObjectKey   string       `gorm:"column:object_key"`                 // Storage key of the object being assembled
+	MultipartID string       `gorm:"column:multipart_id"`               // Identifier of the multipart upload in the storage
+	TailKey     string       `gorm:"column:tail_key"`                   // Storage key of the bytes not stored in a part yet
+	TailSize    int64        `gorm:"column:tail_size"`                  // Size of the tail in bytes
+	Duplicates  string       `gorm:"column:duplicates"`                 // Policy for byte-identical content
+	Owner       string       `gorm:"column:owner"`                      // Identity of the caller who started the upload
+	FolderID    *uint        `gorm:"column:folder_id"`                  // Folder of the document created at the end, nil for the root
+	IdFile      *uuid.UUID   `gorm:"type:uuid;column:id_file"`          // Document created when the upload completed
+	Parts       []UploadPart `gorm:"foreignKey:UploadID"`               // Parts stored so far
+	CreatedAt   time.Time    `gorm:"column:created_at"`                 // Timestamp of when the upload was created
+	UpdatedAt   time.Time    `gorm:"column:updated_at"`                 // Timestamp of when the upload was last updated
+}
+
+// TableName overrides the default table name used by GORM.
+func (Upload) TableName() string {
+	// Returns the name of the table where uploads are stored
+	return "uploads"
+}
+
+// Completed reports whether all the bytes of the upload have been received.
+func (u *Upload) Completed() bool {
+	return u.Offset == u.Length
+}
+
+// UploadPart represents the structure of the upload_parts table in the database.
+type UploadPart struct {
+	ID       uint   `gorm:"primaryKey"`       // Primary key for the part
+	UploadID uint   `gorm:"column:upload_id"` // Upload the part belongs to
+	Number   int    `gorm:"column:number"`    // Number of the part in the multipart upload
+	ETag     string `gorm:"column:etag"`      // Entity tag returned by the storage
+	Size     int64  `gorm:"column:size"`      // Size of the part in bytes
+}
+
+// TableName overrides the default table name used by GORM.
+func (UploadPart) TableName() string {
+	// Returns the name of the table where upload parts are stored
+	return "upload_parts"
+}
@@ -0,0 +1,423 @@
+package service
+
+import (
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"fmt"
+	"gorm.io/gorm"
+	"slices"
+	"strings"
+)
+
+// Errors returned by the access control functions.
+var (
+	ErrAccessDenied = errors.New("access denied")
+	ErrInvalidACL   = errors.New("invalid ACL")
+)
+
+// aclColumns maps the permissions of the ACLs to the columns of the acl_entries table.
+var aclColumns = map[string]string{
+	models.ScopeRead:   "can_read",
+	models.ScopeWrite:  "can_write",
+	models.ScopeDelete: "can_delete",
+}
+
+// ACLGrant is a permission grant of an ACL, as read and written by the API.
+type ACLGrant struct {
+	Type        string   `json:"type"`               // Kind of principal: "user" or "group"
+	Principal   string   `json:"principal"`          // Identity of the user, or name of the group
+	Permissions []string `json:"permissions"`        // Permissions granted: "read", "write" and/or "delete"
+	FolderID    *uint    `json:"folderId,omitempty"` // Folder the grant is inherited from, for the inherited grants
+}
+
+// ACL is the access control list of a document or a folder.
+type ACL struct {
+	Owner     string     `json:"owner"`     // Identity of the owner, empty when everyone can access the content
+	Entries   []ACLGrant `json:"entries"`   // Grants set on the document or the folder itself
+	Inherited []ACLGrant `json:"inherited"` // Grants set on the folders containing it
+}
+
+// unrestricted reports whether the ACLs do not apply to a caller: the anonymous caller of a server without
+// authentication, and the administrators.
+func unrestricted(caller *Principal) bool {
+	return caller == nil || caller.Scopes.Allows(models.ScopeAdmin)
+}
+
+// CheckDocumentAccess checks that a caller has a permission on a document. The permission is granted to the
+// owner of the document, to the owners of the folders containing it, and to the users and groups named by
+// the entries of the document or of these folders. Documents without owner are open to everyone, unless
+// one of the folders containing them has an owner: they are then restricted as the content of that folder.
+//
+// Parameters:
+// - caller (*Principal): The authenticated caller, nil when the authentication is disabled.
+// - document (*models.Document): The document to access.
+// - permission (string): The permission needed: models.ScopeRead, models.ScopeWrite or models.ScopeDelete.
+//
+// Returns:
+// - error: ErrAccessDenied if the permission is not granted, or a database error.
+func CheckDocumentAccess(caller *Principal, document *models.Document, permission string) error {
+	if unrestricted(caller) || (document.Owner != "" && document.Owner == caller.Subject) {
+		return nil
+	}
+	return checkGrant(caller, permission, "document_id", document.ID, document.Owner, document.FolderID)
+}
+
+// CheckFolderAccess checks that a caller has a permission on a folder, and so on its content. The permission
+// is granted to the owner of the folder or of one of its ancestors, and to the users and groups named by
+// their entries. The root, and the folders without owner that are not inside a folder with an owner, are
+// open to everyone.
+//
+// Parameters:
+// - caller (*Principal): The authenticated caller, nil when the authentication is disabled.
+// - folderID (*uint): The folder to access, nil for the root.
+// - permission (string): The permission needed: models.ScopeRead, models.ScopeWrite or models.ScopeDelete.
+//
+// Returns:
+// - error: ErrAccessDenied if the permission is not granted, ErrFolderNotFound if the folder does not exist,
+// or a database error.
+func CheckFolderAccess(caller *Principal, folderID *uint, permission string) error {
+	if folderID == nil {
+		return nil
+	}
+	folder, err := GetFolder(*folderID)
+	if err != nil {
+		return err
+	}
+	if unrestricted(caller) || (folder.Owner != "" && folder.Owner == caller.Subject) {
+		return nil
+	}
+	return checkGrant(caller, permission, "folder_id", folder.ID, folder.Owner, folder.ParentID)
+}
+
+// checkGrant looks for the grant of a permission to a caller on a document or a folder (column, id and
+// owner), or on one of the folders above it, starting from parentID. Without any owner, on the target and on
+// the folders above it, the content is open to everyone.
+func checkGrant(caller *Principal, permission, column string, id uint, owner string, parentID *uint) error {
+	// Step 1: Walk up the folders, their owners have all the permissions on the content
+	ancestors, err := folderAncestors(parentID)
+	if err != nil {
+		return err
+	}
+	restricted := owner != ""
+	folderIDs := make([]uint, 0, len(ancestors)+1)
+	for _, folder := range ancestors {
+		if folder.Owner != "" && folder.Owner == caller.Subject {
+			return nil
+		}
+		restricted = restricted || folder.Owner != ""
+		folderIDs = append(folderIDs, folder.ID)
+	}
+	if !restricted {
+		return nil
+	}
+	target := config.DB.Where("folder_id IN ?", append(folderIDs, id))
+	if column == "document_id" {
+		target = config.DB.Where("document_id = ?", id).Or("folder_id IN ?", folderIDs)
+	}
+
+	// Step 2: Look for an entry of the caller granting the permission
+	var count int64
+	query, args := principalCondition(caller)
+	err = config.DB.Model(&models.ACLEntry{}).
+		Where(target).
+		Where(aclColumns[permission]+" = ?", true).
+		Where(query, args...).
+		Count(&count).Error
+	if err != nil {
+		return fmt.Errorf("error while checking access: %v", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: %s permission not granted to %s", ErrAccessDenied, permission, caller.Subject)
+	}
+	return nil
+}
+
+// folderAncestors returns a folder and all the folders above it, from the nearest; none for the root.
+func folderAncestors(folderID *uint) ([]models.Folder, error) {
+	var folders []models.Folder
+	for ancestor := folderID; ancestor != nil; {
+		folder, err := GetFolder(*ancestor)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, *folder)
+		ancestor = folder.ParentID
+	}
+	return folders, nil
+}
+
+// principalCondition returns the condition matching the entries of acl_entries naming a caller or one of
+// its groups.
+func principalCondition(caller *Principal) (string, []any) {
+	return "((acl_entries.principal_type = ? AND acl_entries.principal = ?) OR (acl_entries.principal_type = ? AND acl_entries.principal IN ?))",
+		[]any{models.PrincipalUser, caller.Subject, models.PrincipalGroup, caller.Groups}
+}
+
+// grantedFolders returns the query of the folders a caller can read: the folders it owns or that are
+// readable by one of its entries, and all the folders below them.
+func grantedFolders(caller *Principal) (string, []any) {
+	match, args := principalCondition(caller)
+	query := `WITH RECURSIVE granted(id) AS (
+			SELECT folders.id FROM folders
+			WHERE folders.owner = ?
+				OR EXISTS (SELECT 1 FROM acl_entries WHERE acl_entries.folder_id = folders.id AND acl_entries.can_read = ? AND ` + match + `)
+			UNION
+			SELECT folders.id FROM folders JOIN granted ON folders.parent_id = granted.id
+		)
+		SELECT id FROM granted`
+	return query, append([]any{caller.Subject, true}, args...)
+}
+
+// openFolders returns the query of the folders open to everyone: the folders without owner whose ancestors
+// have no owner either.
+func openFolders() string {
+	return `WITH RECURSIVE open_folders(id) AS (
+			SELECT folders.id FROM folders WHERE folders.parent_id IS NULL AND folders.owner = ''
+			UNION
+			SELECT folders.id FROM folders JOIN open_folders ON folders.parent_id = open_folders.id WHERE folders.owner = ''
+		)
+		SELECT id FROM open_folders`
+}
+
+// readableDocuments returns the condition restricting a query of the documents to the ones a caller can
+// read, see CheckDocumentAccess; empty when the caller can read all of them.
+func readableDocuments(caller *Principal) (string, []any) {
+	if unrestricted(caller) {
+		return "", nil
+	}
+	match, matchArgs := principalCondition(caller)
+	folders, folderArgs := grantedFolders(caller)
+	query := `((documents.owner = '' AND (documents.folder_id IS NULL OR documents.folder_id IN (` + openFolders() + `)))
+		OR documents.owner = ?
+		OR EXISTS (SELECT 1 FROM acl_entries WHERE acl_entries.document_id = documents.id AND acl_entries.can_read = ? AND ` + match + `)
+		OR documents.folder_id IN (` + folders + `))`
+	args := append([]any{caller.Subject, true}, matchArgs...)
+	return query, append(args, folderArgs...)
+}
+
+// visibleDocuments returns a scope restricting a query of the documents to the ones a caller can read.
+func visibleDocuments(caller *Principal) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		query, args := readableDocuments(caller)
+		if query == "" {
+			return db
+		}
+		return db.Where(query, args...)
+	}
+}
+
+// visibleFolders returns a scope restricting a query of the folders to the ones a caller can read.
+func visibleFolders(caller *Principal) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if unrestricted(caller) {
+			return db
+		}
+		folders, args := grantedFolders(caller)
+		return db.Where("(folders.id IN ("+openFolders()+") OR folders.id IN ("+folders+"))", args...)
+	}
+}
+
+// GetDocumentACL returns the owner of a document, the entries set on it and the ones inherited from the
+// folders containing it.
+//
+// Parameters:
+// - document (*models.Document): The document.
+//
+// Returns:
+// - *ACL: The access control list of the document.
+// - error: An error is returned if the entries cannot be read from the database.
+func GetDocumentACL(document *models.Document) (*ACL, error) {
+	return getACL(document.Owner, "document_id", document.ID, document.FolderID)
+}
+
+// GetFolderACL returns the owner of a folder, the entries set on it and the ones inherited from the
+// folders above it.
+//
+// Parameters:
+// - folder (*models.Folder): The folder.
+//
+// Returns:
+// - *ACL: The access control list of the folder.
+// - error: An error is returned if the entries cannot be read from the database.
+func GetFolderACL(folder *models.Folder) (*ACL, error) {
+	return getACL(folder.Owner, "folder_id", folder.ID, folder.ParentID)
+}
+
+// getACL reads the entries of a document or a folder (column and id) and of the folders above it.
+func getACL(owner, column string, id uint, parentID *uint) (*ACL, error) {
+	acl := &ACL{Owner: owner, Entries: make([]ACLGrant, 0), Inherited: make([]ACLGrant, 0)}
+
+	var entries []models.ACLEntry
+	if err := config.DB.Where(column+" = ?", id).Order("id").Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("error while retrieving ACL: %v", err)
+	}
+	for _, entry := range entries {
+		acl.Entries = append(acl.Entries, ACLGrant{Type: entry.PrincipalType, Principal: entry.Principal, Permissions: entry.Permissions()})
+	}
+
+	// The entries of the nearest folders come first
+	ancestors, err := folderAncestors(parentID)
+	if err != nil {
+		return nil, err
+	}
+	for _, folder := range ancestors {
+		var entries []models.ACLEntry
+		if err := config.DB.Where("folder_id = ?", folder.ID).Order("id").Find(&entries).Error; err != nil {
+			return nil, fmt.Errorf("error while retrieving ACL: %v", err)
+		}
+		for _, entry := range entries {
+			acl.Inherited = append(acl.Inherited, ACLGrant{
+				Type:        entry.PrincipalType,
+				Principal:   entry.Principal,
+				Permissions: entry.Permissions(),
+				FolderID:    entry.FolderID,
+			})
+		}
+	}
+	return acl, nil
+}
+
+// SetDocumentACL replaces the entries of a document and optionally changes its owner. Only the owner and
+// the administrators can change the ACL; the ACL of a document without owner is managed by the
+// administrators only, who can give it an owner.
+//
+// Parameters:
+// - caller (*Principal): The authenticated caller, nil when the authentication is disabled.
+// - document (*models.Document): The document. Its owner is updated in place.
+// - owner (*string): The new owner, empty to open the document to everyone; nil to keep the current one.
+// - grants ([]ACLGrant): The new entries of the document, replacing the current ones.
+//
+// Returns:
+// - error: ErrAccessDenied if the caller cannot change the ACL, ErrInvalidACL if a grant is not valid, or a
+// database error.
+func SetDocumentACL(caller *Principal, document *models.Document, owner *string, grants []ACLGrant) error {
+	if err := checkManage(caller, document.Owner); err != nil {
+		return err
+	}
+	if owner != nil {
+		trimmed := strings.TrimSpace(*owner)
+		owner = &trimmed
+	}
+	entries, err := aclEntries(grants)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		entries[i].DocumentID = &document.ID
+	}
+	if err := saveACL(&models.Document{}, "document_id", document.ID, owner, entries); err != nil {
+		return err
+	}
+	if owner != nil {
+		document.Owner = *owner
+	}
+	return nil
+}
+
+// SetFolderACL replaces the entries of a folder and optionally changes its owner. The entries apply to the
+// whole content of the folder. Only the owner and the administrators can change the ACL; the ACL of a folder
+// without owner is managed by the administrators only, who can give it an owner.
+//
+// Parameters:
+// - caller (*Principal): The authenticated caller, nil when the authentication is disabled.
+// - folder (*models.Folder): The folder. Its owner is updated in place.
+// - owner (*string): The new owner, empty to open the folder to everyone; nil to keep the current one.
+// - grants ([]ACLGrant): The new entries of the folder, replacing the current ones.
+//
+// Returns:
+// - error: ErrAccessDenied if the caller cannot change the ACL, ErrInvalidACL if a grant is not valid, or a
+// database error.
+func SetFolderACL(caller *Principal, folder *models.Folder, owner *string, grants []ACLGrant) error {
+	if err := checkManage(caller, folder.Owner); err != nil {
+		return err
+	}
+	if owner != nil {
+		trimmed := strings.TrimSpace(*owner)
+		owner = &trimmed
+	}
+	entries, err := aclEntries(grants)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		entries[i].FolderID = &folder.ID
+	}
+	if err := saveACL(&models.Folder{}, "folder_id", folder.ID, owner, entries); err != nil {
+		return err
+	}
+	if owner != nil {
+		folder.Owner = *owner
+	}
+	return nil
+}
+
+// checkManage checks that a caller can change the ACL of a document or a folder with the given owner.
+func checkManage(caller *Principal, owner string) error {
+	if unrestricted(caller) || (owner != "" && owner == caller.Subject) {
+		return nil
+	}
+	return fmt.Errorf("%w: only the owner can change the ACL", ErrAccessDenied)
+}
+
+// aclEntries validates the grants of an ACL and converts them to entries. The grants to the same principal
+// are merged.
+func aclEntries(grants []ACLGrant) ([]models.ACLEntry, error) {
+	entries := make([]models.ACLEntry, 0, len(grants))
+	for _, grant := range grants {
+		if grant.Type != models.PrincipalUser && grant.Type != models.PrincipalGroup {
+			return nil, fmt.Errorf("%w: type must be %q or %q, got %q", ErrInvalidACL, models.PrincipalUser, models.PrincipalGroup, grant.Type)
+		}
+		principal := strings.TrimSpace(grant.Principal)
+		if principal == "" {
+			return nil, fmt.Errorf("%w: missing principal", ErrInvalidACL)
+		}
+		if len(grant.Permissions) == 0 {
+			return nil, fmt.Errorf("%w: no permissions granted to %s", ErrInvalidACL, principal)
+		}
+
+		i := slices.IndexFunc(entries, func(e models.ACLEntry) bool {
+			return e.PrincipalType == grant.Type && e.Principal == principal
+		})
+		if i < 0 {
+			entries = append(entries, models.ACLEntry{PrincipalType: grant.Type, Principal: principal})
+			i = len(entries) - 1
+		}
+		for _, permission := range grant.Permissions {
+			switch strings.ToLower(strings.TrimSpace(permission)) {
+			case models.ScopeRead:
+				entries[i].CanRead = true
+			case models.ScopeWrite:
+				entries[i].CanWrite = true
+			case models.ScopeDelete:
+				entries[i].CanDelete = true
+			default:
+				return nil, fmt.Errorf("%w: unknown permission %q", ErrInvalidACL, permission)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// saveACL replaces the entries of a document or a folder (column and id) and updates the owner of its row
+// in the table of model, when set.
+func saveACL(model any, column string, id uint, owner *string, entries []models.ACLEntry) error {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if owner != nil {
+			if err := tx.Model(model).Where("id = ?", id).Update("owner", *owner).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where(column+" = ?", id).Delete(&models.ACLEntry{}).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.Create(&entries).Error
+	})
+	if err != nil {
+		return fmt.Errorf("error while saving ACL: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"github.com/google/uuid"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// seedACLs creates the folders and the documents of the access control tests and returns the documents by
+// name. carol owns the "finance" and "shared" folders, readable by the finance group and by bob, and alice
+// owns the "alice" folder; the "open" folder and its content are open to everyone.
+func seedACLs(t *testing.T) map[string]*models.Document {
+	t.Helper()
+	folder := func(name string, parent *models.Folder, owner string, grants ...ACLGrant) *models.Folder {
+		var parentID *uint
+		if parent != nil {
+			parentID = &parent.ID
+		}
+		created, err := CreateFolder(name, parentID, owner)
+		if err != nil {
+			t.Fatalf("CreateFolder(%s): %v", name, err)
+		}
+		if err := SetFolderACL(nil, created, nil, grants); err != nil {
+			t.Fatalf("SetFolderACL(%s): %v", name, err)
+		}
+		return created
+	}
+	open := folder("open", nil, "")
+	openSub := folder("nested", open, "")
+	alice := folder("alice", nil, "alice")
+	aliceSub := folder("drafts", alice, "")
+	finance := folder("finance", nil, "carol", ACLGrant{Type: models.PrincipalGroup, Principal: "finance", Permissions: []string{models.ScopeRead}})
+	shared := folder("shared", nil, "carol", ACLGrant{Type: models.PrincipalUser, Principal: "bob", Permissions: []string{models.ScopeRead}})
+
+	documents := make(map[string]*models.Document)
+	document := func(name string, in *models.Folder, owner string, grants ...ACLGrant) {
+		created := &models.Document{Name: name, IdFile: uuid.New(), Owner: owner}
+		if in != nil {
+			created.FolderID = &in.ID
+		}
+		if err := config.DB.Create(created).Error; err != nil {
+			t.Fatalf("error creating %s: %v", name, err)
+		}
+		if err := SetDocumentACL(nil, created, nil, grants); err != nil {
+			t.Fatalf("SetDocumentACL(%s): %v", name, err)
+		}
+		documents[name] = created
+	}
+	document("public.txt", nil, "")
+	document("open.txt", openSub, "")
+	document("alice.txt", nil, "alice")
+	document("alice-draft.txt", aliceSub, "")
+	document("budget.xlsx", finance, "carol")
+	document("finance-notes.txt", finance, "")
+	document("for-bob.txt", shared, "")
+	document("granted.txt", nil, "carol", ACLGrant{Type: models.PrincipalUser, Principal: "bob", Permissions: []string{models.ScopeRead}})
+	document("write-only.txt", nil, "carol", ACLGrant{Type: models.PrincipalUser, Principal: "bob", Permissions: []string{models.ScopeWrite}})
+	document("group.txt", alice, "alice", ACLGrant{Type: models.PrincipalGroup, Principal: "finance", Permissions: []string{models.ScopeRead}})
+	return documents
+}
+
+func TestDocumentAccessAgreesWithListing(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		documents := seedACLs(t)
+		everyone := []string{"open.txt", "public.txt"}
+		callers := []struct {
+			principal *Principal
+			readable  []string
+		}{
+			{&Principal{Subject: "alice"}, append([]string{"alice-draft.txt", "alice.txt", "group.txt"}, everyone...)},
+			{&Principal{Subject: "bob"}, append([]string{"for-bob.txt", "granted.txt"}, everyone...)},
+			{&Principal{Subject: "dave", Groups: []string{"finance"}}, append([]string{"budget.xlsx", "finance-notes.txt", "group.txt"}, everyone...)},
+			{&Principal{Subject: "carol"}, append([]string{"budget.xlsx", "finance-notes.txt", "for-bob.txt", "granted.txt", "write-only.txt"}, everyone...)},
+			{&Principal{Subject: "eve", Groups: []string{"marketing"}}, everyone},
+			{&Principal{Subject: "root", Scopes: models.Scopes{models.ScopeAdmin}}, nil},
+			{nil, nil},
+		}
+		for _, caller := range callers {
+			name := "anonymous"
+			if caller.principal != nil {
+				name = caller.principal.Subject
+			}
+			want := caller.readable
+			if want == nil {
+				for document := range documents {
+					want = append(want, document)
+				}
+			}
+			slices.Sort(want)
+
+			// The documents listed are the ones CheckDocumentAccess lets the caller read
+			listed, _ := listNames(t, FileQuery{Caller: caller.principal})
+			var checked []string
+			for document, stored := range documents {
+				if err := CheckDocumentAccess(caller.principal, stored, models.ScopeRead); err == nil {
+					checked = append(checked, document)
+				} else if !errors.Is(err, ErrAccessDenied) {
+					t.Fatalf("CheckDocumentAccess(%s, %s): %v", name, document, err)
+				}
+			}
+			slices.Sort(checked)
+			if !slices.Equal(listed, want) {
+				t.Errorf("%s lists %v, want %v", name, listed, want)
+			}
+			if !slices.Equal(checked, want) {
+				t.Errorf("%s can read %v, want %v", name, checked, want)
+			}
+		}
+	})
+}
+
+func TestFolderAccessAgreesWithListing(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		seedACLs(t)
+		var all []models.Folder
+		if err := config.DB.Order("id").Find(&all).Error; err != nil {
+			t.Fatalf("error reading folders: %v", err)
+		}
+		for _, caller := range []*Principal{
+			{Subject: "alice"},
+			{Subject: "bob"},
+			{Subject: "dave", Groups: []string{"finance"}},
+			{Subject: "eve"},
+		} {
+			var visible []models.Folder
+			if err := config.DB.Scopes(visibleFolders(caller)).Order("id").Find(&visible).Error; err != nil {
+				t.Fatalf("error listing folders: %v", err)
+			}
+			for _, folder := range all {
+				listed := slices.ContainsFunc(visible, func(f models.Folder) bool { return f.ID == folder.ID })
+				err := CheckFolderAccess(caller, &folder.ID, models.ScopeRead)
+				if err != nil && !errors.Is(err, ErrAccessDenied) {
+					t.Fatalf("CheckFolderAccess(%s, %s): %v", caller.Subject, folder.Name, err)
+				}
+				if listed != (err == nil) {
+					t.Errorf("%s: folder %s listed %v, readable %v", caller.Subject, folder.Name, listed, err == nil)
+				}
+			}
+		}
+	})
+}
+
+func TestCheckDocumentAccessPermissions(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		documents := seedACLs(t)
+		bob := &Principal{Subject: "bob"}
+		tests := []struct {
+			document   string
+			permission string
+			want       bool
+		}{
+			{"write-only.txt", models.ScopeRead, false},
+			{"write-only.txt", models.ScopeWrite, true},
+			{"write-only.txt", models.ScopeDelete, false},
+			{"granted.txt", models.ScopeWrite, false},
+			{"for-bob.txt", models.ScopeDelete, false},
+			{"public.txt", models.ScopeDelete, true},
+		}
+		for _, test := range tests {
+			err := CheckDocumentAccess(bob, documents[test.document], test.permission)
+			if (err == nil) != test.want {
+				t.Errorf("bob %s on %s: %v, want granted %v", test.permission, test.document, err, test.want)
+			}
+		}
+
+		// The owner of a folder has every permission on its content, whoever owns the documents
+		alice := &Principal{Subject: "alice"}
+		if err := CheckDocumentAccess(alice, documents["alice-draft.txt"], models.ScopeDelete); err != nil {
+			t.Errorf("alice delete on her draft: %v", err)
+		}
+	})
+}
+
+func TestDuplicateRejectNamesExistingDocumentToReaders(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		upload := func(caller *Principal, key string) (*models.Document, error) {
+			ctx := WithPrincipal(context.Background(), caller)
+			staged := StagedFile{Name: key + ".txt", Key: key, Size: 7, MimeType: "text/plain"}
+			if caller != nil {
+				staged.Owner = caller.Subject
+			}
+			staged.Fingerprint = stageContent(t, key, "payroll")
+			document, _, err := CreateDocument(ctx, staged, config.DuplicatesReject)
+			return document, err
+		}
+		carol := &Principal{Subject: "carol"}
+		existing, err := upload(carol, "uploads/original")
+		if err != nil {
+			t.Fatalf("CreateDocument: %v", err)
+		}
+		if err := SetDocumentACL(carol, existing, nil, []ACLGrant{{Type: models.PrincipalUser, Principal: "bob", Permissions: []string{models.ScopeRead}}}); err != nil {
+			t.Fatalf("SetDocumentACL: %v", err)
+		}
+
+		callers := []struct {
+			principal *Principal
+			named     bool
+		}{
+			{carol, true},
+			{&Principal{Subject: "bob"}, true},
+			{&Principal{Subject: "root", Scopes: models.Scopes{models.ScopeAdmin}}, true},
+			{&Principal{Subject: "eve"}, false},
+		}
+		for i, caller := range callers {
+			key := "uploads/duplicate-" + string(rune('a'+i))
+			_, err := upload(caller.principal, key)
+			if !errors.Is(err, ErrDuplicateDocument) {
+				t.Fatalf("%s uploading a duplicate: %v, want ErrDuplicateDocument", caller.principal.Subject, err)
+			}
+			if named := strings.Contains(err.Error(), existing.IdFile.String()); named != caller.named {
+				t.Errorf("%s uploading a duplicate: %q, want the existing document named %v", caller.principal.Subject, err, caller.named)
+			}
+			assertStored(t, key, false)
+		}
+	})
+}
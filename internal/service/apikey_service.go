@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"fmt"
+	"gorm.io/gorm"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Format of the generated API keys: a fixed prefix followed by 32 random bytes, base64url encoded.
+const (
+	apiKeyPrefix      = "fsk_"
+	apiKeyRandomBytes = 32
+	apiKeyShownLength = 12 // Characters of the key kept in clear, to recognise it
+)
+
+// APIKeySubjectPrefix prefixes the identity of the callers authenticated by an API key, followed by the ID of
+// the key (e.g. "apikey:12"): the names of the keys are not unique and would be confused with the users of
+// the identity provider. The tokens and the certificates with a subject using the prefix are refused.
+const APIKeySubjectPrefix = "apikey:"
+
+// bootstrapSubject is the identity of the callers authenticated by the bootstrap key.
+const bootstrapSubject = APIKeySubjectPrefix + "bootstrap"
+
+// lastUsedResolution is how often the last use of a key is written to the database.
+const lastUsedResolution = time.Minute
+
+// Errors returned by the API key services.
+var (
+	ErrInvalidAPIKey  = errors.New("invalid API key")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	ErrInvalidScope   = errors.New("invalid scope")
+)
+
+// allScopes lists the scopes that can be granted to an API key.
+var allScopes = []string{models.ScopeRead, models.ScopeWrite, models.ScopeDelete, models.ScopeAdmin}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject string        // Identity of the caller: "apikey:<id>" for an API key, the subject of its token or of its certificate
+	Roles   []string      // Roles of the caller in the identity provider, none for the API keys
+	Groups  []string      // Groups of the caller in the identity provider or its certificate, matched by the ACLs
+	Scopes  models.Scopes // Scopes granted to the caller
+	KeyID   uint          // API key used by the caller, 0 for the bootstrap key and the bearer tokens
+}
+
+// principalKey is the key of the principal in the context of a request.
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated caller.
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the authenticated caller carried by ctx, nil when the request is anonymous.
+func PrincipalFrom(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// NormalizeScopes checks and lower cases a list of scopes, dropping the duplicates.
+//
+// Parameters:
+// - names ([]string): The scopes as sent by the client.
+//
+// Returns:
+// - models.Scopes: The normalized scopes, in the order of allScopes.
+// - error: ErrInvalidScope if a scope is unknown or the list is empty.
+func NormalizeScopes(names []string) (models.Scopes, error) {
+	var scopes models.Scopes
+	for _, name := range names {
+		scope := strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(allScopes, scope) {
+			return nil, fmt.Errorf("%w %q, it must be one of %s", ErrInvalidScope, name, strings.Join(allScopes, ", "))
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	slices.SortFunc(scopes, func(a, b string) int {
+		return slices.Index(allScopes, a) - slices.Index(allScopes, b)
+	})
+	return scopes, nil
+}
+
+// CreateAPIKey generates a new API key and stores its hash.
+//
+// Parameters:
+// - name (string): The name describing who or what uses the key.
+// - scopes (models.Scopes): The scopes granted to the key, already normalized.
+// - expiresAt (*time.Time): When the key expires, nil if it never expires.
+//
+// Returns:
+// - *models.APIKey: The stored key.
+// - string: The key itself, which cannot be retrieved later.
+// - error: An error is returned if the key cannot be generated or saved.
+func CreateAPIKey(name string, scopes models.Scopes, expiresAt *time.Time) (*models.APIKey, string, error) {
+	// Step 1: Generate the key
+	random := make([]byte, apiKeyRandomBytes)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", fmt.Errorf("error generating API key: %v", err)
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(random)
+
+	// Step 2: Store its hash
+	apiKey := &models.APIKey{
+		Name:      name,
+		Prefix:    key[:apiKeyShownLength],
+		Hash:      hashToken(key),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := config.DB.Create(apiKey).Error; err != nil {
+		return nil, "", fmt.Errorf("error while saving API key: %v", err)
+	}
+	return apiKey, key, nil
+}
+
+// GetAPIKeys retrieves all the API keys, the revoked ones included.
+//
+// Returns:
+// - []models.APIKey: The API keys, ordered by id.
+// - error: An error is returned if the keys cannot be read.
+func GetAPIKeys() ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	if err := config.DB.Order("id").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("error while retrieving API keys: %v", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an API key, which is refused from then on. Revoking a revoked key does nothing.
+//
+// Parameters:
+// - id (uint): The id of the key.
+//
+// Returns:
+// - *models.APIKey: The revoked key.
+// - error: ErrAPIKeyNotFound if there is no such key.
+func RevokeAPIKey(id uint) (*models.APIKey, error) {
+	var apiKey models.APIKey
+	if err := config.DB.First(&apiKey, id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPIKeyNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("error while retrieving API key: %v", err)
+	}
+	if apiKey.RevokedAt != nil {
+		return &apiKey, nil
+	}
+
+	now := time.Now()
+	if err := config.DB.Model(&apiKey).Update("revoked_at", now).Error; err != nil {
+		return nil, fmt.Errorf("error while revoking API key: %v", err)
+	}
+	return &apiKey, nil
+}
+
+// AuthenticateAPIKey finds the caller owning an API key. The bootstrap key of the configuration is
+// accepted with the admin scope, so that the first keys can be created.
+//
+// Parameters:
+// - key (string): The key sent by the client.
+//
+// Returns:
+// - *Principal: The caller owning the key.
+// - error: ErrInvalidAPIKey if the key is unknown, revoked or expired.
+func AuthenticateAPIKey(key string) (*Principal, error) {
+	// Step 1: Check the bootstrap key
+	if bootstrap := config.App.Auth.BootstrapAPIKey(); bootstrap != "" &&
+		subtle.ConstantTimeCompare([]byte(key), []byte(bootstrap)) == 1 {
+		return &Principal{Subject: bootstrapSubject, Scopes: models.Scopes{models.ScopeAdmin}}, nil
+	}
+
+	// Step 2: Look the key up by its hash
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	var apiKey models.APIKey
+	if err := config.DB.Where("hash = ?", hashToken(key)).First(&apiKey).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIKey
+	} else if err != nil {
+		return nil, fmt.Errorf("error while retrieving API key: %v", err)
+	}
+	now := time.Now()
+	if !apiKey.Active(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// Step 3: Record the use, at most once per minute
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= lastUsedResolution {
+		if err := config.DB.Model(&apiKey).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, fmt.Errorf("error while updating API key: %v", err)
+		}
+	}
+	return &Principal{Subject: APIKeySubject(apiKey.ID), Scopes: apiKey.Scopes, KeyID: apiKey.ID}, nil
+}
+
+// APIKeySubject returns the identity of the callers authenticated by an API key, as used by the owners and
+// the ACL entries.
+//
+// Parameters:
+// - id (uint): The identifier of the key.
+//
+// Returns:
+// - string: The identity, e.g. "apikey:12".
+func APIKeySubject(id uint) string {
+	return fmt.Sprintf("%s%d", APIKeySubjectPrefix, id)
+}
+
+// IsAPIKey reports whether a credential looks like an API key rather than a bearer token of the identity
+// provider: a generated key or the bootstrap key.
+func IsAPIKey(credential string) bool {
+	bootstrap := config.App.Auth.BootstrapAPIKey()
+	return strings.HasPrefix(credential, apiKeyPrefix) ||
+		(bootstrap != "" && subtle.ConstantTimeCompare([]byte(credential), []byte(bootstrap)) == 1)
+}
+
+// hashToken returns the hex encoded SHA-256 hash of an API key or a share token. They are long random
+// strings, so a fast hash is enough and lets them be looked up by hash.
+func hashToken(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
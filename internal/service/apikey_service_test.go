@@ -0,0 +1,128 @@
+package service
+
+import (
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useAuth replaces the authentication configuration for the duration of a test.
+func useAuth(t *testing.T, authConfig *config.Auth) {
+	t.Helper()
+	previous := config.App.Auth
+	config.App.Auth = authConfig
+	t.Cleanup(func() { config.App.Auth = previous })
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		useAuth(t, &config.Auth{})
+		apiKey, key, err := CreateAPIKey("backup", models.Scopes{models.ScopeRead}, nil)
+		if err != nil {
+			t.Fatalf("CreateAPIKey: %v", err)
+		}
+		if apiKey.Hash == key || strings.Contains(apiKey.Hash, key) || !strings.HasPrefix(key, apiKey.Prefix) {
+			t.Errorf("stored key %+v for %s, want its hash and prefix only", apiKey, key)
+		}
+
+		principal, err := AuthenticateAPIKey(key)
+		if err != nil {
+			t.Fatalf("AuthenticateAPIKey: %v", err)
+		}
+		if principal.Subject != APIKeySubject(apiKey.ID) || principal.KeyID != apiKey.ID ||
+			!slices.Equal(principal.Scopes, models.Scopes{models.ScopeRead}) {
+			t.Errorf("AuthenticateAPIKey = %+v, want apikey:%d with the read scope", principal, apiKey.ID)
+		}
+		if !IsAPIKey(key) {
+			t.Errorf("IsAPIKey of a generated key is false")
+		}
+
+		// The use is recorded
+		var stored models.APIKey
+		if err := config.DB.First(&stored, apiKey.ID).Error; err != nil {
+			t.Fatalf("error reading the key: %v", err)
+		}
+		if stored.LastUsedAt == nil {
+			t.Errorf("the use of the key is not recorded")
+		}
+
+		// Unknown, altered and revoked keys are refused
+		for _, invalid := range []string{"", "not-a-key", key[:len(key)-1], key + "x"} {
+			if _, err := AuthenticateAPIKey(invalid); !errors.Is(err, ErrInvalidAPIKey) {
+				t.Errorf("AuthenticateAPIKey(%q): %v, want ErrInvalidAPIKey", invalid, err)
+			}
+		}
+		if _, err := RevokeAPIKey(apiKey.ID); err != nil {
+			t.Fatalf("RevokeAPIKey: %v", err)
+		}
+		if _, err := AuthenticateAPIKey(key); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("AuthenticateAPIKey of a revoked key: %v, want ErrInvalidAPIKey", err)
+		}
+		if _, err := RevokeAPIKey(apiKey.ID + 1); !errors.Is(err, ErrAPIKeyNotFound) {
+			t.Errorf("RevokeAPIKey of a missing key: %v, want ErrAPIKeyNotFound", err)
+		}
+	})
+}
+
+func TestAuthenticateAPIKeyRefusesExpiredKeys(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		useAuth(t, &config.Auth{})
+		past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+		_, expired, err := CreateAPIKey("expired", models.Scopes{models.ScopeRead}, &past)
+		if err != nil {
+			t.Fatalf("CreateAPIKey: %v", err)
+		}
+		_, valid, err := CreateAPIKey("valid", models.Scopes{models.ScopeRead}, &future)
+		if err != nil {
+			t.Fatalf("CreateAPIKey: %v", err)
+		}
+		if _, err := AuthenticateAPIKey(expired); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("AuthenticateAPIKey of an expired key: %v, want ErrInvalidAPIKey", err)
+		}
+		if _, err := AuthenticateAPIKey(valid); err != nil {
+			t.Errorf("AuthenticateAPIKey of a key not expired yet: %v", err)
+		}
+	})
+}
+
+func TestAuthenticateBootstrapKey(t *testing.T) {
+	const bootstrap = "bootstrap-key-0123456789"
+	useAuth(t, &config.Auth{BootstrapKey: bootstrap})
+
+	principal, err := AuthenticateAPIKey(bootstrap)
+	if err != nil {
+		t.Fatalf("AuthenticateAPIKey of the bootstrap key: %v", err)
+	}
+	if principal.Subject != "apikey:bootstrap" || principal.KeyID != 0 ||
+		!slices.Equal(principal.Scopes, models.Scopes{models.ScopeAdmin}) {
+		t.Errorf("AuthenticateAPIKey of the bootstrap key = %+v, want apikey:bootstrap with the admin scope", principal)
+	}
+	if !IsAPIKey(bootstrap) || IsAPIKey("eyJhbGciOiJSUzI1NiJ9.e30.c2ln") {
+		t.Errorf("IsAPIKey does not tell the bootstrap key from a token")
+	}
+
+	// Without bootstrap key, an empty key is not accepted as the bootstrap one
+	useAuth(t, &config.Auth{})
+	if _, err := AuthenticateAPIKey(""); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("AuthenticateAPIKey of an empty key: %v, want ErrInvalidAPIKey", err)
+	}
+}
+
+func TestNormalizeScopes(t *testing.T) {
+	scopes, err := NormalizeScopes([]string{" Admin", "read", "READ", "delete"})
+	if err != nil {
+		t.Fatalf("NormalizeScopes: %v", err)
+	}
+	if want := (models.Scopes{models.ScopeRead, models.ScopeDelete, models.ScopeAdmin}); !slices.Equal(scopes, want) {
+		t.Errorf("NormalizeScopes = %v, want %v", scopes, want)
+	}
+	for _, invalid := range [][]string{nil, {}, {"read", "owner"}} {
+		if _, err := NormalizeScopes(invalid); !errors.Is(err, ErrInvalidScope) {
+			t.Errorf("NormalizeScopes(%v): %v, want ErrInvalidScope", invalid, err)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log/slog"
+	"strings"
+)
+
+// blobKeyPrefix is the prefix of the storage keys of the content-addressed blobs.
+const blobKeyPrefix = "blobs/"
+
+// BlobKey returns the storage key of the blob with the given fingerprint.
+// A fingerprint "sha256:abcd..." is stored under "blobs/sha256/abcd...".
+//
+// Parameters:
+// - fingerprint (string): The fingerprint of the content, in the "<algorithm>:<hash>" form.
+//
+// Returns:
+// - string: The storage key of the blob.
+func BlobKey(fingerprint string) string {
+	return blobKeyPrefix + strings.Replace(fingerprint, ":", "/", 1)
+}
+
+// GetBlobByFingerprint retrieves a blob from the database based on the fingerprint of its content.
+//
+// Parameters:
+// - fingerprint (string): The fingerprint of the content.
+//
+// Returns:
+// - *models.Blob: A pointer to the blob if found.
+// - error: An error if the blob is not found or if there is a failure during the query.
+func GetBlobByFingerprint(fingerprint string) (*models.Blob, error) {
+	var blob models.Blob
+
+	// Perform the query to find the blob by its unique fingerprint
+	if err := config.DB.Where("fingerprint = ?", fingerprint).First(&blob).Error; err != nil {
+		// If no record is found, return a descriptive error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("blob with fingerprint %v not found", fingerprint)
+		}
+		// If there is another error during retrieval, return the error
+		return nil, fmt.Errorf("error while retrieving blob: %v", err)
+	}
+
+	// Return the blob if found
+	return &blob, nil
+}
+
+// AcquireBlob takes a reference to the blob of a content that has just been uploaded to a staging key.
+// If a blob with the same fingerprint already exists its reference count is incremented, otherwise the staged
+// object is copied under its content-addressed key and a new blob is created. The staged object is removed
+// in both cases.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - stagingKey (string): The storage key where the content has been uploaded.
+// - fingerprint (string): The fingerprint of the content.
+// - size (int64): The size of the content in bytes.
+//
+// Returns:
+// - *models.Blob: The blob referencing the content.
+// - error: An error is returned if the blob cannot be created or referenced.
+func AcquireBlob(ctx context.Context, stagingKey, fingerprint string, size int64) (*models.Blob, error) {
+	// The staged object is never needed once the blob has been resolved
+	defer func() {
+		if err := config.Store.Delete(ctx, stagingKey); err != nil {
+			slog.WarnContext(ctx, "Error removing staged object", "key", stagingKey, "error", err)
+		}
+	}()
+
+	// Reference the existing blob, unless it is being released right now (reference count at zero)
+	if blob, err := GetBlobByFingerprint(fingerprint); err == nil {
+		result := config.DB.Model(&models.Blob{}).
+			Where("id = ? AND ref_count > 0", blob.ID).
+			Update("ref_count", gorm.Expr("ref_count + 1"))
+		if result.Error != nil {
+			return nil, fmt.Errorf("error while referencing blob: %v", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			blob.RefCount++
+			return blob, nil
+		}
+	}
+
+	// Move the content under its content-addressed key
+	key := BlobKey(fingerprint)
+	if _, err := config.Store.Copy(ctx, stagingKey, key); err != nil {
+		return nil, fmt.Errorf("error while storing blob: %v", err)
+	}
+
+	// Create the blob, or reference it if a concurrent upload of the same content created it meanwhile
+	blob := &models.Blob{Fingerprint: fingerprint, ObjectKey: key, Size: size, RefCount: 1}
+	err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "fingerprint"}},
+		DoUpdates: clause.Assignments(map[string]any{"ref_count": gorm.Expr("blobs.ref_count + 1")}),
+	}).Create(blob).Error
+	if err != nil {
+		return nil, fmt.Errorf("error while adding blob: %v", err)
+	}
+	return GetBlobByFingerprint(fingerprint)
+}
+
+// ReferenceBlob adds a reference to a blob that is already referenced, e.g. when a version is restored.
+//
+// Parameters:
+// - blobID (uint): The identifier of the blob to reference.
+//
+// Returns:
+// - error: An error is returned if the blob does not exist anymore or cannot be updated.
+func ReferenceBlob(blobID uint) error {
+	result := config.DB.Model(&models.Blob{}).
+		Where("id = ? AND ref_count > 0", blobID).
+		Update("ref_count", gorm.Expr("ref_count + 1"))
+	if result.Error != nil {
+		return fmt.Errorf("error while referencing blob: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("blob %d not found", blobID)
+	}
+	return nil
+}
+
+// ReleaseBlob drops a reference to a blob. When the last reference is dropped the blob is removed from the
+// database and its content is deleted from the storage.
+// The blob is locked until its content is deleted, so that a concurrent AcquireBlob of the same content waits
+// and then stores the content again, instead of referencing a content that is about to disappear.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - blobID (uint): The identifier of the blob to release.
+//
+// Returns:
+// - error: An error is returned if the blob cannot be released.
+func ReleaseBlob(ctx context.Context, blobID uint) error {
+	var blob models.Blob
+	var deleteErr error
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Drop the reference first: the update locks the row on PostgreSQL, and the whole database on
+		// SQLite, until the end of the transaction
+		result := tx.Model(&models.Blob{}).
+			Where("id = ? AND ref_count > 0", blobID).
+			Update("ref_count", gorm.Expr("ref_count - 1"))
+		if result.Error != nil {
+			return fmt.Errorf("error while releasing blob: %v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("blob %d not found", blobID)
+		}
+		if err := tx.First(&blob, blobID).Error; err != nil {
+			return fmt.Errorf("error while retrieving blob: %v", err)
+		}
+		if blob.RefCount > 0 {
+			return nil
+		}
+
+		// Remove the blob and its content while the row is still locked. A failure to delete the content
+		// only leaves an orphaned object, the blob is removed anyway.
+		if err := tx.Delete(&blob).Error; err != nil {
+			return fmt.Errorf("error while deleting blob: %v", err)
+		}
+		deleteErr = config.Store.Delete(ctx, blob.ObjectKey)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if blob.RefCount > 0 {
+		return nil
+	}
+	if deleteErr != nil {
+		return fmt.Errorf("error while deleting blob content: %v", deleteErr)
+	}
+	slog.InfoContext(ctx, "Blob deleted", "fingerprint", blob.Fingerprint)
+	return nil
+}
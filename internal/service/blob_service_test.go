@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/storage"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// stageContent uploads content to a staging key and returns its fingerprint, as the upload handlers do.
+func stageContent(t *testing.T, key, content string) string {
+	t.Helper()
+	if _, err := config.Store.Put(context.Background(), key, strings.NewReader(content), int64(len(content)), ""); err != nil {
+		t.Fatalf("error staging %s: %v", key, err)
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+}
+
+// assertStored checks whether an object exists in the storage.
+func assertStored(t *testing.T, key string, want bool) {
+	t.Helper()
+	_, err := config.Store.Stat(context.Background(), key)
+	switch {
+	case want && err != nil:
+		t.Errorf("object %s is missing: %v", key, err)
+	case !want && !errors.Is(err, storage.ErrNotFound):
+		t.Errorf("object %s is still stored (%v)", key, err)
+	}
+}
+
+func TestAcquireBlobStoresContentOnce(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		ctx := context.Background()
+		fingerprint := stageContent(t, "uploads/first", "same content")
+		first, err := AcquireBlob(ctx, "uploads/first", fingerprint, 12)
+		if err != nil {
+			t.Fatalf("AcquireBlob: %v", err)
+		}
+		if first.RefCount != 1 || first.ObjectKey != BlobKey(fingerprint) || first.Size != 12 {
+			t.Errorf("first AcquireBlob = %+v", first)
+		}
+
+		// The same content uploaded again references the same blob
+		stageContent(t, "uploads/second", "same content")
+		second, err := AcquireBlob(ctx, "uploads/second", fingerprint, 12)
+		if err != nil {
+			t.Fatalf("AcquireBlob: %v", err)
+		}
+		if second.ID != first.ID || second.RefCount != 2 {
+			t.Errorf("second AcquireBlob = %+v, want blob %d with 2 references", second, first.ID)
+		}
+
+		// The staged objects are consumed, the content is stored once under its fingerprint
+		assertStored(t, "uploads/first", false)
+		assertStored(t, "uploads/second", false)
+		assertStored(t, BlobKey(fingerprint), true)
+		objects, err := config.Store.List(ctx, "blobs/")
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if len(objects) != 1 {
+			t.Errorf("%d blobs stored, want 1", len(objects))
+		}
+	})
+}
+
+func TestReleaseBlobDeletesContentWithLastReference(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		ctx := context.Background()
+		fingerprint := stageContent(t, "uploads/a", "shared")
+		blob, err := AcquireBlob(ctx, "uploads/a", fingerprint, 6)
+		if err != nil {
+			t.Fatalf("AcquireBlob: %v", err)
+		}
+		if err := ReferenceBlob(blob.ID); err != nil {
+			t.Fatalf("ReferenceBlob: %v", err)
+		}
+
+		// Releasing one of the two references keeps the content
+		if err := ReleaseBlob(ctx, blob.ID); err != nil {
+			t.Fatalf("ReleaseBlob: %v", err)
+		}
+		current, err := GetBlobByFingerprint(fingerprint)
+		if err != nil {
+			t.Fatalf("GetBlobByFingerprint: %v", err)
+		}
+		if current.RefCount != 1 {
+			t.Errorf("reference count = %d, want 1", current.RefCount)
+		}
+		assertStored(t, blob.ObjectKey, true)
+
+		// Releasing the last one deletes the blob and its content
+		if err := ReleaseBlob(ctx, blob.ID); err != nil {
+			t.Fatalf("ReleaseBlob: %v", err)
+		}
+		if _, err := GetBlobByFingerprint(fingerprint); err == nil {
+			t.Errorf("the blob still exists after its last release")
+		}
+		assertStored(t, blob.ObjectKey, false)
+
+		// A released blob can be neither released nor referenced again
+		if err := ReleaseBlob(ctx, blob.ID); err == nil {
+			t.Errorf("ReleaseBlob of a deleted blob succeeded")
+		}
+		if err := ReferenceBlob(blob.ID); err == nil {
+			t.Errorf("ReferenceBlob of a deleted blob succeeded")
+		}
+	})
+}
+
+func TestAcquireBlobStoresReleasedContentAgain(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		ctx := context.Background()
+		fingerprint := stageContent(t, "uploads/a", "comes back")
+		blob, err := AcquireBlob(ctx, "uploads/a", fingerprint, 10)
+		if err != nil {
+			t.Fatalf("AcquireBlob: %v", err)
+		}
+		if err := ReleaseBlob(ctx, blob.ID); err != nil {
+			t.Fatalf("ReleaseBlob: %v", err)
+		}
+
+		// The content uploaded after its blob was deleted is stored again, with a new blob
+		stageContent(t, "uploads/b", "comes back")
+		again, err := AcquireBlob(ctx, "uploads/b", fingerprint, 10)
+		if err != nil {
+			t.Fatalf("AcquireBlob: %v", err)
+		}
+		if again.ID == blob.ID || again.RefCount != 1 {
+			t.Errorf("AcquireBlob after release = %+v, want a new blob with 1 reference", again)
+		}
+		assertStored(t, again.ObjectKey, true)
+	})
+}
+
+func TestCreateDocumentSharesBlobOfDuplicates(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		ctx := context.Background()
+		create := func(key, duplicates string) (*StagedFile, error) {
+			staged := &StagedFile{Name: key + ".txt", Key: key, Size: 9, MimeType: "text/plain"}
+			staged.Fingerprint = stageContent(t, key, "duplicate")
+			_, _, err := CreateDocument(ctx, *staged, duplicates)
+			return staged, err
+		}
+		staged, err := create("uploads/original", config.DuplicatesReject)
+		if err != nil {
+			t.Fatalf("CreateDocument: %v", err)
+		}
+
+		// A rejected duplicate takes no reference and leaves no staged object
+		if _, err := create("uploads/rejected", config.DuplicatesReject); !errors.Is(err, ErrDuplicateDocument) {
+			t.Fatalf("CreateDocument of a duplicate: %v, want ErrDuplicateDocument", err)
+		}
+		assertStored(t, "uploads/rejected", false)
+
+		// A linked duplicate shares the blob
+		if _, err := create("uploads/linked", config.DuplicatesLink); err != nil {
+			t.Fatalf("CreateDocument of a linked duplicate: %v", err)
+		}
+		blob, err := GetBlobByFingerprint(staged.Fingerprint)
+		if err != nil {
+			t.Fatalf("GetBlobByFingerprint: %v", err)
+		}
+		if blob.RefCount != 2 {
+			t.Errorf("reference count = %d, want 2", blob.RefCount)
+		}
+	})
+}
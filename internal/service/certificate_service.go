@@ -0,0 +1,53 @@
+package service
+
+import (
+	"crypto/x509"
+	"errors"
+	"fileserver/config"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidCertificate is returned when a client certificate does not name the client.
+var ErrInvalidCertificate = errors.New("invalid client certificate")
+
+// anyCertificate is the key of the client scopes granted to every client certificate.
+const anyCertificate = "*"
+
+// AuthenticateCertificate maps a client certificate, already verified by the TLS handshake, to the caller:
+// the common name of the subject (or the whole distinguished name) is the identity, the organizational
+// units are the groups matched by the ACLs, and clientScopes gives the scopes.
+//
+// Parameters:
+// - certificate (*x509.Certificate): The leaf certificate sent by the client.
+//
+// Returns:
+// - *Principal: The caller the certificate was issued to.
+// - error: ErrInvalidCertificate if client certificates are not configured or the subject is empty.
+func AuthenticateCertificate(certificate *x509.Certificate) (*Principal, error) {
+	if config.App.Server == nil || config.App.Server.TLS == nil {
+		return nil, fmt.Errorf("%w: client certificates are not configured", ErrInvalidCertificate)
+	}
+	tlsConfig := config.App.Server.TLS
+
+	// Step 1: Take the identity from the subject
+	subject := certificate.Subject.CommonName
+	if tlsConfig.ClientIdentity() == config.ClientSubjectDN {
+		subject = certificate.Subject.String()
+	}
+	if subject == "" {
+		return nil, fmt.Errorf("%w: the subject has no %s", ErrInvalidCertificate, tlsConfig.ClientIdentity())
+	}
+	if strings.HasPrefix(subject, APIKeySubjectPrefix) {
+		return nil, fmt.Errorf("%w: the subject %q is reserved to the API keys", ErrInvalidCertificate, subject)
+	}
+
+	// Step 2: Grant the scopes of the identity and the ones of every certificate
+	granted := slices.Concat(tlsConfig.ClientScopes[subject], tlsConfig.ClientScopes[anyCertificate])
+	return &Principal{
+		Subject: subject,
+		Groups:  certificate.Subject.OrganizationalUnit,
+		Scopes:  roleScopes(granted, nil),
+	}, nil
+}
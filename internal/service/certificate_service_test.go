@@ -0,0 +1,84 @@
+package service
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"slices"
+	"testing"
+)
+
+// useClientCertificates replaces the configuration of the client certificates for the duration of a test.
+func useClientCertificates(t *testing.T, tlsConfig *config.TLS) {
+	t.Helper()
+	previous := config.App.Server
+	config.App.Server = &config.Server{TLS: tlsConfig}
+	t.Cleanup(func() { config.App.Server = previous })
+}
+
+func TestAuthenticateCertificate(t *testing.T) {
+	indexer := &x509.Certificate{Subject: pkix.Name{
+		CommonName:         "indexer",
+		OrganizationalUnit: []string{"batch", "ops"},
+		Organization:       []string{"Acme"},
+	}}
+	scopes := map[string][]string{
+		"indexer":                           {models.ScopeRead},
+		"CN=indexer,OU=batch+OU=ops,O=Acme": {models.ScopeWrite},
+		"*":                                 {models.ScopeRead, "unknown"},
+	}
+
+	// The common name identifies the client, the organizational units are its groups
+	useClientCertificates(t, &config.TLS{ClientScopes: scopes})
+	principal, err := AuthenticateCertificate(indexer)
+	if err != nil {
+		t.Fatalf("AuthenticateCertificate: %v", err)
+	}
+	if principal.Subject != "indexer" || !slices.Equal(principal.Groups, []string{"batch", "ops"}) ||
+		!slices.Equal(principal.Scopes, models.Scopes{models.ScopeRead}) {
+		t.Errorf("AuthenticateCertificate = %+v, want indexer in batch and ops with the read scope", principal)
+	}
+
+	// With the distinguished name, the scopes follow the whole subject
+	useClientCertificates(t, &config.TLS{ClientSubject: config.ClientSubjectDN, ClientScopes: scopes})
+	principal, err = AuthenticateCertificate(indexer)
+	if err != nil {
+		t.Fatalf("AuthenticateCertificate: %v", err)
+	}
+	if principal.Subject != "CN=indexer,OU=batch+OU=ops,O=Acme" ||
+		!slices.Equal(principal.Scopes, models.Scopes{models.ScopeRead, models.ScopeWrite}) {
+		t.Errorf("AuthenticateCertificate by DN = %+v, want the read and write scopes", principal)
+	}
+
+	// Any other certificate only gets the scopes of "*"
+	other := &x509.Certificate{Subject: pkix.Name{CommonName: "backup"}}
+	useClientCertificates(t, &config.TLS{ClientScopes: map[string][]string{"indexer": {models.ScopeAdmin}}})
+	if principal, err := AuthenticateCertificate(other); err != nil || len(principal.Scopes) != 0 {
+		t.Errorf("AuthenticateCertificate of an unknown client = %+v, %v; want no scope", principal, err)
+	}
+}
+
+func TestAuthenticateCertificateRejectsInvalidSubjects(t *testing.T) {
+	useClientCertificates(t, &config.TLS{})
+	for _, subject := range []pkix.Name{
+		{},
+		{OrganizationalUnit: []string{"ops"}},
+		{CommonName: "apikey:1"},
+		{CommonName: "apikey:bootstrap"},
+	} {
+		certificate := &x509.Certificate{Subject: subject}
+		if _, err := AuthenticateCertificate(certificate); !errors.Is(err, ErrInvalidCertificate) {
+			t.Errorf("AuthenticateCertificate of %q: %v, want ErrInvalidCertificate", subject.String(), err)
+		}
+	}
+
+	// Without TLS configuration no certificate is accepted
+	previous := config.App.Server
+	config.App.Server = nil
+	defer func() { config.App.Server = previous }()
+	if _, err := AuthenticateCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "indexer"}}); !errors.Is(err, ErrInvalidCertificate) {
+		t.Errorf("AuthenticateCertificate without TLS: %v, want ErrInvalidCertificate", err)
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fileserver/internal/models"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded or does not match the sort.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Sort keys of the document lists, mapped to their columns.
+var sortColumns = map[string]string{
+	"name":      "name",
+	"createdAt": "created_at",
+	"updatedAt": "updated_at",
+	"size":      "size",
+}
+
+// Cursor is a position in a sorted list of documents: the sort key and the id of a document. Pages are read
+// after the position, or before it when going backward. It is sent to the clients as an opaque string.
+type Cursor struct {
+	Sort       string `json:"s"` // Sort key of the list
+	Descending bool   `json:"d"` // Whether the list is sorted in descending order
+	Value      string `json:"v"` // Value of the sort key of the document
+	ID         uint   `json:"i"` // Identifier of the document, to break ties
+	Backward   bool   `json:"b"` // Whether the page is the one before the position
+}
+
+// ParseCursor decodes a cursor returned by a previous page.
+//
+// Parameters:
+// - value (string): The encoded cursor.
+//
+// Returns:
+// - *Cursor: The decoded cursor.
+// - error: ErrInvalidCursor if the value is not a cursor.
+func ParseCursor(value string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if _, ok := sortColumns[cursor.Sort]; !ok {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// String encodes the cursor as an opaque, URL safe string.
+func (c *Cursor) String() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// cursorAt returns the cursor at the position of a document in a list.
+func cursorAt(document *models.Document, sort string, descending, backward bool) *Cursor {
+	var value string
+	switch sort {
+	case "name":
+		value = document.Name
+	case "createdAt":
+		value = document.CreatedAt.Format(time.RFC3339Nano)
+	case "updatedAt":
+		value = document.UpdatedAt.Format(time.RFC3339Nano)
+	case "size":
+		value = strconv.FormatInt(document.Size, 10)
+	}
+	return &Cursor{Sort: sort, Descending: descending, Value: value, ID: document.ID, Backward: backward}
+}
+
+// sortValue converts the value of the cursor to the type of its sort key, for the queries.
+func (c *Cursor) sortValue() (any, error) {
+	switch c.Sort {
+	case "createdAt", "updatedAt":
+		value, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+		return currentDialect().timeValue(value), nil
+	case "size":
+		value, err := strconv.ParseInt(c.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+		}
+		return value, nil
+	default:
+		return c.Value, nil
+	}
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"fileserver/config"
+	"fileserver/internal/migrations"
+	"fileserver/internal/storage"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// postgresDSNVariable is the environment variable holding the connection string of a PostgreSQL database for
+// the tests, e.g. "host=localhost user=postgres password=postgres dbname=postgres sslmode=disable". Every test
+// works in its own schema, dropped at the end. The tests against PostgreSQL are skipped when it is not set.
+const postgresDSNVariable = "FILESERVER_TEST_POSTGRES_DSN"
+
+// searchMigration is the name of the migration creating the full-text search table.
+const searchMigration = "full_text_search"
+
+// forEachDatabase runs a test once for every supported database driver, each time on an empty database
+// brought up to date by the migrations and on an empty in-memory storage.
+func forEachDatabase(t *testing.T, test func(t *testing.T)) {
+	t.Helper()
+	for _, driver := range []string{"sqlite", "postgres"} {
+		t.Run(driver, func(t *testing.T) {
+			useDatabase(t, driver)
+			test(t)
+		})
+	}
+}
+
+// useDatabase replaces config.DB and config.Store for the duration of a test.
+func useDatabase(t *testing.T, driver string) {
+	t.Helper()
+	var db *gorm.DB
+	switch driver {
+	case "sqlite":
+		db = openSQLite(t)
+	case "postgres":
+		db = openPostgres(t)
+	default:
+		t.Fatalf("database driver %s is not supported", driver)
+	}
+	if driver == "sqlite" && !hasFTS5(t, db) {
+		migrateWithoutSearch(t, db)
+	} else if _, err := migrations.Up(db); err != nil {
+		t.Fatalf("error migrating the %s database: %v", driver, err)
+	}
+
+	// The search index is chosen once for the database in use, choose it again for this one
+	previousDB, previousStore := config.DB, config.Store
+	config.DB, config.Store = db, storage.NewMemory()
+	indexOnce, index, indexErr = sync.Once{}, nil, nil
+	t.Cleanup(func() {
+		config.DB, config.Store = previousDB, previousStore
+		indexOnce, index, indexErr = sync.Once{}, nil, nil
+	})
+}
+
+// hasFTS5 reports whether the SQLite driver is built with FTS5, which it compiles in only with the
+// sqlite_fts5 build tag.
+func hasFTS5(t *testing.T, db *gorm.DB) bool {
+	t.Helper()
+	var fts5 bool
+	if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5).Error; err != nil {
+		t.Fatalf("cannot check the SQLite features: %v", err)
+	}
+	return fts5
+}
+
+// migrateWithoutSearch applies the SQLite migrations but the one creating the FTS5 search table, so that
+// the tests run without the sqlite_fts5 build tag too. The tests using the search index call requireSearch.
+func migrateWithoutSearch(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	all, err := migrations.Load("sqlite")
+	if err != nil {
+		t.Fatalf("cannot load the SQLite migrations: %v", err)
+	}
+	for _, migration := range all {
+		if migration.Name == searchMigration {
+			continue
+		}
+		if err := db.Exec(migration.Up).Error; err != nil {
+			t.Fatalf("error applying migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+	}
+}
+
+// requireSearch skips a test when the database has no search index, i.e. on SQLite without FTS5.
+func requireSearch(t *testing.T) {
+	t.Helper()
+	if config.DB.Dialector.Name() == "sqlite" && !hasFTS5(t, config.DB) {
+		t.Skip("SQLite is built without FTS5, run the tests with -tags sqlite_fts5")
+	}
+}
+
+// openSQLite opens a private in-memory SQLite database, kept until the end of the test.
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	// The cache is shared so that all the connections of the pool see the same database
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", uuid.NewString())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("cannot open the SQLite database: %v", err)
+	}
+	closeOnCleanup(t, db)
+	return db
+}
+
+// openPostgres opens the PostgreSQL database named by postgresDSNVariable, in a new schema dropped at the end
+// of the test.
+func openPostgres(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv(postgresDSNVariable)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNVariable)
+	}
+
+	// Create the schema of the test
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("cannot connect to PostgreSQL: %v", err)
+	}
+	closeOnCleanup(t, admin)
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("cannot create the schema %s: %v", schema, err)
+	}
+	t.Cleanup(func() {
+		if err := admin.Exec("DROP SCHEMA " + schema + " CASCADE").Error; err != nil {
+			t.Errorf("cannot drop the schema %s: %v", schema, err)
+		}
+	})
+
+	// Connect again, working in the schema of the test
+	if parsed, err := url.Parse(dsn); err == nil && parsed.Scheme != "" {
+		query := parsed.Query()
+		query.Set("search_path", schema)
+		parsed.RawQuery = query.Encode()
+		dsn = parsed.String()
+	} else {
+		dsn += " search_path=" + schema
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("cannot connect to PostgreSQL: %v", err)
+	}
+	closeOnCleanup(t, db)
+	return db
+}
+
+// closeOnCleanup closes the connections of a database at the end of a test.
+func closeOnCleanup(t *testing.T, db *gorm.DB) {
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"fileserver/config"
+	"fileserver/internal/models"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// dialect hides the differences between the SQL of the supported databases, so that the queries of the
+// services behave the same with the postgres and the sqlite drivers.
+type dialect string
+
+// Supported dialects, named after the GORM dialectors.
+const (
+	dialectPostgres dialect = "postgres"
+	dialectSQLite   dialect = "sqlite"
+)
+
+// currentDialect returns the dialect of the configured database.
+func currentDialect() dialect {
+	return dialect(config.DB.Dialector.Name())
+}
+
+// containsFold restricts a query to the rows whose column contains value, ignoring the case.
+// The wildcards of LIKE in value are matched literally.
+//
+// Parameters:
+// - db (*gorm.DB): The query to restrict.
+// - column (string): The column to match.
+// - value (string): The text to look for.
+//
+// Returns:
+// - *gorm.DB: The restricted query.
+func (d dialect) containsFold(db *gorm.DB, column, value string) *gorm.DB {
+	return db.Where(d.likeFold(column), "%"+escapeLike(value)+"%")
+}
+
+// prefixFold restricts a query to the rows whose column starts with prefix, ignoring the case.
+// The wildcards of LIKE in prefix are matched literally.
+//
+// Parameters:
+// - db (*gorm.DB): The query to restrict.
+// - column (string): The column to match.
+// - prefix (string): The expected beginning of the column.
+//
+// Returns:
+// - *gorm.DB: The restricted query.
+func (d dialect) prefixFold(db *gorm.DB, column, prefix string) *gorm.DB {
+	return db.Where(d.likeFold(column), escapeLike(prefix)+"%")
+}
+
+// likeFold returns the condition matching a column against a LIKE pattern, ignoring the case.
+// Postgres has ILIKE, while the LIKE of SQLite already ignores the case (of the ASCII letters only, unless
+// SQLite is built with ICU).
+func (d dialect) likeFold(column string) string {
+	if d == dialectPostgres {
+		return column + ` ILIKE ? ESCAPE '\'`
+	}
+	return column + ` LIKE ? ESCAPE '\'`
+}
+
+// timeValue converts a time to compare with a timestamp column. SQLite stores the times as text in the local
+// time zone of the server, which compares correctly only with times in the same zone.
+func (d dialect) timeValue(t time.Time) time.Time {
+	if d == dialectSQLite {
+		return t.Local()
+	}
+	return t
+}
+
+// availableDocuments is a scope restricting a query to the documents that are not in the trash and whose
+// content has been uploaded. The columns are qualified, so that the scope also applies to joins.
+func availableDocuments(db *gorm.DB) *gorm.DB {
+	return db.Where("documents.deleted_at IS NULL AND documents.status = ?", models.DocumentAvailable)
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, with backslash as escape character.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
@@ -1,39 +1,213 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fileserver/config"
 	"fileserver/internal/models"
+	"fileserver/internal/utils"
 	"fmt"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"slices"
+	"strings"
+	"time"
 )
 
-// GetFiles retrieves a list of documents from the database based on a fuzzy search on file names.
-// It only returns documents that have not been logically deleted (i.e., deleted_at is NULL).
-// The function performs a case-insensitive search using the provided search query.
+// ErrDuplicateDocument is returned by CreateDocument when the content is already stored by another document
+// and the duplicates policy rejects it.
+var ErrDuplicateDocument = errors.New("document already exists")
+
+// StagedFile describes a file uploaded to a staging key of the storage, waiting to become a document.
+type StagedFile struct {
+	Name        string // Original name of the file
+	Key         string // Storage key where the content has been uploaded
+	Fingerprint string // Fingerprint of the content
+	Size        int64  // Size of the content in bytes
+	MimeType    string // MIME type of the content
+
+	Uploader    string          // Who uploaded the file
+	Owner       string          // Identity of the caller who uploaded the file, empty if anonymous
+	Description string          // Free text description of the file
+	Metadata    models.Metadata // Custom key/values attached to the file
+	FolderID    *uint           // Folder of the file, nil for the root
+}
+
+// DocumentChanges holds the new values of the editable fields of a document; nil fields are left untouched.
+type DocumentChanges struct {
+	Name        *string          // New name of the document
+	Description *string          // New description of the document
+	Metadata    *models.Metadata // New custom key/values, replacing the current ones
+	Move        bool             // Whether the document is moved to FolderID
+	FolderID    *uint            // New folder of the document, nil for the root
+}
+
+// FileQuery holds the filters, the sort and the page of a list of documents.
+type FileQuery struct {
+	SearchQuery string   // Part of the file names, matched ignoring the case, empty for all the documents
+	Tags        []string // Normalized names of the tags to filter on, none to skip the filter
+	MatchAll    bool     // Whether a document must have all the tags (AND) or at least one of them (OR)
+
+	MimeType    string     // MIME type of the content (e.g. "application/pdf"), or a type family (e.g. "image/*")
+	Uploader    string     // Who uploaded the document
+	CreatedFrom *time.Time // Documents created at or after this time
+	CreatedTo   *time.Time // Documents created before this time
+	UpdatedFrom *time.Time // Documents updated at or after this time
+	UpdatedTo   *time.Time // Documents updated before this time
+	MinSize     *int64     // Documents of at least this size in bytes
+	MaxSize     *int64     // Documents of at most this size in bytes
+
+	Caller *Principal // Caller of the list, only the documents it can read are listed; nil for all
+
+	Sort       string  // Sort key: "name" (default), "createdAt", "updatedAt" or "size"
+	Descending bool    // Whether the documents are sorted in descending order
+	Limit      int     // Maximum number of documents in the page
+	Cursor     *Cursor // Position of the page, nil for the first page
+}
+
+// FilePage is a page of a list of documents.
+type FilePage struct {
+	Documents []models.Document // The documents of the page, with their tags
+	Total     int64             // Number of documents matching the filters, in all the pages
+	Next      *Cursor           // Position of the next page, nil on the last page
+	Prev      *Cursor           // Position of the previous page, nil on the first page
+}
+
+// GetFiles retrieves a page of documents from the database based on a fuzzy search on file names,
+// optionally restricted to the documents with the given tags and to the ones matching the other filters.
+// It only returns documents that have not been logically deleted (i.e., deleted_at is NULL), and that the
+// caller can read according to the ACLs.
+// The pages are read with keyset pagination: the cursors hold the sort key and the id of the first and last
+// document of a page, so that reading a page does not depend on its offset in the list.
 //
 // Parameters:
-//   - searchQuery (string): The search term used to find documents by their file name. This will be used
-//     in a fuzzy search with the 'ILIKE' operator in PostgreSQL.
+//   - query (FileQuery): The filters, the sort and the position of the page. The search query is matched
+//     ignoring the case on all the database drivers (with 'ILIKE' in PostgreSQL, 'LIKE' in SQLite).
 //
 // Returns:
-// - []models.Document: A slice of documents that match the search query and are not logically deleted.
-// - error: An error is returned if there is an issue with retrieving the documents from the database.
-func GetFiles(searchQuery string) ([]models.Document, error) {
-	// Declare a slice to hold the results of the query
-	var documents []models.Document
+// - *FilePage: The documents of the page with their tags, the total count and the cursors of the
+// adjacent pages.
+// - error: ErrInvalidCursor if the cursor does not match the sort, or an error if there is an issue with
+// retrieving the documents from the database.
+func GetFiles(query FileQuery) (*FilePage, error) {
+	column, ok := sortColumns[query.Sort]
+	if !ok {
+		return nil, fmt.Errorf("sort key %q is not supported", query.Sort)
+	}
+	if query.Cursor != nil && (query.Cursor.Sort != query.Sort || query.Cursor.Descending != query.Descending) {
+		return nil, fmt.Errorf("%w: the cursor belongs to a list sorted differently", ErrInvalidCursor)
+	}
+
+	// Step 1: Count all the documents matching the filters
+	page := &FilePage{}
+	if err := filterFiles(query).Model(&models.Document{}).Count(&page.Total).Error; err != nil {
+		return nil, fmt.Errorf("error counting documents: %v", err)
+	}
+
+	// Step 2: Read the page after the cursor, or before it when going backward. The documents are read in
+	// reverse order when going backward, so that the ones closest to the cursor come first.
+	backward := query.Cursor != nil && query.Cursor.Backward
+	descending := query.Descending != backward
+	direction, operator := "ASC", ">"
+	if descending {
+		direction, operator = "DESC", "<"
+	}
+	db := filterFiles(query).Preload("Tags")
+	if query.Cursor != nil {
+		value, err := query.Cursor.sortValue()
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", column, operator, column, operator), value, value, query.Cursor.ID)
+	}
+	documents := make([]models.Document, 0, query.Limit+1)
+	if err := db.Order(column + " " + direction).Order("id " + direction).Limit(query.Limit + 1).Find(&documents).Error; err != nil {
+		// If there is an error during the query execution, return the error message
+		return nil, fmt.Errorf("error retrieving documents: %v", err)
+	}
+
+	// Step 3: One document more than the limit means that there is another page in the reading direction
+	more := len(documents) > query.Limit
+	if more {
+		documents = documents[:query.Limit]
+	}
+	if backward {
+		slices.Reverse(documents)
+	}
+	page.Documents = documents
+
+	// Step 4: Point the cursors to the first and the last document of the page
+	if len(documents) > 0 {
+		first, last := &documents[0], &documents[len(documents)-1]
+		if (backward && more) || (!backward && query.Cursor != nil) {
+			page.Prev = cursorAt(first, query.Sort, query.Descending, true)
+		}
+		if (!backward && more) || backward {
+			page.Next = cursorAt(last, query.Sort, query.Descending, false)
+		}
+	}
+	return page, nil
+}
 
-	// Perform the query to find documents where:
+// filterFiles builds the query of the documents matching the filters of a list.
+func filterFiles(query FileQuery) *gorm.DB {
+	d := currentDialect()
+
+	// Build the query to find documents where:
 	// - 'deleted_at' is NULL (i.e., the document has not been logically deleted)
-	// - The file name matches the search query using a case-insensitive pattern match ('ILIKE')
-	if err := config.DB.Where("deleted_at IS NULL AND name ILIKE ?", searchQuery).Find(&documents).Error; err != nil {
-		// If there is an error during the query execution, return an empty slice and the error message
-		return documents, fmt.Errorf("error retrieving documents: %v", err)
+	// - The content has been uploaded (i.e., the document is not pending)
+	// - The caller can read the document
+	db := config.DB.Scopes(availableDocuments, visibleDocuments(query.Caller))
+
+	// - The file name contains the search query, ignoring the case
+	if query.SearchQuery != "" {
+		db = d.containsFold(db, "name", query.SearchQuery)
+	}
+
+	// - The document has all the tags, or any of them
+	if len(query.Tags) > 0 {
+		tagged := config.DB.Table("document_tags").
+			Select("document_tags.document_id").
+			Joins("JOIN tags ON tags.id = document_tags.tag_id").
+			Where("tags.name IN ?", query.Tags)
+		if query.MatchAll {
+			tagged = tagged.Group("document_tags.document_id").Having("COUNT(DISTINCT tags.id) = ?", len(query.Tags))
+		}
+		db = db.Where("id IN (?)", tagged)
+	}
+
+	// - The content is of the MIME type (whatever its parameters, e.g. the charset) or of the type family.
+	// The MIME types are stored lower case.
+	mimeType := strings.ToLower(query.MimeType)
+	if family, ok := strings.CutSuffix(mimeType, "/*"); ok {
+		db = d.prefixFold(db, "mime_type", family+"/")
+	} else if mimeType != "" {
+		db = db.Where(config.DB.Where("mime_type = ?", mimeType).Or(d.likeFold("mime_type"), escapeLike(mimeType+";")+"%"))
 	}
 
-	// Return the list of documents and nil error if the query was successful
-	return documents, nil
+	// - The uploader, the dates and the size are in the requested ranges
+	if query.Uploader != "" {
+		db = db.Where("uploader = ?", query.Uploader)
+	}
+	if query.CreatedFrom != nil {
+		db = db.Where("created_at >= ?", d.timeValue(*query.CreatedFrom))
+	}
+	if query.CreatedTo != nil {
+		db = db.Where("created_at < ?", d.timeValue(*query.CreatedTo))
+	}
+	if query.UpdatedFrom != nil {
+		db = db.Where("updated_at >= ?", d.timeValue(*query.UpdatedFrom))
+	}
+	if query.UpdatedTo != nil {
+		db = db.Where("updated_at < ?", d.timeValue(*query.UpdatedTo))
+	}
+	if query.MinSize != nil {
+		db = db.Where("size >= ?", *query.MinSize)
+	}
+	if query.MaxSize != nil {
+		db = db.Where("size <= ?", *query.MaxSize)
+	}
+	return db
 }
 
 // GetDocument retrieves a document from the database based on its `idFile` field.
@@ -49,8 +223,8 @@ func GetFiles(searchQuery string) ([]models.Document, error) {
 func GetDocument(idFile uuid.UUID) (*models.Document, error) {
 	var document models.Document
 
-	// Perform the query to find the document by its unique `idFile` field
-	if err := config.DB.Where("deleted_at IS NULL AND id_file = ?", idFile).First(&document).Error; err != nil {
+	// Perform the query to find the document by its unique `idFile` field, pending documents are not visible yet
+	if err := config.DB.Scopes(availableDocuments).Where("id_file = ?", idFile).First(&document).Error; err != nil {
 		// If no record is found, return a descriptive error
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, fmt.Errorf("document with idFile %v not found", idFile)
@@ -63,6 +237,60 @@ func GetDocument(idFile uuid.UUID) (*models.Document, error) {
 	return &document, nil
 }
 
+// UpdateDocument changes the editable fields of a document: its name, description and custom metadata,
+// and moves it to another folder.
+//
+// Parameters:
+// - document (*models.Document): The document to update. It is updated in place with the changes.
+// - changes (DocumentChanges): The new values of the fields; nil fields are left untouched.
+//
+// Returns:
+// - error: ErrFolderNotFound if the new folder does not exist, or a database error.
+func UpdateDocument(document *models.Document, changes DocumentChanges) error {
+	// Collect the columns to update
+	updates := make(map[string]interface{})
+	if changes.Name != nil {
+		updates["name"] = *changes.Name
+	}
+	if changes.Description != nil {
+		updates["description"] = *changes.Description
+	}
+	if changes.Metadata != nil {
+		updates["metadata"] = *changes.Metadata
+	}
+	if changes.Move {
+		if changes.FolderID != nil {
+			if _, err := GetFolder(*changes.FolderID); err != nil {
+				return err
+			}
+		}
+		updates["folder_id"] = changes.FolderID
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	// Save the changes
+	if err := config.DB.Model(document).Updates(updates).Error; err != nil {
+		return fmt.Errorf("error while updating document: %v", err)
+	}
+	if changes.Name != nil {
+		document.Name = *changes.Name
+		// The name is indexed with the content
+		scheduleIndexing(document.ID)
+	}
+	if changes.Description != nil {
+		document.Description = *changes.Description
+	}
+	if changes.Metadata != nil {
+		document.Metadata = *changes.Metadata
+	}
+	if changes.Move {
+		document.FolderID = changes.FolderID
+	}
+	return nil
+}
+
 // GetDocumentByFingerprint retrieves a document from the database based on its unique fingerprint.
 // It returns the document if found, or an error if not found or if any database-related issues occur.
 //
@@ -140,3 +368,162 @@ func DeleteDocument(idFile uuid.UUID) error {
 	// If no error occurred, return nil (indicating success).
 	return nil
 }
+
+// CreateDocument turns a staged file into a document referencing the content-addressed blob of its content.
+// When another document already has the same content, the upload is rejected with ErrDuplicateDocument or
+// linked to the same blob, depending on the duplicates policy. The staged object is always consumed.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - staged (StagedFile): The file uploaded to the staging key.
+// - duplicates (string): The policy for byte-identical uploads ("reject" or "link").
+//
+// Returns:
+// - *models.Document: The document created.
+// - bool: True if the content was already stored and is now shared with other documents.
+// - error: ErrDuplicateDocument (wrapped) if the upload is rejected, or any error during the creation.
+func CreateDocument(ctx context.Context, staged StagedFile, duplicates string) (*models.Document, bool, error) {
+	// Store the content once, under its fingerprint
+	blob, err := storeBlob(ctx, staged, duplicates)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Save document to database as a named reference to the blob
+	document := &models.Document{
+		Name:        staged.Name,
+		IdFile:      uuid.New(),
+		ObjectKey:   blob.ObjectKey,
+		Fingerprint: staged.Fingerprint,
+		BlobID:      &blob.ID,
+		Size:        staged.Size,
+		MimeType:    staged.MimeType,
+		Extension:   utils.FileExtension(staged.Name),
+		Uploader:    staged.Uploader,
+		Owner:       staged.Owner,
+		Description: staged.Description,
+		Metadata:    staged.Metadata,
+		FolderID:    staged.FolderID,
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(document).Error; err != nil {
+			return fmt.Errorf("error while adding document: %v", err)
+		}
+		// The first version shares the reference held by the document
+		return ensureVersions(ctx, tx, document)
+	})
+	if err != nil {
+		// Give the reference back, the document does not exist
+		if releaseErr := ReleaseBlob(ctx, blob.ID); releaseErr != nil {
+			return nil, false, fmt.Errorf("%v (release blob: %v)", err, releaseErr)
+		}
+		return nil, false, err
+	}
+
+	// Extract and index the text in background
+	scheduleIndexing(document.ID)
+	return document, blob.RefCount > 1, nil
+}
+
+// storeBlob applies the duplicates policy to a staged file and moves its content to the blob of its fingerprint.
+// When the content is already stored and the policy rejects duplicates, the staged object is deleted and
+// ErrDuplicateDocument is returned, naming the existing document only if the caller of ctx can read it.
+func storeBlob(ctx context.Context, staged StagedFile, duplicates string) (*models.Blob, error) {
+	// Check if document already uploaded
+	if existing, err := GetDocumentByFingerprint(staged.Fingerprint); err == nil && duplicates == config.DuplicatesReject {
+		if err := DeleteFileFromStorage(ctx, staged.Key); err != nil {
+			return nil, err
+		}
+		if CheckDocumentAccess(PrincipalFrom(ctx), existing, models.ScopeRead) != nil {
+			return nil, ErrDuplicateDocument
+		}
+		return nil, fmt.Errorf("%w: %v", ErrDuplicateDocument, existing.IdFile)
+	}
+	return AcquireBlob(ctx, staged.Key, staged.Fingerprint, staged.Size)
+}
+
+// PurgeDocument permanently deletes a document, including a logically deleted one, and drops its reference
+// to the blobs of the contents of all its versions. A content is removed from the storage only when no other
+// document or version uses it.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - idFile (uuid.UUID): The unique identifier of the document to purge.
+//
+// Returns:
+// - error: Returns an error if the document is not found or if there is a failure during the purge.
+func PurgeDocument(ctx context.Context, idFile uuid.UUID) error {
+	var document models.Document
+
+	// Retrieve the document, whether it is logically deleted or not
+	if err := config.DB.Unscoped().Where("id_file = ?", idFile).First(&document).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("document with idFile %v not found", idFile)
+		}
+		return fmt.Errorf("error while fetching document: %v", err)
+	}
+
+	// Collect the versions of the document, each of them references its content
+	var versions []models.DocumentVersion
+	if err := config.DB.Where("document_id = ?", document.ID).Find(&versions).Error; err != nil {
+		return fmt.Errorf("error while fetching versions: %v", err)
+	}
+	if len(versions) == 0 {
+		// Documents never versioned reference their content directly
+		versions = append(versions, models.DocumentVersion{ObjectKey: document.Key(), BlobID: document.BlobID})
+	}
+
+	// Physically delete the rows
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", document.ID).Delete(&models.DocumentVersion{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM document_tags WHERE document_id = ?", document.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("document_id = ?", document.ID).Delete(&models.ACLEntry{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("share_id IN (?)", tx.Model(&models.Share{}).Select("id").Where("document_id = ?", document.ID)).Delete(&models.ShareAccess{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("document_id = ?", document.ID).Delete(&models.Share{}).Error; err != nil {
+			return err
+		}
+		if err := removeFromIndex(tx, document.ID); err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&document).Error
+	})
+	if err != nil {
+		return fmt.Errorf("error while purging document: %v", err)
+	}
+
+	// Release the contents
+	for _, version := range versions {
+		if err := releaseContent(ctx, version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseContent drops the reference of a purged version to its content.
+func releaseContent(ctx context.Context, version models.DocumentVersion) error {
+	if version.BlobID != nil {
+		return ReleaseBlob(ctx, *version.BlobID)
+	}
+
+	// Documents stored before the blobs own their object, unless other documents were linked to it
+	var documents, versions int64
+	if err := config.DB.Unscoped().Model(&models.Document{}).Where("object_key = ?", version.ObjectKey).Count(&documents).Error; err != nil {
+		return fmt.Errorf("error while counting object references: %v", err)
+	}
+	if err := config.DB.Model(&models.DocumentVersion{}).Where("object_key = ?", version.ObjectKey).Count(&versions).Error; err != nil {
+		return fmt.Errorf("error while counting object references: %v", err)
+	}
+	if documents+versions == 0 {
+		return DeleteFileFromStorage(ctx, version.ObjectKey)
+	}
+	return nil
+}
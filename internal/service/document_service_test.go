@@ -0,0 +1,279 @@
+package service
+
+import (
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"github.com/google/uuid"
+	"slices"
+	"testing"
+	"time"
+)
+
+// listed is a document of the fixture of the GetFiles tests.
+type listed struct {
+	name     string
+	mimeType string
+	uploader string
+	size     int64
+	hours    int    // Hours after the epoch of the fixture when the document was created and updated
+	status   string // Status of the document, available when empty
+	deleted  bool   // Whether the document is in the trash
+	tags     []string
+}
+
+// fixtureEpoch is the creation time of the oldest document of the fixture.
+var fixtureEpoch = time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+
+// seedDocuments creates the documents of the GetFiles tests: five listed documents, one in the trash and one
+// still pending. Two documents have the same size, to check that the cursors break the ties.
+func seedDocuments(t *testing.T) {
+	t.Helper()
+	fixture := []listed{
+		{name: "Report.PDF", mimeType: "application/pdf", uploader: "alice", size: 100, hours: 0, tags: []string{"finance", "2024"}},
+		{name: "report-2024.pdf", mimeType: "application/pdf", uploader: "bob", size: 200, hours: 1, tags: []string{"finance"}},
+		{name: "holiday.JPG", mimeType: "image/jpeg", uploader: "alice", size: 300, hours: 2, tags: []string{"2024"}},
+		{name: "100%_sure.txt", mimeType: "text/plain", uploader: "carol", size: 300, hours: 3},
+		{name: "notes.txt", mimeType: "text/plain; charset=utf-8", uploader: "bob", size: 400, hours: 4},
+		{name: "old report.pdf", mimeType: "application/pdf", uploader: "alice", size: 500, hours: 5, deleted: true, tags: []string{"finance"}},
+		{name: "pending report.pdf", mimeType: "application/pdf", uploader: "alice", size: 600, hours: 6, status: models.DocumentPending},
+	}
+	for _, entry := range fixture {
+		at := fixtureEpoch.Add(time.Duration(entry.hours) * time.Hour)
+		document := &models.Document{
+			Name:      entry.name,
+			IdFile:    uuid.New(),
+			Status:    entry.status,
+			Size:      entry.size,
+			MimeType:  entry.mimeType,
+			Uploader:  entry.uploader,
+			CreatedAt: at,
+			UpdatedAt: at,
+		}
+		if err := config.DB.Create(document).Error; err != nil {
+			t.Fatalf("error creating %s: %v", entry.name, err)
+		}
+		if len(entry.tags) > 0 {
+			if err := AddTags(document, entry.tags); err != nil {
+				t.Fatalf("error tagging %s: %v", entry.name, err)
+			}
+			// Tagging touches the document, restore the time of the fixture
+			if err := config.DB.Model(document).UpdateColumn("updated_at", at).Error; err != nil {
+				t.Fatalf("error updating %s: %v", entry.name, err)
+			}
+		}
+		if entry.deleted {
+			if err := config.DB.Delete(document).Error; err != nil {
+				t.Fatalf("error deleting %s: %v", entry.name, err)
+			}
+		}
+	}
+}
+
+// listNames returns the names of the documents listed by GetFiles, sorted by name, and the total count.
+func listNames(t *testing.T, query FileQuery) ([]string, int64) {
+	t.Helper()
+	query.Sort = "name"
+	query.Limit = 100
+	page, err := GetFiles(query)
+	if err != nil {
+		t.Fatalf("GetFiles: %v", err)
+	}
+	names := pageNames(page)
+	slices.Sort(names)
+	return names, page.Total
+}
+
+// pageNames returns the names of the documents of a page, in order.
+func pageNames(page *FilePage) []string {
+	names := make([]string, len(page.Documents))
+	for i, document := range page.Documents {
+		names[i] = document.Name
+	}
+	return names
+}
+
+func TestGetFilesSkipsDeletedAndPendingDocuments(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		seedDocuments(t)
+		names, total := listNames(t, FileQuery{})
+		want := []string{"100%_sure.txt", "Report.PDF", "holiday.JPG", "notes.txt", "report-2024.pdf"}
+		if !slices.Equal(names, want) || total != int64(len(want)) {
+			t.Errorf("GetFiles = %v (total %d), want %v", names, total, want)
+		}
+	})
+}
+
+func TestGetFilesSearchIgnoresCase(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		seedDocuments(t)
+		tests := []struct {
+			search string
+			want   []string
+		}{
+			{"report", []string{"Report.PDF", "report-2024.pdf"}},
+			{"REPORT", []string{"Report.PDF", "report-2024.pdf"}},
+			{".jpg", []string{"holiday.JPG"}},
+			{"%", []string{"100%_sure.txt"}}, // The wildcards of LIKE are matched literally
+			{"_", []string{"100%_sure.txt"}},
+			{"missing", []string{}},
+		}
+		for _, test := range tests {
+			names, total := listNames(t, FileQuery{SearchQuery: test.search})
+			if !slices.Equal(names, test.want) || total != int64(len(test.want)) {
+				t.Errorf("search %q = %v (total %d), want %v", test.search, names, total, test.want)
+			}
+		}
+	})
+}
+
+func TestGetFilesFiltersOnTags(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		seedDocuments(t)
+		tests := []struct {
+			tags     []string
+			matchAll bool
+			want     []string
+		}{
+			{[]string{"finance"}, false, []string{"Report.PDF", "report-2024.pdf"}},
+			{[]string{"finance", "2024"}, false, []string{"Report.PDF", "holiday.JPG", "report-2024.pdf"}},
+			{[]string{"finance", "2024"}, true, []string{"Report.PDF"}},
+			{[]string{"unknown"}, false, []string{}},
+		}
+		for _, test := range tests {
+			names, total := listNames(t, FileQuery{Tags: test.tags, MatchAll: test.matchAll})
+			if !slices.Equal(names, test.want) || total != int64(len(test.want)) {
+				t.Errorf("tags %v (all: %v) = %v (total %d), want %v", test.tags, test.matchAll, names, total, test.want)
+			}
+		}
+
+		// The tags are loaded with the documents
+		page, err := GetFiles(FileQuery{Sort: "name", Limit: 10, SearchQuery: "Report.PDF"})
+		if err != nil {
+			t.Fatalf("GetFiles: %v", err)
+		}
+		if len(page.Documents) != 1 || len(page.Documents[0].Tags) != 2 {
+			t.Errorf("GetFiles did not load the tags: %+v", page.Documents)
+		}
+	})
+}
+
+func TestGetFilesFilters(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		seedDocuments(t)
+		at := func(hours int) *time.Time {
+			value := fixtureEpoch.Add(time.Duration(hours) * time.Hour)
+			return &value
+		}
+		size := func(value int64) *int64 { return &value }
+		tests := []struct {
+			name  string
+			query FileQuery
+			want  []string
+		}{
+			{"mime type", FileQuery{MimeType: "application/pdf"}, []string{"Report.PDF", "report-2024.pdf"}},
+			{"mime type with parameters", FileQuery{MimeType: "TEXT/PLAIN"}, []string{"100%_sure.txt", "notes.txt"}},
+			{"mime type family", FileQuery{MimeType: "image/*"}, []string{"holiday.JPG"}},
+			{"uploader", FileQuery{Uploader: "alice"}, []string{"Report.PDF", "holiday.JPG"}},
+			{"created range", FileQuery{CreatedFrom: at(1), CreatedTo: at(3)}, []string{"holiday.JPG", "report-2024.pdf"}},
+			{"updated range", FileQuery{UpdatedFrom: at(3), UpdatedTo: at(10)}, []string{"100%_sure.txt", "notes.txt"}},
+			{"size range", FileQuery{MinSize: size(200), MaxSize: size(300)}, []string{"100%_sure.txt", "holiday.JPG", "report-2024.pdf"}},
+			{"combined", FileQuery{SearchQuery: "report", Uploader: "bob", MimeType: "application/pdf"}, []string{"report-2024.pdf"}},
+		}
+		for _, test := range tests {
+			names, total := listNames(t, test.query)
+			if !slices.Equal(names, test.want) || total != int64(len(test.want)) {
+				t.Errorf("%s: GetFiles = %v (total %d), want %v", test.name, names, total, test.want)
+			}
+		}
+	})
+}
+
+func TestGetFilesCursors(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		seedDocuments(t)
+		tests := []struct {
+			sort       string
+			descending bool
+			pages      [][]string
+		}{
+			{"size", false, [][]string{{"Report.PDF", "report-2024.pdf"}, {"holiday.JPG", "100%_sure.txt"}, {"notes.txt"}}},
+			{"size", true, [][]string{{"notes.txt", "100%_sure.txt"}, {"holiday.JPG", "report-2024.pdf"}, {"Report.PDF"}}},
+			{"createdAt", false, [][]string{{"Report.PDF", "report-2024.pdf"}, {"holiday.JPG", "100%_sure.txt"}, {"notes.txt"}}},
+			{"updatedAt", true, [][]string{{"notes.txt", "100%_sure.txt"}, {"holiday.JPG", "report-2024.pdf"}, {"Report.PDF"}}},
+		}
+		for _, test := range tests {
+			query := FileQuery{Sort: test.sort, Descending: test.descending, Limit: 2}
+
+			// Walk forward through the pages, as a client does with the opaque cursors
+			var pages []*FilePage
+			for {
+				page, err := GetFiles(query)
+				if err != nil {
+					t.Fatalf("%s: GetFiles: %v", test.sort, err)
+				}
+				pages = append(pages, page)
+				if page.Next == nil || len(pages) > len(test.pages) {
+					break
+				}
+				query.Cursor = reparse(t, page.Next)
+			}
+			if len(pages) != len(test.pages) {
+				t.Fatalf("%s (descending: %v): %d pages forward, want %d", test.sort, test.descending, len(pages), len(test.pages))
+			}
+			for i, page := range pages {
+				if names := pageNames(page); !slices.Equal(names, test.pages[i]) {
+					t.Errorf("%s (descending: %v): page %d forward = %v, want %v", test.sort, test.descending, i, names, test.pages[i])
+				}
+				if page.Total != 5 {
+					t.Errorf("%s: total of page %d = %d, want 5", test.sort, i, page.Total)
+				}
+				if (page.Prev == nil) != (i == 0) {
+					t.Errorf("%s: page %d has previous cursor %v", test.sort, i, page.Prev)
+				}
+			}
+
+			// Walk backward from the last page to the first one
+			for i := len(pages) - 1; i > 0; i-- {
+				query.Cursor = reparse(t, pages[i].Prev)
+				page, err := GetFiles(query)
+				if err != nil {
+					t.Fatalf("%s: GetFiles backward: %v", test.sort, err)
+				}
+				if names := pageNames(page); !slices.Equal(names, test.pages[i-1]) {
+					t.Errorf("%s (descending: %v): page %d backward = %v, want %v", test.sort, test.descending, i-1, names, test.pages[i-1])
+				}
+				if (page.Prev == nil) != (i-1 == 0) || page.Next == nil {
+					t.Errorf("%s: page %d backward has cursors prev %v, next %v", test.sort, i-1, page.Prev, page.Next)
+				}
+			}
+		}
+	})
+}
+
+func TestGetFilesRejectsCursorOfAnotherSort(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		seedDocuments(t)
+		page, err := GetFiles(FileQuery{Sort: "size", Limit: 2})
+		if err != nil {
+			t.Fatalf("GetFiles: %v", err)
+		}
+		_, err = GetFiles(FileQuery{Sort: "name", Limit: 2, Cursor: page.Next})
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("GetFiles with the cursor of another sort: %v, want ErrInvalidCursor", err)
+		}
+		if _, err := ParseCursor("not a cursor"); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("ParseCursor of garbage: %v, want ErrInvalidCursor", err)
+		}
+	})
+}
+
+// reparse encodes and decodes a cursor, as it travels through a client.
+func reparse(t *testing.T, cursor *Cursor) *Cursor {
+	t.Helper()
+	parsed, err := ParseCursor(cursor.String())
+	if err != nil {
+		t.Fatalf("ParseCursor: %v", err)
+	}
+	return parsed
+}
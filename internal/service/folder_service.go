@@ -0,0 +1,299 @@
+package service
+
+import (
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// Errors returned by the folder functions.
+var (
+	ErrFolderNotFound    = errors.New("folder not found")
+	ErrFolderExists      = errors.New("a folder with the same name already exists")
+	ErrFolderNotEmpty    = errors.New("folder is not empty")
+	ErrFolderCycle       = errors.New("a folder cannot be moved inside itself")
+	ErrInvalidFolderName = errors.New("invalid folder name")
+	ErrPathNotFound      = errors.New("path not found")
+)
+
+// FolderChanges holds the new values of a folder; nil fields are left untouched.
+type FolderChanges struct {
+	Name     *string // New name of the folder
+	Move     bool    // Whether the folder is moved under ParentID
+	ParentID *uint   // New parent of the folder, nil for the root
+}
+
+// ValidateFolderName checks that a name can be used for a folder, i.e. as a segment of a path.
+//
+// Parameters:
+// - name (string): The name of the folder.
+//
+// Returns:
+// - error: ErrInvalidFolderName if the name is empty, "." or "..", or contains a slash.
+func ValidateFolderName(name string) error {
+	switch {
+	case strings.TrimSpace(name) == "":
+		return fmt.Errorf("%w: the name cannot be empty", ErrInvalidFolderName)
+	case name == "." || name == "..":
+		return fmt.Errorf("%w: the name cannot be %q", ErrInvalidFolderName, name)
+	case strings.Contains(name, "/"):
+		return fmt.Errorf("%w: %q cannot contain slashes", ErrInvalidFolderName, name)
+	}
+	return nil
+}
+
+// GetFolder retrieves a folder by its identifier.
+//
+// Parameters:
+// - id (uint): The identifier of the folder.
+//
+// Returns:
+// - *models.Folder: A pointer to the folder if found.
+// - error: ErrFolderNotFound if the folder does not exist, or a database error.
+func GetFolder(id uint) (*models.Folder, error) {
+	var folder models.Folder
+	if err := config.DB.First(&folder, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %d", ErrFolderNotFound, id)
+		}
+		return nil, fmt.Errorf("error while retrieving folder: %v", err)
+	}
+	return &folder, nil
+}
+
+// CreateFolder creates a folder under a parent folder, or at the root.
+//
+// Parameters:
+// - name (string): The name of the folder, unique among its siblings.
+// - parentID (*uint): The parent folder, nil for the root.
+// - owner (string): The identity of the caller creating the folder, empty if anonymous.
+//
+// Returns:
+// - *models.Folder: The new folder.
+// - error: ErrFolderNotFound if the parent does not exist, ErrFolderExists if a sibling has the same name,
+// or a database error.
+func CreateFolder(name string, parentID *uint, owner string) (*models.Folder, error) {
+	if err := ValidateFolderName(name); err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		if _, err := GetFolder(*parentID); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkFolderName(name, parentID, 0); err != nil {
+		return nil, err
+	}
+
+	folder := &models.Folder{Name: name, ParentID: parentID, Owner: owner}
+	if err := config.DB.Create(folder).Error; err != nil {
+		return nil, fmt.Errorf("error while adding folder: %v", err)
+	}
+	return folder, nil
+}
+
+// UpdateFolder renames a folder and/or moves it under another parent. A folder cannot be moved inside
+// itself or one of its descendants.
+//
+// Parameters:
+// - folder (*models.Folder): The folder to update. It is updated in place with the changes.
+// - changes (FolderChanges): The new name and/or parent.
+//
+// Returns:
+// - error: ErrFolderNotFound if the new parent does not exist, ErrFolderCycle if the move would create a
+// cycle, ErrFolderExists if a sibling has the same name, or a database error.
+func UpdateFolder(folder *models.Folder, changes FolderChanges) error {
+	name, parentID := folder.Name, folder.ParentID
+	if changes.Name != nil {
+		if err := ValidateFolderName(*changes.Name); err != nil {
+			return err
+		}
+		name = *changes.Name
+	}
+	if changes.Move {
+		parentID = changes.ParentID
+	}
+
+	// Walk up from the new parent: meeting the folder itself means it would be moved inside itself
+	for ancestor := parentID; ancestor != nil; {
+		if *ancestor == folder.ID {
+			return ErrFolderCycle
+		}
+		parent, err := GetFolder(*ancestor)
+		if err != nil {
+			return err
+		}
+		ancestor = parent.ParentID
+	}
+	if err := checkFolderName(name, parentID, folder.ID); err != nil {
+		return err
+	}
+
+	// Save the changes
+	if err := config.DB.Model(folder).Updates(map[string]interface{}{"name": name, "parent_id": parentID}).Error; err != nil {
+		return fmt.Errorf("error while updating folder: %v", err)
+	}
+	folder.Name, folder.ParentID = name, parentID
+	return nil
+}
+
+// DeleteFolder deletes a folder. An empty folder is always deleted; a folder with subfolders or documents is
+// deleted only when recursive is set, together with all its subfolders, and its documents are moved to the
+// trash. The documents restored from the trash go back to the root, since their folder is gone, and so do the
+// documents of the resumable uploads still in progress towards the deleted folders.
+//
+// Parameters:
+// - folder (*models.Folder): The folder to delete.
+// - recursive (bool): Whether the content of the folder is deleted as well.
+//
+// Returns:
+// - int64: The number of documents moved to the trash.
+// - error: ErrFolderNotEmpty if the folder is not empty and recursive is not set, or a database error.
+func DeleteFolder(folder *models.Folder, recursive bool) (int64, error) {
+	// Step 1: Collect the folder and all its descendants, level by level
+	ids := []uint{folder.ID}
+	for level := []uint{folder.ID}; len(level) > 0; {
+		var children []uint
+		if err := config.DB.Model(&models.Folder{}).Where("parent_id IN ?", level).Pluck("id", &children).Error; err != nil {
+			return 0, fmt.Errorf("error while retrieving subfolders: %v", err)
+		}
+		ids = append(ids, children...)
+		level = children
+	}
+
+	var trashed int64
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Step 2: Move the documents to the trash, out of the folders (including the ones already in the trash)
+		result := tx.Model(&models.Document{}).Where("folder_id IN ?", ids).
+			Updates(map[string]interface{}{"deleted_at": time.Now(), "folder_id": nil})
+		if result.Error != nil {
+			return fmt.Errorf("error while deleting documents: %v", result.Error)
+		}
+		trashed = result.RowsAffected
+		if !recursive && (len(ids) > 1 || trashed > 0) {
+			return ErrFolderNotEmpty
+		}
+		if err := tx.Unscoped().Model(&models.Document{}).Where("folder_id IN ?", ids).Update("folder_id", nil).Error; err != nil {
+			return fmt.Errorf("error while deleting documents: %v", err)
+		}
+		// The resumable uploads still in progress create their documents at the root
+		if err := tx.Model(&models.Upload{}).Where("folder_id IN ?", ids).Update("folder_id", nil).Error; err != nil {
+			return fmt.Errorf("error while updating uploads: %v", err)
+		}
+
+		// Step 3: Delete the folders with their ACL entries, the deepest first
+		if err := tx.Where("folder_id IN ?", ids).Delete(&models.ACLEntry{}).Error; err != nil {
+			return fmt.Errorf("error while deleting ACL entries: %v", err)
+		}
+		for i := len(ids) - 1; i >= 0; i-- {
+			if err := tx.Delete(&models.Folder{}, ids[i]).Error; err != nil {
+				return fmt.Errorf("error while deleting folder: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return trashed, nil
+}
+
+// GetChildren retrieves the subfolders and the documents of a folder, or of the root, that a caller can read.
+//
+// Parameters:
+// - parentID (*uint): The folder to browse, nil for the root.
+// - caller (*Principal): The caller browsing the folder, nil to list all the children.
+//
+// Returns:
+// - []models.Folder: The subfolders, ordered by name.
+// - []models.Document: The documents not in the trash, ordered by name, with their tags.
+// - error: An error is returned if there is an issue with retrieving the children from the database.
+func GetChildren(parentID *uint, caller *Principal) ([]models.Folder, []models.Document, error) {
+	folders := make([]models.Folder, 0)
+	if err := inFolder(config.DB, "parent_id", parentID).Scopes(visibleFolders(caller)).Order("name").Find(&folders).Error; err != nil {
+		return nil, nil, fmt.Errorf("error retrieving folders: %v", err)
+	}
+
+	documents := make([]models.Document, 0)
+	if err := inFolder(config.DB, "folder_id", parentID).Preload("Tags").
+		Scopes(availableDocuments, visibleDocuments(caller)).
+		Order("name").Find(&documents).Error; err != nil {
+		return nil, nil, fmt.Errorf("error retrieving documents: %v", err)
+	}
+	return folders, documents, nil
+}
+
+// ResolvePath looks up a slash separated path such as "projects/acme/spec.pdf", starting from the root.
+// Every segment but the last one must be a folder; the last one is a folder or, when there is no folder
+// with that name, a document. When several documents of a folder have the same name the newest is returned.
+//
+// Parameters:
+// - path (string): The path to resolve. An empty path is the root.
+//
+// Returns:
+// - *models.Folder: The folder at the path, nil if the path is the root or a document.
+// - *models.Document: The document at the path, nil if the path is a folder.
+// - error: ErrPathNotFound if a segment does not exist, or a database error.
+func ResolvePath(path string) (*models.Folder, *models.Document, error) {
+	var folder *models.Folder
+	segments := strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+	for i, segment := range segments {
+		var parentID *uint
+		if folder != nil {
+			parentID = &folder.ID
+		}
+
+		// Look for a folder first
+		var child models.Folder
+		err := inFolder(config.DB, "parent_id", parentID).Where("name = ?", segment).First(&child).Error
+		if err == nil {
+			folder = &child
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, fmt.Errorf("error while resolving path: %v", err)
+		}
+
+		// Then for a document, which can only be the last segment
+		if i == len(segments)-1 {
+			var document models.Document
+			err := inFolder(config.DB, "folder_id", parentID).
+				Scopes(availableDocuments).Where("name = ?", segment).
+				Order("created_at DESC").First(&document).Error
+			if err == nil {
+				return nil, &document, nil
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil, fmt.Errorf("error while resolving path: %v", err)
+			}
+		}
+		return nil, nil, fmt.Errorf("%w: %s", ErrPathNotFound, strings.Join(segments[:i+1], "/"))
+	}
+	return folder, nil, nil
+}
+
+// checkFolderName makes sure that no folder other than exclude has the given name under the parent.
+// The unique index cannot enforce it for the root folders, whose parent is NULL.
+func checkFolderName(name string, parentID *uint, exclude uint) error {
+	var count int64
+	if err := inFolder(config.DB, "parent_id", parentID).Model(&models.Folder{}).
+		Where("name = ? AND id <> ?", name, exclude).Count(&count).Error; err != nil {
+		return fmt.Errorf("error while checking folder name: %v", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %s", ErrFolderExists, name)
+	}
+	return nil
+}
+
+// inFolder restricts a query to the rows whose column references the given folder, or the root when nil.
+func inFolder(tx *gorm.DB, column string, folderID *uint) *gorm.DB {
+	if folderID == nil {
+		return tx.Where(column + " IS NULL")
+	}
+	return tx.Where(column+" = ?", *folderID)
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Limits of the reads of the JWKS.
+const (
+	maxJWKSSize      = 1 << 20          // Maximum size of a JWKS document
+	jwksFetchTimeout = 10 * time.Second // Maximum duration of a download of the JWKS
+	minJWKSRetry     = time.Minute      // Minimum delay between two reads caused by unknown key ids
+)
+
+// jwk is a JSON Web Key as found in a JWKS document (RFC 7517). Only the public keys are read.
+type jwk struct {
+	Kty string `json:"kty"` // Key type: "RSA", "EC" or "OKP"
+	Kid string `json:"kid"` // Key id, matched against the "kid" header of the tokens
+	Use string `json:"use"` // Public key use, "sig" for the signing keys
+	Alg string `json:"alg"` // Algorithm the key is used with, if restricted
+	N   string `json:"n"`   // RSA modulus
+	E   string `json:"e"`   // RSA public exponent
+	Crv string `json:"crv"` // Curve of the EC and OKP keys
+	X   string `json:"x"`   // X coordinate of the EC keys, public key of the OKP keys
+	Y   string `json:"y"`   // Y coordinate of the EC keys
+}
+
+// signingKey is a public key of the JWKS, with the algorithm it is restricted to.
+type signingKey struct {
+	key crypto.PublicKey // *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey
+	alg string           // Algorithm of the key, empty if any algorithm of its type is accepted
+}
+
+// keySet holds the signing keys of a JWKS read from a file or a URL. It is read again when it gets older
+// than the refresh interval, and when a token is signed with an unknown key, e.g. after a key rotation.
+type keySet struct {
+	file     string        // Path of the JWKS file
+	url      string        // URL of the JWKS
+	interval time.Duration // How often the JWKS is read again
+
+	mu       sync.Mutex            // Guards the fields below
+	keys     map[string]signingKey // Keys by id, "" for the keys without id
+	loadedAt time.Time             // When the JWKS was last read
+}
+
+// lookup returns the key of a token, reading the JWKS again when it is stale or does not have the key.
+//
+// Parameters:
+// - kid (string): The "kid" header of the token, empty if missing.
+//
+// Returns:
+// - signingKey: The key, found by id; without id, the only key of the set.
+// - error: An error is returned if the key is not in the set or the JWKS cannot be read.
+func (s *keySet) lookup(kid string) (signingKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Step 1: Read the JWKS the first time and when it is stale; after a failure, wait before retrying
+	age := time.Since(s.loadedAt)
+	if (s.keys == nil && age >= minJWKSRetry) || age >= s.interval {
+		if err := s.load(); err != nil && s.keys == nil {
+			return signingKey{}, err
+		}
+	}
+	if s.keys == nil {
+		return signingKey{}, fmt.Errorf("JWKS not available, retrying in %v", (minJWKSRetry - age).Round(time.Second))
+	}
+
+	// Step 2: Find the key, reading the JWKS again if it is unknown
+	key, err := s.find(kid)
+	if err != nil && time.Since(s.loadedAt) >= minJWKSRetry {
+		if s.load() == nil {
+			key, err = s.find(kid)
+		}
+	}
+	return key, err
+}
+
+// find returns a key of the set by id; without id, the set must have a single key.
+func (s *keySet) find(kid string) (signingKey, error) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, nil
+		}
+	}
+	key, ok := s.keys[kid]
+	if !ok {
+		return signingKey{}, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// load reads the JWKS and replaces the keys of the set. The keys are kept when the JWKS cannot be read.
+func (s *keySet) load() error {
+	s.loadedAt = time.Now()
+	data, err := s.read()
+	if err != nil {
+		return fmt.Errorf("error reading JWKS: %v", err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("error parsing JWKS: %v", err)
+	}
+	s.keys = keys
+	return nil
+}
+
+// read returns the content of the JWKS file or the response of the JWKS URL.
+func (s *keySet) read() ([]byte, error) {
+	if s.file != "" {
+		return os.ReadFile(s.file)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s answered %s", s.url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
+
+// parseJWKS decodes the signing keys of a JWKS document. The keys of other uses or of unsupported types
+// are skipped.
+func parseJWKS(data []byte) (map[string]signingKey, error) {
+	var document struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]signingKey, len(document.Keys))
+	for _, k := range document.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", k.Kid, err)
+		}
+		if key != nil {
+			keys[k.Kid] = signingKey{key: key, alg: k.Alg}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys")
+	}
+	return keys, nil
+}
+
+// publicKey decodes the public key of a JWK, nil for the unsupported key types (e.g. symmetric keys).
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %v", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		var check ecdh.Curve
+		switch k.Crv {
+		case "P-256":
+			curve, check = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, check = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, check = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		size := (curve.Params().BitSize + 7) / 8
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, fmt.Errorf("invalid coordinates")
+		}
+		// Check that the point is on the curve, using its uncompressed encoding
+		if _, err := check.NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("invalid point: %v", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid public key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, nil
+	}
+}
+
+// decodeBigInt decodes a base64url encoded, big-endian unsigned integer.
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"fileserver/internal/storage"
+	"fileserver/internal/utils"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"net/url"
+	"time"
+)
+
+// Errors returned by the presigned URL functions.
+var (
+	ErrPresignNotSupported = errors.New("storage backend does not support presigned URLs")
+	ErrContentNotUploaded  = errors.New("content has not been uploaded yet")
+)
+
+// PresignUpload creates a pending document and a presigned URL the client can use to upload its content
+// directly to the storage. The content is written to a staging key and the document stays pending, hidden
+// from the listings and the downloads, until ConfirmDocument is called.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - staged (StagedFile): The name and the descriptive fields of the document; the content fields are ignored.
+// - expiry (time.Duration): How long the upload URL is valid.
+//
+// Returns:
+// - *models.Document: The pending document.
+// - *url.URL: The presigned PUT URL.
+// - error: ErrPresignNotSupported if the storage backend cannot presign URLs, or a database/storage error.
+func PresignUpload(ctx context.Context, staged StagedFile, expiry time.Duration) (*models.Document, *url.URL, error) {
+	presigner, ok := config.Store.(storage.Presigner)
+	if !ok {
+		return nil, nil, ErrPresignNotSupported
+	}
+
+	// Step 1: Reserve the document, its content goes to a staging key
+	idFile := uuid.New()
+	document := &models.Document{
+		Name:        staged.Name,
+		IdFile:      idFile,
+		ObjectKey:   StagingKey(idFile),
+		Status:      models.DocumentPending,
+		Extension:   utils.FileExtension(staged.Name),
+		Uploader:    staged.Uploader,
+		Owner:       staged.Owner,
+		Description: staged.Description,
+		Metadata:    staged.Metadata,
+		FolderID:    staged.FolderID,
+	}
+
+	// Step 2: Sign the upload URL before saving anything, so that a failure leaves no pending document
+	presigned, err := presigner.PresignPut(ctx, document.ObjectKey, expiry)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := AddDocument(document); err != nil {
+		return nil, nil, err
+	}
+	return document, presigned, nil
+}
+
+// GetPendingDocument retrieves a document whose content is still being uploaded through a presigned URL.
+//
+// Parameters:
+// - idFile (uuid.UUID): The unique identifier of the document to retrieve.
+//
+// Returns:
+// - *models.Document: A pointer to the pending document if found.
+// - error: An error is returned if no pending document is found or there is a database issue.
+func GetPendingDocument(idFile uuid.UUID) (*models.Document, error) {
+	var document models.Document
+	if err := config.DB.Where("status = ? AND id_file = ?", models.DocumentPending, idFile).First(&document).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("pending document with idFile %v not found", idFile)
+		}
+		return nil, fmt.Errorf("error while retrieving document: %v", err)
+	}
+	return &document, nil
+}
+
+// ConfirmDocument completes a presigned upload. The object uploaded by the client is checked with Stat and
+// read back to calculate its fingerprint, then it is moved to its blob and the document becomes available.
+// When the content is already stored and the policy rejects duplicates, the pending document is dropped.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - document (*models.Document): The pending document, as returned by GetPendingDocument.
+// - duplicates (string): The policy for byte-identical content (config.DuplicatesReject or config.DuplicatesLink).
+//
+// Returns:
+// - bool: Whether the content was linked to the content of another document.
+// - error: ErrContentNotUploaded if the client has not uploaded the object, ErrDuplicateDocument if the
+// content is rejected as a duplicate, or a database/storage error.
+func ConfirmDocument(ctx context.Context, document *models.Document, duplicates string) (bool, error) {
+	// Step 1: Make sure the client uploaded the content
+	if _, err := config.Store.Stat(ctx, document.ObjectKey); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return false, ErrContentNotUploaded
+		}
+		return false, err
+	}
+
+	// Step 2: The content did not go through the server, read it back to fingerprint it
+	fingerprint, size, err := FingerprintObject(ctx, document.ObjectKey)
+	if err != nil {
+		return false, err
+	}
+	mimeType, err := DetectObjectMimeType(ctx, document.ObjectKey, document.Name)
+	if err != nil {
+		return false, err
+	}
+
+	// Step 3: Move the content to its blob, the staged object is gone afterward
+	blob, err := storeBlob(ctx, StagedFile{
+		Name:        document.Name,
+		Key:         document.ObjectKey,
+		Fingerprint: fingerprint,
+		Size:        size,
+	}, duplicates)
+	if errors.Is(err, ErrDuplicateDocument) {
+		// The pending document has no content anymore
+		if deleteErr := config.DB.Unscoped().Delete(document).Error; deleteErr != nil {
+			return false, fmt.Errorf("%v (delete pending document: %v)", err, deleteErr)
+		}
+		return false, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Step 4: Make the document available, unless a concurrent confirmation got there first
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(document).Where("status = ?", models.DocumentPending).Updates(map[string]interface{}{
+			"object_key":  blob.ObjectKey,
+			"fingerprint": fingerprint,
+			"blob_id":     blob.ID,
+			"size":        size,
+			"mime_type":   mimeType,
+			"status":      models.DocumentAvailable,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("document with idFile %v is not pending anymore", document.IdFile)
+		}
+		// The first version shares the reference held by the document
+		document.ObjectKey, document.Fingerprint, document.BlobID = blob.ObjectKey, fingerprint, &blob.ID
+		document.Size, document.MimeType = size, mimeType
+		return ensureVersions(ctx, tx, document)
+	})
+	if err != nil {
+		// Give the reference back, the document does not point to the blob
+		if releaseErr := ReleaseBlob(ctx, blob.ID); releaseErr != nil {
+			return false, fmt.Errorf("error while confirming document: %v (release blob: %v)", err, releaseErr)
+		}
+		return false, fmt.Errorf("error while confirming document: %v", err)
+	}
+
+	// Extract and index the text in background
+	scheduleIndexing(document.ID)
+	return blob.RefCount > 1, nil
+}
+
+// PresignDownload returns a presigned URL the client can use to download the content of a document directly
+// from the storage. The URL asks the client to save the content under the name of the document.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - document (*models.Document): The document to download.
+// - expiry (time.Duration): How long the download URL is valid.
+//
+// Returns:
+// - *url.URL: The presigned GET URL.
+// - error: ErrPresignNotSupported if the storage backend cannot presign URLs, or a storage error.
+func PresignDownload(ctx context.Context, document *models.Document, expiry time.Duration) (*url.URL, error) {
+	presigner, ok := config.Store.(storage.Presigner)
+	if !ok {
+		return nil, ErrPresignNotSupported
+	}
+	return presigner.PresignGet(ctx, document.Key(), expiry, document.Name)
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"fileserver/config"
+	"fileserver/internal/models"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Markers wrapped around the matching terms in the snippets of the search hits.
+const (
+	highlightStart = "<mark>"
+	highlightEnd   = "</mark>"
+)
+
+// textIndex is the full-text index of the document contents, implemented with the search features of the
+// database in use.
+type textIndex interface {
+	// save indexes the name and the text of a document, replacing what was indexed before.
+	save(tx *gorm.DB, document *models.Document, text string) error
+	// remove drops a document from the index.
+	remove(tx *gorm.DB, documentID uint) error
+	// search returns the documents matching the query that the caller can read, the most relevant first.
+	search(query string, limit int, caller *Principal) ([]SearchHit, error)
+}
+
+// searchRow is a row returned by the search queries: a document with its rank and snippet.
+type searchRow struct {
+	models.Document
+	Rank    float64
+	Snippet string
+}
+
+var (
+	indexOnce sync.Once
+	index     textIndex
+	indexErr  error
+)
+
+// getTextIndex returns the index matching the database driver, whose tables are created by the migrations.
+func getTextIndex() (textIndex, error) {
+	indexOnce.Do(func() {
+		switch config.DB.Dialector.Name() {
+		case "postgres":
+			index = postgresIndex{language: config.App.Search.TextSearchLanguage()}
+		case "sqlite":
+			index, indexErr = openSQLiteIndex(config.DB)
+		default:
+			indexErr = fmt.Errorf("full-text search is not supported with %s", config.DB.Dialector.Name())
+		}
+	})
+	return index, indexErr
+}
+
+// postgresIndex indexes the documents in a tsvector column of the document_texts table, see the migrations.
+// The name weighs more than the content in the ranking.
+type postgresIndex struct {
+	language string // Text search configuration (e.g. "simple", "english")
+}
+
+func (p postgresIndex) save(tx *gorm.DB, document *models.Document, text string) error {
+	return tx.Exec(`INSERT INTO document_texts (document_id, fingerprint, content, tsv, indexed_at)
+		VALUES (?, ?, ?, setweight(to_tsvector(?::regconfig, ?), 'A') || setweight(to_tsvector(?::regconfig, ?), 'B'), ?)
+		ON CONFLICT (document_id) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, content = EXCLUDED.content,
+			tsv = EXCLUDED.tsv, indexed_at = EXCLUDED.indexed_at`,
+		document.ID, document.Fingerprint, text, p.language, document.Name, p.language, text, time.Now()).Error
+}
+
+func (p postgresIndex) remove(tx *gorm.DB, documentID uint) error {
+	return tx.Exec("DELETE FROM document_texts WHERE document_id = ?", documentID).Error
+}
+
+func (p postgresIndex) search(query string, limit int, caller *Principal) ([]SearchHit, error) {
+	var rows []searchRow
+	options := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxFragments=2, MaxWords=30, MinWords=10", highlightStart, highlightEnd)
+	err := config.DB.Raw(`SELECT documents.*, ts_rank(t.tsv, q.query) AS rank,
+			ts_headline(?::regconfig, t.content, q.query, ?) AS snippet
+		FROM document_texts t
+		JOIN documents ON documents.id = t.document_id
+		CROSS JOIN websearch_to_tsquery(?::regconfig, ?) AS q(query)
+		WHERE t.tsv @@ q.query AND documents.deleted_at IS NULL AND documents.status = ? AND documents.id IN (?)
+		ORDER BY rank DESC, documents.id
+		LIMIT ?`,
+		p.language, options, p.language, query, models.DocumentAvailable, readableIDs(caller), limit).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return toHits(rows), nil
+}
+
+// openSQLiteIndex returns the FTS5 index, checking that the document_texts table created by the migrations
+// is an FTS5 table.
+func openSQLiteIndex(db *gorm.DB) (textIndex, error) {
+	var definition string
+	if err := db.Raw("SELECT COALESCE(MAX(sql), '') FROM sqlite_master WHERE name = 'document_texts'").Scan(&definition).Error; err != nil {
+		return nil, fmt.Errorf("error while opening search index: %v", err)
+	}
+	switch {
+	case definition == "":
+		return nil, fmt.Errorf("search index document_texts does not exist, apply the migrations")
+	case !strings.Contains(strings.ToLower(definition), "fts5"):
+		return nil, fmt.Errorf("search index document_texts is not an FTS5 table, create it again as in the migration 0002_full_text_search")
+	}
+	return fts5Index{}, nil
+}
+
+// fts5Index indexes the documents in an FTS5 virtual table, ranked with bm25.
+// The name weighs more than the content in the ranking.
+type fts5Index struct{}
+
+func (fts5Index) save(tx *gorm.DB, document *models.Document, text string) error {
+	if err := tx.Exec("DELETE FROM document_texts WHERE document_id = ?", document.ID).Error; err != nil {
+		return err
+	}
+	return tx.Exec("INSERT INTO document_texts (name, content, document_id, fingerprint) VALUES (?, ?, ?, ?)",
+		document.Name, text, document.ID, document.Fingerprint).Error
+}
+
+func (fts5Index) remove(tx *gorm.DB, documentID uint) error {
+	return tx.Exec("DELETE FROM document_texts WHERE document_id = ?", documentID).Error
+}
+
+func (fts5Index) search(query string, limit int, caller *Principal) ([]SearchHit, error) {
+	// Every term is quoted, so that the FTS5 query syntax does not apply to the user input
+	terms := strings.Fields(query)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+
+	var rows []searchRow
+	err := config.DB.Raw(`SELECT documents.*, -bm25(document_texts, 10.0, 1.0) AS rank,
+			snippet(document_texts, 1, ?, ?, '…', 24) AS snippet
+		FROM document_texts
+		JOIN documents ON documents.id = document_texts.document_id
+		WHERE document_texts MATCH ? AND documents.deleted_at IS NULL AND documents.status = ? AND documents.id IN (?)
+		ORDER BY bm25(document_texts, 10.0, 1.0), documents.id
+		LIMIT ?`,
+		highlightStart, highlightEnd, strings.Join(terms, " "), models.DocumentAvailable, readableIDs(caller), limit).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return toHits(rows), nil
+}
+
+// readableIDs returns the subquery of the identifiers of the documents a caller can read, for the raw search
+// queries.
+func readableIDs(caller *Principal) *gorm.DB {
+	return config.DB.Model(&models.Document{}).Unscoped().Select("documents.id").Scopes(visibleDocuments(caller))
+}
+
+// toHits converts the rows of a search query to hits.
+func toHits(rows []searchRow) []SearchHit {
+	hits := make([]SearchHit, len(rows))
+	for i, row := range rows {
+		hits[i] = SearchHit{Document: row.Document, Rank: row.Rank, Snippet: row.Snippet}
+	}
+	return hits
+}
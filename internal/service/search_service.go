@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/extract"
+	"fileserver/internal/models"
+	"fmt"
+	"gorm.io/gorm"
+	"log/slog"
+	"strings"
+)
+
+// ErrEmptyQuery is returned by SearchDocuments when the query has no terms.
+var ErrEmptyQuery = errors.New("empty search query")
+
+// SearchHit is a document matching a full-text search.
+type SearchHit struct {
+	Document models.Document `json:"document"` // The matching document
+	Rank     float64         `json:"rank"`     // Relevance of the document, the higher the better
+	Snippet  string          `json:"snippet"`  // Part of the content with the matching terms highlighted
+}
+
+// indexQueue holds the identifiers of the documents waiting to be indexed by the indexer.
+var indexQueue chan uint
+
+// SearchDocuments searches the documents whose name or content match a query, the most relevant first.
+// The query syntax depends on the database: Postgres accepts the web search syntax ("quoted phrases", or,
+// -excluded), SQLite matches all the terms. Documents in the trash, and the ones the caller cannot read, are
+// not returned.
+//
+// Parameters:
+// - query (string): The terms to search.
+// - limit (int): The maximum number of hits to return.
+// - caller (*Principal): The caller of the search, nil to search all the documents.
+//
+// Returns:
+// - []SearchHit: The matching documents with their rank and a highlighted snippet.
+// - error: ErrEmptyQuery if the query has no terms, or an error if the search fails.
+func SearchDocuments(query string, limit int, caller *Principal) ([]SearchHit, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, ErrEmptyQuery
+	}
+	index, err := getTextIndex()
+	if err != nil {
+		return nil, err
+	}
+	hits, err := index.search(query, limit, caller)
+	if err != nil {
+		return nil, fmt.Errorf("error searching documents: %v", err)
+	}
+	return hits, nil
+}
+
+// IndexDocument extracts the text of the current content of a document and indexes it with its name.
+// Contents in formats without text, or larger than the configured maximum, are indexed by name only.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation.
+// - documentID (uint): The identifier of the document. Documents purged or not uploaded yet are skipped.
+//
+// Returns:
+// - error: An error is returned if the content cannot be read or the index cannot be updated.
+func IndexDocument(ctx context.Context, documentID uint) error {
+	index, err := getTextIndex()
+	if err != nil {
+		return err
+	}
+
+	// Step 1: Get the document, also from the trash since it can be restored
+	var document models.Document
+	if err := config.DB.Unscoped().Where("id = ? AND status = ?", documentID, models.DocumentAvailable).First(&document).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("error while retrieving document: %v", err)
+	}
+
+	// Step 2: Extract the text of the content
+	text := ""
+	if extract.Supported(document.MimeType, document.Extension) {
+		if text, err = extractText(ctx, &document); err != nil {
+			// The document stays searchable by name
+			slog.WarnContext(ctx, "Cannot extract the text of document", "document_id", document.IdFile, "error", err)
+		}
+	}
+
+	// Step 3: Replace the indexed text
+	if err := index.save(config.DB, &document, text); err != nil {
+		return fmt.Errorf("error while indexing document: %v", err)
+	}
+	return nil
+}
+
+// IndexMissingDocuments indexes the documents whose current content has not been indexed yet, e.g. because
+// they were uploaded while the indexer was not running.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation; its cancellation stops the indexing.
+//
+// Returns:
+// - int: The number of documents indexed.
+// - error: The first error encountered; the indexing goes on with the other documents anyway.
+func IndexMissingDocuments(ctx context.Context) (int, error) {
+	if _, err := getTextIndex(); err != nil {
+		return 0, err
+	}
+
+	var ids []uint
+	err := config.DB.Unscoped().Model(&models.Document{}).
+		Where("status = ?", models.DocumentAvailable).
+		Where("NOT EXISTS (SELECT 1 FROM document_texts WHERE document_texts.document_id = documents.id AND document_texts.fingerprint = documents.fingerprint)").
+		Order("id").Pluck("id", &ids).Error
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving documents to index: %v", err)
+	}
+
+	var firstErr error
+	indexed := 0
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return indexed, ctx.Err()
+		}
+		if err := IndexDocument(ctx, id); err != nil {
+			slog.ErrorContext(ctx, "Error indexing document", "document_pk", id, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		indexed++
+	}
+	return indexed, firstErr
+}
+
+// StartIndexer runs the indexing in background until ctx is cancelled: it first indexes the documents
+// missing from the index, then the documents queued by the uploads, the new versions and the renames.
+//
+// Parameters:
+// - ctx (context.Context): The context whose cancellation stops the indexer.
+func StartIndexer(ctx context.Context) {
+	indexQueue = make(chan uint, config.App.Search.IndexQueueSize())
+	go func() {
+		indexed, err := IndexMissingDocuments(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "Error indexing documents", "error", err)
+		}
+		if indexed > 0 {
+			slog.InfoContext(ctx, "Indexed documents", "count", indexed)
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case id := <-indexQueue:
+				if err := IndexDocument(ctx, id); err != nil {
+					slog.ErrorContext(ctx, "Error indexing document", "document_pk", id, "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// scheduleIndexing queues a document for the indexer, without waiting. When the indexer is not running or
+// its queue is full, the document is indexed at the next start of the indexer.
+func scheduleIndexing(documentID uint) {
+	if indexQueue == nil {
+		return
+	}
+	select {
+	case indexQueue <- documentID:
+	default:
+		slog.Warn("Indexing queue full, the document will be indexed at the next start", "document_pk", documentID)
+	}
+}
+
+// removeFromIndex drops a purged document from the search index.
+func removeFromIndex(tx *gorm.DB, documentID uint) error {
+	index, err := getTextIndex()
+	if err != nil {
+		return err
+	}
+	return index.remove(tx, documentID)
+}
+
+// extractText reads the current content of a document from the storage and extracts its text.
+func extractText(ctx context.Context, document *models.Document) (string, error) {
+	object, err := GetFileFromStorage(ctx, document.Key())
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	info, err := object.Stat()
+	if err != nil {
+		return "", fmt.Errorf("error reading object: %v", err)
+	}
+	if info.Size > config.App.Search.MaxIndexedSize() {
+		return "", fmt.Errorf("content of %d bytes is larger than %d bytes", info.Size, config.App.Search.MaxIndexedSize())
+	}
+	return extract.Text(object, info.Size, document.MimeType, document.Extension)
+}
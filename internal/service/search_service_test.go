@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fileserver/config"
+	"strings"
+	"testing"
+)
+
+func TestSearchDocumentsMatchesNameAndContent(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		requireSearch(t)
+		ctx := context.Background()
+		index := func(name, content string) {
+			staged := StagedFile{Name: name, Key: "uploads/" + name, Size: int64(len(content)), MimeType: "text/plain"}
+			staged.Fingerprint = stageContent(t, staged.Key, content)
+			document, _, err := CreateDocument(ctx, staged, config.DuplicatesReject)
+			if err != nil {
+				t.Fatalf("CreateDocument %s: %v", name, err)
+			}
+			if err := IndexDocument(ctx, document.ID); err != nil {
+				t.Fatalf("IndexDocument %s: %v", name, err)
+			}
+		}
+		index("budget.txt", "the quarterly figures of the sales team")
+		index("minutes.txt", "the budget was approved by the board")
+		index("recipe.txt", "flour, eggs and sugar")
+
+		tests := []struct {
+			query string
+			want  []string // The names of the hits, the most relevant first
+		}{
+			{"budget", []string{"budget.txt", "minutes.txt"}}, // The name weighs more than the content
+			{"quarterly sales", []string{"budget.txt"}},
+			{"eggs", []string{"recipe.txt"}},
+			{"missing", nil},
+		}
+		for _, test := range tests {
+			hits, err := SearchDocuments(test.query, 10, nil)
+			if err != nil {
+				t.Fatalf("SearchDocuments %q: %v", test.query, err)
+			}
+			names := make([]string, len(hits))
+			for i, hit := range hits {
+				names[i] = hit.Document.Name
+			}
+			if strings.Join(names, ",") != strings.Join(test.want, ",") {
+				t.Errorf("SearchDocuments %q = %v, want %v", test.query, names, test.want)
+			}
+		}
+
+		if _, err := SearchDocuments("  ", 10, nil); !errors.Is(err, ErrEmptyQuery) {
+			t.Errorf("SearchDocuments of an empty query: %v, want ErrEmptyQuery", err)
+		}
+	})
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"log/slog"
+	"time"
+)
+
+// Format of the generated share tokens: 32 random bytes, base64url encoded.
+const (
+	shareTokenBytes  = 32
+	shareShownLength = 8 // Characters of the token kept in clear, to recognise it
+)
+
+// maxSharePassword is the maximum length of a share password, the longest input of bcrypt.
+const maxSharePassword = 72
+
+// Errors returned by the share services.
+var (
+	ErrShareNotFound  = errors.New("share not found")
+	ErrShareExpired   = errors.New("share has expired")
+	ErrShareExhausted = errors.New("share has reached its maximum number of downloads")
+	ErrSharePassword  = errors.New("share password missing or wrong")
+	ErrInvalidShare   = errors.New("invalid share")
+)
+
+// ShareOptions holds the limits of a new share.
+type ShareOptions struct {
+	ExpiresAt    *time.Time // When the link expires, nil if it never expires
+	MaxDownloads *int       // Maximum number of downloads, nil if unlimited
+	Password     string     // Password asked to the recipients, empty for none
+}
+
+// ShareRequest describes an access to a share, as recorded in its log.
+type ShareRequest struct {
+	Password   string // Password sent by the client, empty if none
+	Download   bool   // Whether the whole content is sent, rather than the headers, a range or 304 Not Modified
+	RemoteAddr string // Address of the client
+	UserAgent  string // User agent of the client
+}
+
+// CreateShare creates a public link to a document, with an unguessable token. Only the hash of the token
+// is stored, and the bcrypt hash of the password.
+//
+// Parameters:
+// - document (*models.Document): The document to share.
+// - createdBy (string): The identity of the caller creating the share, empty if anonymous.
+// - options (ShareOptions): The expiry, the maximum number of downloads and the password of the share.
+//
+// Returns:
+// - *models.Share: The stored share.
+// - string: The token of the share, which cannot be retrieved later.
+// - error: ErrInvalidShare if the options are not valid, or an error if the share cannot be saved.
+func CreateShare(document *models.Document, createdBy string, options ShareOptions) (*models.Share, string, error) {
+	// Step 1: Check the options
+	if options.ExpiresAt != nil && !options.ExpiresAt.After(time.Now()) {
+		return nil, "", fmt.Errorf("%w: the expiry must be in the future", ErrInvalidShare)
+	}
+	if options.MaxDownloads != nil && *options.MaxDownloads <= 0 {
+		return nil, "", fmt.Errorf("%w: the maximum number of downloads must be positive", ErrInvalidShare)
+	}
+	if len(options.Password) > maxSharePassword {
+		return nil, "", fmt.Errorf("%w: the password cannot be longer than %d bytes", ErrInvalidShare, maxSharePassword)
+	}
+
+	// Step 2: Generate the token and hash the password
+	random := make([]byte, shareTokenBytes)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", fmt.Errorf("error generating share token: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(random)
+	share := &models.Share{
+		DocumentID:   document.ID,
+		Prefix:       token[:shareShownLength],
+		TokenHash:    hashToken(token),
+		CreatedBy:    createdBy,
+		MaxDownloads: options.MaxDownloads,
+		ExpiresAt:    options.ExpiresAt,
+	}
+	if options.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(options.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, "", fmt.Errorf("error hashing share password: %v", err)
+		}
+		share.PasswordHash = string(hash)
+	}
+
+	// Step 3: Store the share
+	if err := config.DB.Create(share).Error; err != nil {
+		return nil, "", fmt.Errorf("error while saving share: %v", err)
+	}
+	return share, token, nil
+}
+
+// GetShares retrieves the shares of a document, the revoked ones included.
+//
+// Parameters:
+// - document (*models.Document): The shared document.
+//
+// Returns:
+// - []models.Share: The shares, ordered by id.
+// - error: An error is returned if the shares cannot be read.
+func GetShares(document *models.Document) ([]models.Share, error) {
+	shares := []models.Share{}
+	if err := config.DB.Where("document_id = ?", document.ID).Order("id").Find(&shares).Error; err != nil {
+		return nil, fmt.Errorf("error while retrieving shares: %v", err)
+	}
+	return shares, nil
+}
+
+// GetShare retrieves a share of a document.
+//
+// Parameters:
+// - document (*models.Document): The shared document.
+// - id (uint): The id of the share.
+//
+// Returns:
+// - *models.Share: The share.
+// - error: ErrShareNotFound if the document has no such share.
+func GetShare(document *models.Document, id uint) (*models.Share, error) {
+	var share models.Share
+	if err := config.DB.Where("document_id = ?", document.ID).First(&share, id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrShareNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("error while retrieving share: %v", err)
+	}
+	return &share, nil
+}
+
+// RevokeShare revokes a share, whose link is refused from then on. Revoking a revoked share does nothing.
+//
+// Parameters:
+// - share (*models.Share): The share to revoke. It is updated in place.
+//
+// Returns:
+// - error: An error is returned if the share cannot be updated.
+func RevokeShare(share *models.Share) error {
+	if share.RevokedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	if err := config.DB.Model(share).Update("revoked_at", now).Error; err != nil {
+		return fmt.Errorf("error while revoking share: %v", err)
+	}
+	share.RevokedAt = &now
+	return nil
+}
+
+// GetShareAccesses retrieves the log of the accesses to a share, the most recent first.
+//
+// Parameters:
+// - share (*models.Share): The share.
+//
+// Returns:
+// - []models.ShareAccess: The accesses, successful or not.
+// - error: An error is returned if the log cannot be read.
+func GetShareAccesses(share *models.Share) ([]models.ShareAccess, error) {
+	accesses := []models.ShareAccess{}
+	if err := config.DB.Where("share_id = ?", share.ID).Order("id DESC").Find(&accesses).Error; err != nil {
+		return nil, fmt.Errorf("error while retrieving share accesses: %v", err)
+	}
+	return accesses, nil
+}
+
+// OpenShare checks a share token and returns the shared document. The refused accesses to an existing share
+// are recorded with their outcome; the granted ones are recorded by RecordShareAccess, once it is known
+// whether the content is downloaded.
+//
+// Parameters:
+// - token (string): The token of the share, from the public link.
+// - request (ShareRequest): The password sent by the client and the details of the access.
+//
+// Returns:
+// - *models.Share: The share.
+// - *models.Document: The shared document.
+// - error: ErrShareNotFound if the token is unknown, revoked or its document is not available anymore,
+// ErrShareExpired, ErrShareExhausted, ErrSharePassword, or a database error.
+func OpenShare(token string, request ShareRequest) (*models.Share, *models.Document, error) {
+	// Step 1: Look the share up by the hash of the token
+	var share models.Share
+	if err := config.DB.Where("token_hash = ?", hashToken(token)).First(&share).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrShareNotFound
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("error while retrieving share: %v", err)
+	}
+
+	// Step 2: Check the limits of the share, then its password
+	now := time.Now()
+	switch {
+	case share.RevokedAt != nil:
+		return nil, nil, refuseShare(&share, models.ShareRevoked, request, ErrShareNotFound)
+	case share.ExpiresAt != nil && !now.Before(*share.ExpiresAt):
+		return nil, nil, refuseShare(&share, models.ShareExpired, request, ErrShareExpired)
+	case share.MaxDownloads != nil && share.Downloads >= *share.MaxDownloads:
+		return nil, nil, refuseShare(&share, models.ShareExhausted, request, ErrShareExhausted)
+	case share.PasswordHash != "" &&
+		bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(request.Password)) != nil:
+		return nil, nil, refuseShare(&share, models.SharePasswordRequired, request, ErrSharePassword)
+	}
+
+	// Step 3: Get the document, which may have been moved to the trash since
+	var document models.Document
+	if err := config.DB.Scopes(availableDocuments).First(&document, share.DocumentID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, refuseShare(&share, models.ShareRevoked, request, ErrShareNotFound)
+	} else if err != nil {
+		return nil, nil, fmt.Errorf("error while retrieving document: %v", err)
+	}
+	return &share, &document, nil
+}
+
+// RecordShareAccess records a granted access to a share opened by OpenShare. A download counts against the
+// maximum number of downloads of the share, unless another client took the last one in the meantime.
+//
+// Parameters:
+// - share (*models.Share): The share, its number of downloads is updated in place.
+// - request (ShareRequest): The details of the access, Download telling whether the whole content is sent.
+//
+// Returns:
+// - error: ErrShareExhausted if the last download was taken in the meantime, or a database error.
+func RecordShareAccess(share *models.Share, request ShareRequest) error {
+	outcome := models.ShareInspected
+	if request.Download {
+		outcome = models.ShareDownloaded
+		result := config.DB.Model(share).
+			Where("max_downloads IS NULL OR downloads < max_downloads").
+			UpdateColumn("downloads", gorm.Expr("downloads + 1"))
+		if result.Error != nil {
+			return fmt.Errorf("error while updating share: %v", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return refuseShare(share, models.ShareExhausted, request, ErrShareExhausted)
+		}
+		share.Downloads++
+	}
+	return recordShareAccess(share, outcome, request)
+}
+
+// refuseShare records a refused access to a share and returns the error explaining it.
+func refuseShare(share *models.Share, outcome string, request ShareRequest, reason error) error {
+	if err := recordShareAccess(share, outcome, request); err != nil {
+		slog.Error("Error recording access to share", "share_id", share.ID, "error", err)
+	}
+	return reason
+}
+
+// recordShareAccess appends an access to the log of a share and updates its last access time.
+func recordShareAccess(share *models.Share, outcome string, request ShareRequest) error {
+	now := time.Now()
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		access := &models.ShareAccess{
+			ShareID:    share.ID,
+			Outcome:    outcome,
+			RemoteAddr: request.RemoteAddr,
+			UserAgent:  request.UserAgent,
+			AccessedAt: now,
+		}
+		if err := tx.Create(access).Error; err != nil {
+			return err
+		}
+		return tx.Model(share).UpdateColumn("last_access_at", now).Error
+	})
+	if err != nil {
+		return fmt.Errorf("error while recording share access: %v", err)
+	}
+	share.LastAccessAt = &now
+	return nil
+}
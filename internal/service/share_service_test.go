@@ -0,0 +1,199 @@
+package service
+
+import (
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"github.com/google/uuid"
+	"slices"
+	"testing"
+	"time"
+)
+
+// sharedDocument creates an available document to share.
+func sharedDocument(t *testing.T) *models.Document {
+	t.Helper()
+	document := &models.Document{Name: "contract.pdf", IdFile: uuid.New(), Size: 1024, MimeType: "application/pdf"}
+	if err := config.DB.Create(document).Error; err != nil {
+		t.Fatalf("error creating document: %v", err)
+	}
+	return document
+}
+
+// newShare creates a share of a document with the given options and returns it with its token.
+func newShare(t *testing.T, document *models.Document, options ShareOptions) (*models.Share, string) {
+	t.Helper()
+	share, token, err := CreateShare(document, "alice", options)
+	if err != nil {
+		t.Fatalf("CreateShare: %v", err)
+	}
+	return share, token
+}
+
+// shareOutcomes returns the outcomes recorded in the log of a share, the oldest first.
+func shareOutcomes(t *testing.T, share *models.Share) []string {
+	t.Helper()
+	accesses, err := GetShareAccesses(share)
+	if err != nil {
+		t.Fatalf("GetShareAccesses: %v", err)
+	}
+	outcomes := make([]string, len(accesses))
+	for i, access := range accesses {
+		outcomes[len(accesses)-1-i] = access.Outcome
+	}
+	return outcomes
+}
+
+func TestCreateShareStoresHashesOnly(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		document := sharedDocument(t)
+		share, token := newShare(t, document, ShareOptions{Password: "s3cret"})
+		if share.TokenHash == token || share.PasswordHash == "" || share.PasswordHash == "s3cret" || token[:len(share.Prefix)] != share.Prefix {
+			t.Errorf("stored share %+v for %s, want the hashes and the prefix only", share, token)
+		}
+
+		// The options are checked
+		past, zero := time.Now().Add(-time.Minute), 0
+		for _, options := range []ShareOptions{
+			{ExpiresAt: &past},
+			{MaxDownloads: &zero},
+			{Password: string(make([]byte, maxSharePassword+1))},
+		} {
+			if _, _, err := CreateShare(document, "alice", options); !errors.Is(err, ErrInvalidShare) {
+				t.Errorf("CreateShare(%+v): %v, want ErrInvalidShare", options, err)
+			}
+		}
+	})
+}
+
+func TestOpenShareChecksExpiryAndRevocation(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		document := sharedDocument(t)
+		if _, _, err := OpenShare("unknown-token", ShareRequest{}); !errors.Is(err, ErrShareNotFound) {
+			t.Errorf("OpenShare of an unknown token: %v, want ErrShareNotFound", err)
+		}
+
+		// An open share gives the document
+		expiry := time.Now().Add(time.Hour)
+		share, token := newShare(t, document, ShareOptions{ExpiresAt: &expiry})
+		if _, shared, err := OpenShare(token, ShareRequest{}); err != nil || shared.ID != document.ID {
+			t.Fatalf("OpenShare = %v, %v; want document %d", shared, err, document.ID)
+		}
+
+		// Once expired, the share is gone
+		if err := config.DB.Model(share).Update("expires_at", time.Now().Add(-time.Second)).Error; err != nil {
+			t.Fatalf("error expiring share: %v", err)
+		}
+		if _, _, err := OpenShare(token, ShareRequest{}); !errors.Is(err, ErrShareExpired) {
+			t.Errorf("OpenShare of an expired share: %v, want ErrShareExpired", err)
+		}
+
+		// A revoked share is refused as an unknown one, revoking it again does nothing
+		revoked, revokedToken := newShare(t, document, ShareOptions{})
+		if err := RevokeShare(revoked); err != nil {
+			t.Fatalf("RevokeShare: %v", err)
+		}
+		revokedAt := *revoked.RevokedAt
+		if err := RevokeShare(revoked); err != nil || !revoked.RevokedAt.Equal(revokedAt) {
+			t.Errorf("RevokeShare of a revoked share: %v, revoked at %v, want %v", err, revoked.RevokedAt, revokedAt)
+		}
+		if _, _, err := OpenShare(revokedToken, ShareRequest{}); !errors.Is(err, ErrShareNotFound) {
+			t.Errorf("OpenShare of a revoked share: %v, want ErrShareNotFound", err)
+		}
+
+		// A document moved to the trash is not shared anymore
+		trashed, trashedToken := newShare(t, sharedDocument(t), ShareOptions{})
+		if err := config.DB.Delete(&models.Document{}, trashed.DocumentID).Error; err != nil {
+			t.Fatalf("error deleting document: %v", err)
+		}
+		if _, _, err := OpenShare(trashedToken, ShareRequest{}); !errors.Is(err, ErrShareNotFound) {
+			t.Errorf("OpenShare of a share of a deleted document: %v, want ErrShareNotFound", err)
+		}
+
+		// The refused accesses are logged
+		if outcomes := shareOutcomes(t, share); !slices.Equal(outcomes, []string{models.ShareExpired}) {
+			t.Errorf("log of the expired share = %v", outcomes)
+		}
+		if outcomes := shareOutcomes(t, revoked); !slices.Equal(outcomes, []string{models.ShareRevoked}) {
+			t.Errorf("log of the revoked share = %v", outcomes)
+		}
+	})
+}
+
+func TestOpenShareChecksPassword(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		share, token := newShare(t, sharedDocument(t), ShareOptions{Password: "s3cret"})
+		for _, password := range []string{"", "wrong", "S3CRET"} {
+			if _, _, err := OpenShare(token, ShareRequest{Password: password}); !errors.Is(err, ErrSharePassword) {
+				t.Errorf("OpenShare with password %q: %v, want ErrSharePassword", password, err)
+			}
+		}
+		if _, _, err := OpenShare(token, ShareRequest{Password: "s3cret"}); err != nil {
+			t.Errorf("OpenShare with the password: %v", err)
+		}
+		want := []string{models.SharePasswordRequired, models.SharePasswordRequired, models.SharePasswordRequired}
+		if outcomes := shareOutcomes(t, share); !slices.Equal(outcomes, want) {
+			t.Errorf("log of the share = %v, want %v", outcomes, want)
+		}
+	})
+}
+
+func TestRecordShareAccessCountsFullDownloadsOnly(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		maxDownloads := 2
+		share, token := newShare(t, sharedDocument(t), ShareOptions{MaxDownloads: &maxDownloads})
+
+		// The accesses without the whole content do not count
+		for range 3 {
+			opened, _, err := OpenShare(token, ShareRequest{})
+			if err != nil {
+				t.Fatalf("OpenShare: %v", err)
+			}
+			if err := RecordShareAccess(opened, ShareRequest{Download: false}); err != nil {
+				t.Fatalf("RecordShareAccess: %v", err)
+			}
+		}
+
+		// Two clients open the share before the last download: the second one is refused
+		opened, _, err := OpenShare(token, ShareRequest{})
+		if err != nil {
+			t.Fatalf("OpenShare: %v", err)
+		}
+		if err := RecordShareAccess(opened, ShareRequest{Download: true}); err != nil || opened.Downloads != 1 {
+			t.Fatalf("RecordShareAccess = %v, downloads %d; want 1", err, opened.Downloads)
+		}
+		first, _, err := OpenShare(token, ShareRequest{})
+		if err != nil {
+			t.Fatalf("OpenShare: %v", err)
+		}
+		second, _, err := OpenShare(token, ShareRequest{})
+		if err != nil {
+			t.Fatalf("OpenShare: %v", err)
+		}
+		if err := RecordShareAccess(first, ShareRequest{Download: true}); err != nil {
+			t.Fatalf("RecordShareAccess of the last download: %v", err)
+		}
+		if err := RecordShareAccess(second, ShareRequest{Download: true}); !errors.Is(err, ErrShareExhausted) {
+			t.Errorf("RecordShareAccess after the last download: %v, want ErrShareExhausted", err)
+		}
+
+		// From then on the share is exhausted
+		if _, _, err := OpenShare(token, ShareRequest{}); !errors.Is(err, ErrShareExhausted) {
+			t.Errorf("OpenShare of an exhausted share: %v, want ErrShareExhausted", err)
+		}
+		stored, err := GetShare(&models.Document{ID: share.DocumentID}, share.ID)
+		if err != nil {
+			t.Fatalf("GetShare: %v", err)
+		}
+		if stored.Downloads != maxDownloads || stored.LastAccessAt == nil {
+			t.Errorf("stored share: %d downloads, last access %v; want %d and a time", stored.Downloads, stored.LastAccessAt, maxDownloads)
+		}
+		want := []string{
+			models.ShareInspected, models.ShareInspected, models.ShareInspected,
+			models.ShareDownloaded, models.ShareDownloaded, models.ShareExhausted, models.ShareExhausted,
+		}
+		if outcomes := shareOutcomes(t, share); !slices.Equal(outcomes, want) {
+			t.Errorf("log of the share = %v, want %v", outcomes, want)
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"fileserver/config"
+	"fileserver/internal/models"
+	"fmt"
+)
+
+// DocumentStats holds the number and the total size of a set of documents.
+type DocumentStats struct {
+	Documents int64 // Number of documents
+	Bytes     int64 // Total size of their current contents, in bytes
+}
+
+// GetDocumentStats counts the stored documents and the size of their current contents, separating the
+// documents in the trash from the available ones. The pending uploads are not counted.
+//
+// Returns:
+// - DocumentStats: The documents that are not in the trash.
+// - DocumentStats: The documents in the trash.
+// - error: An error is returned if the documents cannot be counted.
+func GetDocumentStats() (DocumentStats, DocumentStats, error) {
+	var available, trashed DocumentStats
+	err := config.DB.Model(&models.Document{}).Scopes(availableDocuments).
+		Select("COUNT(*) AS documents, COALESCE(SUM(size), 0) AS bytes").
+		Scan(&available).Error
+	if err != nil {
+		return available, trashed, fmt.Errorf("error counting documents: %v", err)
+	}
+	err = config.DB.Unscoped().Model(&models.Document{}).
+		Where("deleted_at IS NOT NULL AND status = ?", models.DocumentAvailable).
+		Select("COUNT(*) AS documents, COALESCE(SUM(size), 0) AS bytes").
+		Scan(&trashed).Error
+	if err != nil {
+		return available, trashed, fmt.Errorf("error counting documents in trash: %v", err)
+	}
+	return available, trashed, nil
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"fileserver/config"
+	"fileserver/internal/storage"
+	"fileserver/internal/utils"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"log/slog"
+)
+
+// stagingKeyPrefix is the prefix of the storage keys where uploads are written before becoming blobs.
+const stagingKeyPrefix = "uploads/"
+
+// StagingKey returns the storage key where an upload is written before its fingerprint is known.
+//
+// Parameters:
+// - id (uuid.UUID): The unique identifier of the upload.
+//
+// Returns:
+// - string: The staging key of the upload.
+func StagingKey(id uuid.UUID) string {
+	return stagingKeyPrefix + id.String()
+}
+
+// GetFileFromStorage retrieves a file from the configured storage backend.
+// It returns the file object if found, or an error if there is an issue with fetching the file.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - objectName (string): The name of the object (file) to retrieve from the storage.
+//
+// Returns:
+// - storage.Object: The file object retrieved from the storage. It must be closed by the caller.
+// - error: An error is returned if there is an issue fetching the object from the storage.
+func GetFileFromStorage(ctx context.Context, objectName string) (storage.Object, error) {
+	// Fetch the object from the storage backend using the provided object name
+	object, err := config.Store.Get(ctx, objectName)
+	if err != nil {
+		// Return error if there is any issue in fetching the object
+		return nil, fmt.Errorf("error getting object from storage: %w", err)
+	}
+	// Return the fetched object if successful
+	return object, nil
+}
+
+// UploadFileToStorage streams content to the configured storage backend under the specified object name.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - objectName (string): The name of the object (file) in the storage.
+// - content (io.Reader): The content of the file, read until EOF.
+// - size (int64): The size of the content in bytes, or -1 if it is not known in advance.
+//
+// Returns:
+// - error: An error is returned if there is any issue during file upload.
+func UploadFileToStorage(ctx context.Context, objectName string, content io.Reader, size int64) error {
+	// Upload the content to the storage backend
+	if _, err := config.Store.Put(ctx, objectName, content, size, "application/octet-stream"); err != nil {
+		// Return error if uploading the file fails
+		return fmt.Errorf("failed to upload file: %v", err)
+	}
+	// Return nil if the file is successfully uploaded
+	return nil
+}
+
+// FingerprintObject reads an object back from the configured storage backend to calculate the fingerprint
+// of its content, for the uploads that were not streamed through the server in a single piece.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - objectName (string): The name of the object (file) to fingerprint.
+//
+// Returns:
+// - string: The fingerprint of the content, with the configured algorithm.
+// - int64: The size of the content in bytes.
+// - error: An error is returned if the object cannot be read.
+func FingerprintObject(ctx context.Context, objectName string) (string, int64, error) {
+	object, err := GetFileFromStorage(ctx, objectName)
+	if err != nil {
+		return "", 0, err
+	}
+	defer object.Close()
+
+	// Hash the whole content of the object
+	content, err := utils.NewFingerprintReader(object, config.App.Upload.FingerprintAlgorithm())
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := io.Copy(io.Discard, content); err != nil {
+		return "", 0, fmt.Errorf("error calculating fingerprint: %v", err)
+	}
+	return content.Fingerprint(), content.Size(), nil
+}
+
+// DetectObjectMimeType detects the MIME type of an object of the configured storage backend from its first
+// bytes and the name of the file, for the uploads that were not streamed through the server in a single piece.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - objectName (string): The name of the object (file) in the storage.
+// - filename (string): The name of the file, used for its extension.
+//
+// Returns:
+// - string: The detected MIME type.
+// - error: An error is returned if the object cannot be read.
+func DetectObjectMimeType(ctx context.Context, objectName, filename string) (string, error) {
+	object, err := GetFileFromStorage(ctx, objectName)
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	// Only the head of the content is needed
+	head, err := io.ReadAll(io.LimitReader(object, utils.SniffLength))
+	if err != nil {
+		return "", fmt.Errorf("error reading object: %v", err)
+	}
+	return utils.DetectMimeType(head, filename), nil
+}
+
+// DeleteFileFromStorage removes a file from the configured storage backend.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - objectName (string): The name of the object (file) to delete.
+//
+// Returns:
+// - error: An error is returned if there is an issue deleting the file from the storage.
+func DeleteFileFromStorage(ctx context.Context, objectName string) error {
+	// Remove the object from the storage backend
+	if err := config.Store.Delete(ctx, objectName); err != nil {
+		// Return error if deleting the object fails
+		return fmt.Errorf("error deleting object from storage: %v", err)
+	}
+	// Log success message after deletion
+	slog.DebugContext(ctx, "File deleted from storage", "key", objectName)
+	// Return nil if file is deleted successfully
+	return nil
+}
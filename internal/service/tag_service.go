@@ -0,0 +1,136 @@
+package service
+
+import (
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+)
+
+// maxTagLength is the maximum length of a tag name.
+const maxTagLength = 64
+
+// ErrTagNotFound is returned when a tag is not attached to a document.
+var ErrTagNotFound = errors.New("tag not found")
+
+// TagCount is a tag together with the number of documents using it.
+type TagCount struct {
+	Name  string `json:"name"`  // Name of the tag
+	Count int64  `json:"count"` // Number of documents (not in the trash) with the tag
+}
+
+// NormalizeTag trims and lower cases a tag name, so that "Project X" and "project x" are the same tag.
+//
+// Parameters:
+// - name (string): The tag name as sent by the client.
+//
+// Returns:
+// - string: The normalized tag name.
+// - error: An error is returned if the name is empty, too long or contains a slash or a comma.
+func NormalizeTag(name string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	switch {
+	case normalized == "":
+		return "", fmt.Errorf("tag name cannot be empty")
+	case len(normalized) > maxTagLength:
+		return "", fmt.Errorf("tag %q is longer than %d characters", name, maxTagLength)
+	case strings.ContainsAny(normalized, "/,"):
+		return "", fmt.Errorf("tag %q cannot contain slashes or commas", name)
+	}
+	return normalized, nil
+}
+
+// AddTags attaches tags to a document, creating the tags that do not exist yet.
+// Tags already attached to the document are ignored.
+//
+// Parameters:
+// - document (*models.Document): The document to tag. Its Tags are reloaded with all the tags attached.
+// - names ([]string): The names of the tags, already normalized.
+//
+// Returns:
+// - error: An error is returned if the tags cannot be saved.
+func AddTags(document *models.Document, names []string) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		// Step 1: Create the missing tags
+		tags := make([]models.Tag, len(names))
+		for i, name := range names {
+			tags[i] = models.Tag{Name: name}
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+			return fmt.Errorf("error while adding tags: %v", err)
+		}
+		if err := tx.Where("name IN ?", names).Find(&tags).Error; err != nil {
+			return fmt.Errorf("error while retrieving tags: %v", err)
+		}
+
+		// Step 2: Attach them to the document
+		if err := tx.Model(document).Omit("Tags.*").Association("Tags").Append(tags); err != nil {
+			return fmt.Errorf("error while tagging document: %v", err)
+		}
+		return loadTags(tx, document)
+	})
+}
+
+// RemoveTag detaches a tag from a document.
+//
+// Parameters:
+// - document (*models.Document): The document to untag. Its Tags are reloaded with the remaining tags.
+// - name (string): The name of the tag, already normalized.
+//
+// Returns:
+// - error: ErrTagNotFound if the tag is not attached to the document, or a database error.
+func RemoveTag(document *models.Document, name string) error {
+	var tag models.Tag
+	if err := config.DB.Where("name = ?", name).First(&tag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %s", ErrTagNotFound, name)
+		}
+		return fmt.Errorf("error while retrieving tag: %v", err)
+	}
+
+	result := config.DB.Exec("DELETE FROM document_tags WHERE document_id = ? AND tag_id = ?", document.ID, tag.ID)
+	if result.Error != nil {
+		return fmt.Errorf("error while untagging document: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrTagNotFound, name)
+	}
+	return loadTags(config.DB, document)
+}
+
+// GetTags retrieves the tags used by at least one document, with the number of documents using them.
+// Documents in the trash, and the ones the caller cannot read, are not counted.
+//
+// Parameters:
+// - caller (*Principal): The caller listing the tags, nil to count all the documents.
+//
+// Returns:
+// - []TagCount: The tags and their usage counts, ordered by name.
+// - error: An error is returned if there is an issue with retrieving the tags from the database.
+func GetTags(caller *Principal) ([]TagCount, error) {
+	var tags []TagCount
+	err := config.DB.Table("tags").
+		Select("tags.name AS name, COUNT(documents.id) AS count").
+		Joins("JOIN document_tags ON document_tags.tag_id = tags.id").
+		Joins("JOIN documents ON documents.id = document_tags.document_id").
+		Scopes(availableDocuments, visibleDocuments(caller)).
+		Group("tags.name").
+		Order("tags.name").
+		Scan(&tags).Error
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving tags: %v", err)
+	}
+	return tags, nil
+}
+
+// loadTags reloads the tags attached to a document.
+func loadTags(tx *gorm.DB, document *models.Document) error {
+	document.Tags = nil
+	if err := tx.Model(document).Order("name").Association("Tags").Find(&document.Tags); err != nil {
+		return fmt.Errorf("error while retrieving tags: %v", err)
+	}
+	return nil
+}
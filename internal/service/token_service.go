@@ -0,0 +1,150 @@
+package service
+
+import (
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidToken is returned when a bearer token is malformed, badly signed, expired or not meant for us.
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// tokenMethods lists the signing algorithms accepted for the bearer tokens: the asymmetric ones only, since
+// the keys come from a public JWKS.
+var tokenMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// Signing keys of the identity provider, read on first use.
+var (
+	tokenKeys     *keySet
+	tokenKeysOnce sync.Once
+)
+
+// getTokenKeys returns the signing keys of the configured identity provider.
+func getTokenKeys(jwtConfig *config.JWT) *keySet {
+	tokenKeysOnce.Do(func() {
+		tokenKeys = &keySet{file: jwtConfig.JWKSFile, url: jwtConfig.JWKSURL, interval: jwtConfig.KeysRefreshInterval()}
+	})
+	return tokenKeys
+}
+
+// AuthenticateToken validates a bearer token issued by the identity provider and maps its claims to the
+// caller: the subject claim is the identity, the roles claim gives the roles and, through roleScopes, the
+// scopes, the groups claim gives the groups matched by the ACLs.
+//
+// Parameters:
+// - token (string): The bearer token sent by the client, a signed JWT.
+//
+// Returns:
+// - *Principal: The caller the token was issued to.
+// - error: ErrInvalidToken, wrapping the reason, if the token is not valid.
+func AuthenticateToken(token string) (*Principal, error) {
+	jwtConfig := config.App.Auth.JWT
+	if jwtConfig == nil {
+		return nil, fmt.Errorf("%w: bearer tokens are not configured", ErrInvalidToken)
+	}
+	keys := getTokenKeys(jwtConfig)
+
+	// Step 1: Check the signature, the issuer, the audience and the validity period
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(tokenMethods),
+		jwt.WithIssuer(jwtConfig.Issuer),
+		jwt.WithAudience(jwtConfig.Audience),
+		jwt.WithLeeway(jwtConfig.ClockSkew()),
+		jwt.WithExpirationRequired(),
+	)
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := keys.lookup(kid)
+		if err != nil {
+			return nil, err
+		}
+		if key.alg != "" && key.alg != t.Method.Alg() {
+			return nil, fmt.Errorf("key %q is not used with %s", kid, t.Method.Alg())
+		}
+		return key.key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	// Step 2: Map the claims to the caller
+	subject, _ := claimValue(claims, jwtConfig.Subject()).(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: missing %s claim", ErrInvalidToken, jwtConfig.Subject())
+	}
+	if strings.HasPrefix(subject, APIKeySubjectPrefix) {
+		return nil, fmt.Errorf("%w: the subject %q is reserved to the API keys", ErrInvalidToken, subject)
+	}
+	roles := claimStrings(claimValue(claims, jwtConfig.Roles()))
+	return &Principal{
+		Subject: subject,
+		Roles:   roles,
+		Groups:  claimStrings(claimValue(claims, jwtConfig.Groups())),
+		Scopes:  roleScopes(roles, jwtConfig.RoleScopes),
+	}, nil
+}
+
+// claimValue returns a claim of a token, following the dots of the name into the nested objects
+// (e.g. "realm_access.roles"); nil if it is missing.
+func claimValue(claims jwt.MapClaims, name string) any {
+	var value any = map[string]any(claims)
+	for _, part := range strings.Split(name, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[part]
+	}
+	return value
+}
+
+// claimStrings converts a claim to a list of strings: an array of strings, or a string of space separated
+// values as the standard "scope" claim.
+func claimStrings(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// roleScopes returns the scopes granted by a list of roles: the scopes mapped to each role by the
+// configuration, and the role itself when it is named as a scope.
+func roleScopes(roles []string, mapping map[string][]string) models.Scopes {
+	var scopes models.Scopes
+	grant := func(scope string) {
+		if slices.Contains(allScopes, scope) && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	for _, role := range roles {
+		grant(role)
+		for _, scope := range mapping[role] {
+			grant(scope)
+		}
+	}
+	slices.SortFunc(scopes, func(a, b string) int {
+		return slices.Index(allScopes, a) - slices.Index(allScopes, b)
+	})
+	return scopes
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Settings of the identity provider of the tests.
+const (
+	testIssuer   = "https://sso.example.com/realms/files"
+	testAudience = "fileserver"
+)
+
+// writeJWKS writes a JWKS with the public keys of the given RSA keys, by key id and restricted to RS256.
+func writeJWKS(t *testing.T, path string, keys map[string]*rsa.PrivateKey) {
+	t.Helper()
+	var jwks []map[string]string
+	for kid, key := range keys {
+		jwks = append(jwks, map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	data, err := json.Marshal(map[string]any{"keys": jwks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// useIdentityProvider configures the bearer tokens of an identity provider signing with a new RSA key,
+// published with id "signing" in a JWKS file, and returns the key. The roles are read from the nested
+// realm_access.roles claim, the "editor" role grants the write scope.
+func useIdentityProvider(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksFile, map[string]*rsa.PrivateKey{"signing": key})
+
+	useAuth(t, &config.Auth{JWT: &config.JWT{
+		JWKSFile:   jwksFile,
+		Issuer:     testIssuer,
+		Audience:   testAudience,
+		RolesClaim: "realm_access.roles",
+		RoleScopes: map[string][]string{"editor": {models.ScopeWrite}},
+	}})
+	// The keys are read once per process: start from an empty set and drop it at the end
+	tokenKeysOnce, tokenKeys = sync.Once{}, nil
+	t.Cleanup(func() { tokenKeysOnce, tokenKeys = sync.Once{}, nil })
+	return key
+}
+
+// validClaims returns the claims of a token of the test identity provider valid for an hour.
+func validClaims(subject string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":          testIssuer,
+		"aud":          []string{"account", testAudience},
+		"sub":          subject,
+		"exp":          time.Now().Add(time.Hour).Unix(),
+		"realm_access": map[string]any{"roles": []string{"editor", models.ScopeRead, "offline_access"}},
+		"groups":       []string{"finance", "ops"},
+	}
+}
+
+// sign returns a token with the given claims, signed by a key and marked with a key id.
+func sign(t *testing.T, method jwt.SigningMethod, claims jwt.MapClaims, kid string, key any) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("error signing token: %v", err)
+	}
+	return signed
+}
+
+func TestAuthenticateTokenMapsTheClaims(t *testing.T) {
+	key := useIdentityProvider(t)
+
+	principal, err := AuthenticateToken(sign(t, jwt.SigningMethodRS256, validClaims("alice"), "signing", key))
+	if err != nil {
+		t.Fatalf("AuthenticateToken: %v", err)
+	}
+	if principal.Subject != "alice" {
+		t.Errorf("subject = %q, want alice", principal.Subject)
+	}
+	if want := []string{"editor", models.ScopeRead, "offline_access"}; !slices.Equal(principal.Roles, want) {
+		t.Errorf("roles = %v, want %v", principal.Roles, want)
+	}
+	if want := (models.Scopes{models.ScopeRead, models.ScopeWrite}); !slices.Equal(principal.Scopes, want) {
+		t.Errorf("scopes = %v, want %v", principal.Scopes, want)
+	}
+	if want := []string{"finance", "ops"}; !slices.Equal(principal.Groups, want) {
+		t.Errorf("groups = %v, want %v", principal.Groups, want)
+	}
+
+	// Without roles the caller is authenticated, with no scope
+	claims := validClaims("bob")
+	delete(claims, "realm_access")
+	principal, err = AuthenticateToken(sign(t, jwt.SigningMethodRS256, claims, "signing", key))
+	if err != nil {
+		t.Fatalf("AuthenticateToken without roles: %v", err)
+	}
+	if len(principal.Scopes) != 0 {
+		t.Errorf("scopes without roles = %v, want none", principal.Scopes)
+	}
+}
+
+func TestAuthenticateTokenRejectsInvalidTokens(t *testing.T) {
+	key := useIdentityProvider(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withClaim := func(name string, value any) jwt.MapClaims {
+		claims := validClaims("alice")
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"malformed", "not-a-token"},
+		{"alg none", sign(t, jwt.SigningMethodNone, validClaims("alice"), "signing", jwt.UnsafeAllowNoneSignatureType)},
+		{"alg HS256", sign(t, jwt.SigningMethodHS256, validClaims("alice"), "signing", []byte("shared-secret"))},
+		{"alg not allowed for the key", sign(t, jwt.SigningMethodPS256, validClaims("alice"), "signing", key)},
+		{"signed by another key", sign(t, jwt.SigningMethodRS256, validClaims("alice"), "signing", otherKey)},
+		{"unknown key id", sign(t, jwt.SigningMethodRS256, validClaims("alice"), "rotated", otherKey)},
+		{"wrong issuer", sign(t, jwt.SigningMethodRS256, withClaim("iss", "https://evil.example.com"), "signing", key)},
+		{"missing issuer", sign(t, jwt.SigningMethodRS256, withClaim("iss", nil), "signing", key)},
+		{"wrong audience", sign(t, jwt.SigningMethodRS256, withClaim("aud", "another-service"), "signing", key)},
+		{"missing audience", sign(t, jwt.SigningMethodRS256, withClaim("aud", nil), "signing", key)},
+		{"expired", sign(t, jwt.SigningMethodRS256, withClaim("exp", time.Now().Add(-2*time.Minute).Unix()), "signing", key)},
+		{"missing expiration", sign(t, jwt.SigningMethodRS256, withClaim("exp", nil), "signing", key)},
+		{"not valid yet", sign(t, jwt.SigningMethodRS256, withClaim("nbf", time.Now().Add(time.Hour).Unix()), "signing", key)},
+		{"missing subject", sign(t, jwt.SigningMethodRS256, withClaim("sub", nil), "signing", key)},
+		{"subject reserved to the API keys", sign(t, jwt.SigningMethodRS256, validClaims("apikey:1"), "signing", key)},
+		{"subject of the bootstrap key", sign(t, jwt.SigningMethodRS256, validClaims("apikey:bootstrap"), "signing", key)},
+	}
+	for _, test := range tests {
+		if principal, err := AuthenticateToken(test.token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: AuthenticateToken = %+v, %v; want ErrInvalidToken", test.name, principal, err)
+		}
+	}
+
+	// An expiration within the leeway is tolerated
+	recent := withClaim("exp", time.Now().Add(-30*time.Second).Unix())
+	if _, err := AuthenticateToken(sign(t, jwt.SigningMethodRS256, recent, "signing", key)); err != nil {
+		t.Errorf("AuthenticateToken of a token expired within the leeway: %v", err)
+	}
+}
+
+func TestAuthenticateTokenWithoutConfiguration(t *testing.T) {
+	useAuth(t, &config.Auth{})
+	if _, err := AuthenticateToken("eyJhbGciOiJSUzI1NiJ9.e30.c2ln"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("AuthenticateToken without JWT configuration: %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestKeySetReadsTheRotatedKeys(t *testing.T) {
+	first, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksFile, map[string]*rsa.PrivateKey{"first": first})
+	keys := &keySet{file: jwksFile, interval: time.Hour}
+
+	// Without kid the only key of the set is used
+	if key, err := keys.lookup(""); err != nil || key.alg != "RS256" {
+		t.Fatalf("lookup without kid = %+v, %v; want the only key", key, err)
+	}
+
+	// An unknown key is looked up again, at most once a minute
+	writeJWKS(t, jwksFile, map[string]*rsa.PrivateKey{"first": first, "second": second})
+	if _, err := keys.lookup("second"); err == nil {
+		t.Errorf("the JWKS was read again right after the previous read")
+	}
+	keys.loadedAt = time.Now().Add(-minJWKSRetry)
+	if _, err := keys.lookup("second"); err != nil {
+		t.Errorf("lookup of the rotated key: %v", err)
+	}
+
+	// The keys are kept when the JWKS becomes unreadable
+	if err := os.WriteFile(jwksFile, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys.loadedAt = time.Now().Add(-time.Hour)
+	if _, err := keys.lookup("first"); err != nil {
+		t.Errorf("lookup with an unreadable JWKS: %v, want the previous keys", err)
+	}
+	if _, err := keys.lookup(""); err == nil {
+		t.Errorf("lookup without kid in a set of two keys succeeded")
+	}
+}
+
+func TestParseJWKSSkipsTheOtherKeys(t *testing.T) {
+	keys, err := parseJWKS([]byte(`{"keys": [
+		{"kty": "oct", "kid": "symmetric", "k": "c2VjcmV0"},
+		{"kty": "OKP", "kid": "encryption", "use": "enc", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+		{"kty": "OKP", "kid": "signing", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+	]}`))
+	if err != nil {
+		t.Fatalf("parseJWKS: %v", err)
+	}
+	if len(keys) != 1 || keys["signing"].key == nil {
+		t.Errorf("parseJWKS = %v, want the signing key only", keys)
+	}
+
+	for _, invalid := range []string{
+		`{"keys": []}`,
+		`{"keys": [{"kty": "oct", "k": "c2VjcmV0"}]}`,
+		`{"keys": [{"kty": "EC", "crv": "P-256", "x": "AAAA", "y": "AAAA"}]}`,
+		`{"keys": [{"kty": "EC", "crv": "P-256", "x": "` + zeros(32) + `", "y": "` + zeros(32) + `"}]}`,
+	} {
+		if _, err := parseJWKS([]byte(invalid)); err == nil {
+			t.Errorf("parseJWKS(%s) succeeded, want an error", invalid)
+		}
+	}
+}
+
+// zeros returns the base64url encoding of n zero bytes.
+func zeros(n int) string {
+	return base64.RawURLEncoding.EncodeToString(make([]byte, n))
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"log/slog"
+	"time"
+)
+
+// GetDocumentIncludingDeleted retrieves a document based on its `idFile` field, whether it is in the trash or not.
+//
+// Parameters:
+// - idFile (uuid.UUID): The unique identifier of the document to retrieve.
+//
+// Returns:
+// - *models.Document: A pointer to the document if found.
+// - error: An error is returned if the document is not found or there is a database issue.
+func GetDocumentIncludingDeleted(idFile uuid.UUID) (*models.Document, error) {
+	var document models.Document
+
+	// Perform the query without the soft delete filter
+	if err := config.DB.Unscoped().Where("id_file = ?", idFile).First(&document).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("document with idFile %v not found", idFile)
+		}
+		return nil, fmt.Errorf("error while retrieving document: %v", err)
+	}
+	return &document, nil
+}
+
+// GetTrash retrieves the documents that have been logically deleted and not purged yet and that a caller
+// can read, the most recently deleted first.
+//
+// Parameters:
+// - caller (*Principal): The caller listing the trash, nil to list all the documents.
+//
+// Returns:
+// - []models.Document: The documents in the trash.
+// - error: An error is returned if there is an issue with retrieving the documents from the database.
+func GetTrash(caller *Principal) ([]models.Document, error) {
+	var documents []models.Document
+	if err := config.DB.Unscoped().Where("deleted_at IS NOT NULL").Scopes(visibleDocuments(caller)).Order("deleted_at DESC").Find(&documents).Error; err != nil {
+		return documents, fmt.Errorf("error retrieving trash: %v", err)
+	}
+	return documents, nil
+}
+
+// RestoreDocument moves a logically deleted document out of the trash.
+//
+// Parameters:
+// - idFile (uuid.UUID): The unique identifier of the document to restore.
+//
+// Returns:
+// - error: An error is returned if the document is not in the trash or if the update fails.
+func RestoreDocument(idFile uuid.UUID) error {
+	result := config.DB.Unscoped().Model(&models.Document{}).
+		Where("id_file = ? AND deleted_at IS NOT NULL", idFile).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return fmt.Errorf("error while restoring document: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("document with idFile %v not found in trash", idFile)
+	}
+	return nil
+}
+
+// PurgeTrash permanently deletes the documents moved to the trash before the given time, and removes the
+// staged uploads older than it that have never become documents (e.g. interrupted uploads or presigned
+// uploads never confirmed).
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation.
+// - before (time.Time): Documents deleted before this time are purged.
+//
+// Returns:
+// - int: The number of documents purged.
+// - error: The first error encountered; the purge goes on with the other documents anyway.
+func PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	var documents []models.Document
+	if err := config.DB.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Find(&documents).Error; err != nil {
+		return 0, fmt.Errorf("error retrieving expired documents: %v", err)
+	}
+
+	// Presigned uploads never confirmed are dropped with the trash
+	var pending []models.Document
+	if err := config.DB.Where("status = ? AND created_at < ?", models.DocumentPending, before).Find(&pending).Error; err != nil {
+		return 0, fmt.Errorf("error retrieving abandoned pending documents: %v", err)
+	}
+	documents = append(documents, pending...)
+
+	var firstErr error
+	purged := 0
+	for _, document := range documents {
+		if err := PurgeDocument(ctx, document.IdFile); err != nil {
+			slog.ErrorContext(ctx, "Error purging document", "document_id", document.IdFile, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		purged++
+	}
+
+	// Remove the abandoned staged uploads
+	staged, err := config.Store.List(ctx, stagingKeyPrefix)
+	if err != nil && firstErr == nil {
+		firstErr = err
+	}
+	for _, object := range staged {
+		if object.LastModified.Before(before) {
+			if err := config.Store.Delete(ctx, object.Key); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return purged, firstErr
+}
+
+// StartTrashPurger runs PurgeTrash in background every interval, purging the documents that stayed in the
+// trash longer than the retention, until ctx is cancelled. The resumable uploads left untouched for longer
+// than the retention are terminated as well.
+//
+// Parameters:
+// - ctx (context.Context): The context whose cancellation stops the purger.
+// - interval (time.Duration): The time between two purges.
+// - retention (time.Duration): How long a document stays in the trash before being purged.
+func StartTrashPurger(ctx context.Context, interval, retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purged, err := PurgeTrash(ctx, time.Now().Add(-retention))
+				if err != nil {
+					slog.ErrorContext(ctx, "Error purging trash", "error", err)
+				}
+				if purged > 0 {
+					slog.InfoContext(ctx, "Purged documents from trash", "count", purged)
+				}
+				expired, err := PurgeExpiredUploads(ctx, time.Now().Add(-retention))
+				if err != nil {
+					slog.ErrorContext(ctx, "Error purging expired uploads", "error", err)
+				}
+				if expired > 0 {
+					slog.InfoContext(ctx, "Purged expired uploads", "count", expired)
+				}
+			}
+		}
+	}()
+}
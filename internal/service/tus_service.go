@@ -0,0 +1,469 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"fileserver/internal/storage"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"hash"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned by the resumable upload functions.
+var (
+	ErrUploadNotFound        = errors.New("upload not found")
+	ErrUploadLocked          = errors.New("upload is being written by another request")
+	ErrOffsetMismatch        = errors.New("upload offset does not match")
+	ErrUploadTooLarge        = errors.New("upload exceeds its length")
+	ErrChecksumMismatch      = errors.New("checksum mismatch")
+	ErrChecksumNotSupported  = errors.New("checksum algorithm not supported")
+	ErrMultipartNotSupported = errors.New("storage backend does not support multipart uploads")
+)
+
+// Constants for the resumable uploads.
+const (
+	tusKeyPrefix = "tus/"   // Prefix of the storage keys of the resumable uploads
+	tusPartSize  = 16 << 20 // Size of the multipart parts written by the resumable uploads (16 MiB)
+)
+
+// ChecksumAlgorithms lists the algorithms accepted in the Upload-Checksum header of a resumable upload.
+var ChecksumAlgorithms = []string{"md5", "sha1", "sha256"}
+
+// uploadLocks holds a mutex for every upload being written, so that concurrent PATCH requests on the
+// same upload cannot interleave their parts.
+var uploadLocks sync.Map
+
+// CreateUpload starts a new resumable upload of the given length.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - name (string): The name of the file being uploaded.
+// - metadata (string): The raw Upload-Metadata header, kept to be returned on HEAD requests.
+// - length (int64): The total size of the upload in bytes.
+// - duplicates (string): The policy applied to byte-identical content when the upload completes.
+// - owner (string): The identity of the caller, owner of the document created at the end; empty if anonymous.
+// - folderID (*uint): The folder of the document created at the end, nil for the root.
+//
+// Returns:
+// - *models.Upload: The upload created. An empty upload is completed right away.
+// - error: ErrMultipartNotSupported if the storage cannot assemble parts, or any error during the creation.
+func CreateUpload(ctx context.Context, name, metadata string, length int64, duplicates, owner string, folderID *uint) (*models.Upload, error) {
+	multipart, ok := config.Store.(storage.Multipart)
+	if !ok {
+		return nil, ErrMultipartNotSupported
+	}
+
+	// Start the multipart upload in the storage
+	idUpload := uuid.New()
+	key := tusKeyPrefix + idUpload.String()
+	multipartID, err := multipart.NewMultipartUpload(ctx, key, "application/octet-stream")
+	if err != nil {
+		return nil, err
+	}
+
+	// Save the upload to database
+	upload := &models.Upload{
+		IdUpload:    idUpload,
+		Name:        name,
+		Metadata:    metadata,
+		Length:      length,
+		ObjectKey:   key,
+		MultipartID: multipartID,
+		Duplicates:  duplicates,
+		Owner:       owner,
+		FolderID:    folderID,
+	}
+	if err := config.DB.Create(upload).Error; err != nil {
+		_ = multipart.AbortMultipartUpload(ctx, key, multipartID)
+		return nil, fmt.Errorf("error while adding upload: %v", err)
+	}
+
+	// An empty upload is complete as soon as it is created
+	if upload.Completed() {
+		if _, err := finishUpload(ctx, multipart, upload); err != nil {
+			return upload, err
+		}
+	}
+	return upload, nil
+}
+
+// GetUpload retrieves a resumable upload, with its parts, based on its identifier.
+//
+// Parameters:
+// - idUpload (uuid.UUID): The unique identifier of the upload.
+//
+// Returns:
+// - *models.Upload: A pointer to the upload if found.
+// - error: ErrUploadNotFound (wrapped) if the upload does not exist, or any database error.
+func GetUpload(idUpload uuid.UUID) (*models.Upload, error) {
+	var upload models.Upload
+	if err := config.DB.Preload("Parts").Where("id_upload = ?", idUpload).First(&upload).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %v", ErrUploadNotFound, idUpload)
+		}
+		return nil, fmt.Errorf("error while retrieving upload: %v", err)
+	}
+	return &upload, nil
+}
+
+// CheckUploadAccess checks that a caller can see and write a resumable upload: only its owner can, besides
+// the administrators. The uploads created by anonymous callers are open to everyone, as their documents.
+// The uploads of the other callers are reported as not found, so that their existence is not disclosed.
+//
+// Parameters:
+// - caller (*Principal): The caller, nil when the authentication is disabled.
+// - upload (*models.Upload): The upload.
+//
+// Returns:
+// - error: ErrUploadNotFound (wrapped) if the caller does not own the upload.
+func CheckUploadAccess(caller *Principal, upload *models.Upload) error {
+	if unrestricted(caller) || upload.Owner == "" || upload.Owner == caller.Subject {
+		return nil
+	}
+	return fmt.Errorf("%w: %v", ErrUploadNotFound, upload.IdUpload)
+}
+
+// WriteUpload appends a chunk to a resumable upload. The chunk, preceded by the tail left by the previous
+// chunks, is cut in parts of tusPartSize bytes uploaded to the storage; the bytes that do not fill a part
+// become the new tail, unless the upload is complete. When a checksum is given the chunk is accepted only
+// if it matches; otherwise an interrupted chunk still saves the bytes received, so the client can resume.
+// When the last byte is received the object is assembled and a document is created, exactly as for a
+// direct upload.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - idUpload (uuid.UUID): The unique identifier of the upload.
+// - offset (int64): The offset of the chunk, which must match the offset of the upload.
+// - body (io.Reader): The content of the chunk.
+// - checksum (string): The Upload-Checksum header ("<algorithm> <base64 digest>"), or an empty string.
+//
+// Returns:
+// - *models.Upload: The upload, updated with the new offset.
+// - *models.Document: The document created if the upload completed, nil otherwise.
+// - error: An error if the chunk was rejected or could not be stored.
+func WriteUpload(ctx context.Context, idUpload uuid.UUID, offset int64, body io.Reader, checksum string) (*models.Upload, *models.Document, error) {
+	multipart, ok := config.Store.(storage.Multipart)
+	if !ok {
+		return nil, nil, ErrMultipartNotSupported
+	}
+
+	// Make sure that nobody else is writing the same upload
+	lock, _ := uploadLocks.LoadOrStore(idUpload, &sync.Mutex{})
+	if !lock.(*sync.Mutex).TryLock() {
+		return nil, nil, ErrUploadLocked
+	}
+	defer lock.(*sync.Mutex).Unlock()
+
+	upload, err := GetUpload(idUpload)
+	if err != nil {
+		return nil, nil, err
+	}
+	if offset != upload.Offset {
+		return upload, nil, fmt.Errorf("%w: expected %d, got %d", ErrOffsetMismatch, upload.Offset, offset)
+	}
+	if upload.Completed() {
+		if upload.IdFile != nil {
+			return upload, nil, nil
+		}
+		// The document could not be created when the last chunk was received: try again
+		document, err := finishUpload(ctx, multipart, upload)
+		return upload, document, err
+	}
+
+	// Prepare the verification of the checksum
+	var verifier hash.Hash
+	var expected []byte
+	if checksum != "" {
+		if verifier, expected, err = parseChecksum(checksum); err != nil {
+			return upload, nil, err
+		}
+		body = io.TeeReader(body, verifier)
+	}
+
+	// Read one byte more than the missing ones, to detect a chunk exceeding the length
+	var reader io.Reader = io.LimitReader(body, upload.Length-upload.Offset+1)
+	if upload.TailSize > 0 {
+		tail, err := config.Store.Get(ctx, upload.TailKey)
+		if err != nil {
+			return upload, nil, fmt.Errorf("error reading upload tail: %v", err)
+		}
+		defer tail.Close()
+		reader = io.MultiReader(tail, reader)
+	}
+
+	// Cut the content in parts
+	stored := upload.Offset - upload.TailSize // Bytes already stored in parts
+	number := 1
+	for _, part := range upload.Parts {
+		number = max(number, part.Number+1)
+	}
+	var parts []models.UploadPart
+	var readErr error
+	buffer := make([]byte, tusPartSize)
+	n := 0
+	for {
+		n, err = io.ReadFull(reader, buffer)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+		if stored+int64(n) > upload.Length {
+			return upload, nil, ErrUploadTooLarge
+		}
+		part, err := multipart.PutPart(ctx, upload.ObjectKey, upload.MultipartID, number, bytes.NewReader(buffer[:n]), int64(n))
+		if err != nil {
+			return upload, nil, err
+		}
+		parts = append(parts, models.UploadPart{UploadID: upload.ID, Number: part.Number, ETag: part.ETag, Size: part.Size})
+		stored += int64(n)
+		number++
+		n = 0
+	}
+
+	// The remaining bytes become the last part or the new tail
+	newOffset := stored + int64(n)
+	if newOffset > upload.Length {
+		return upload, nil, ErrUploadTooLarge
+	}
+	if readErr != nil && (verifier != nil || newOffset <= upload.Offset) {
+		// Nothing trustworthy has been received
+		return upload, nil, fmt.Errorf("error reading upload chunk: %v", readErr)
+	}
+	if newOffset == upload.Offset {
+		// An empty chunk changes nothing, the tail is kept as it is
+		if verifier != nil && !bytes.Equal(verifier.Sum(nil), expected) {
+			return upload, nil, ErrChecksumMismatch
+		}
+		return upload, nil, nil
+	}
+	tailKey, tailSize := "", int64(0)
+	if n > 0 && newOffset == upload.Length {
+		part, err := multipart.PutPart(ctx, upload.ObjectKey, upload.MultipartID, number, bytes.NewReader(buffer[:n]), int64(n))
+		if err != nil {
+			return upload, nil, err
+		}
+		parts = append(parts, models.UploadPart{UploadID: upload.ID, Number: part.Number, ETag: part.ETag, Size: part.Size})
+	} else if n > 0 {
+		tailKey, tailSize = fmt.Sprintf("%s.tail-%d", upload.ObjectKey, newOffset), int64(n)
+		if _, err := config.Store.Put(ctx, tailKey, bytes.NewReader(buffer[:n]), tailSize, "application/octet-stream"); err != nil {
+			return upload, nil, fmt.Errorf("error storing upload tail: %v", err)
+		}
+	}
+
+	// Verify the checksum of the chunk before making it visible
+	if verifier != nil && !bytes.Equal(verifier.Sum(nil), expected) {
+		if tailKey != "" {
+			_ = config.Store.Delete(ctx, tailKey)
+		}
+		return upload, nil, ErrChecksumMismatch
+	}
+
+	// Save the progress: new parts, new offset and new tail
+	previousTail := upload.TailKey
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if len(parts) > 0 {
+			if err := tx.Where("upload_id = ? AND number >= ?", upload.ID, parts[0].Number).Delete(&models.UploadPart{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&parts).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(upload).Updates(map[string]any{
+			"upload_offset": newOffset,
+			"tail_key":      tailKey,
+			"tail_size":     tailSize,
+		}).Error
+	})
+	if err != nil {
+		return upload, nil, fmt.Errorf("error while saving upload progress: %v", err)
+	}
+	upload.Offset, upload.TailKey, upload.TailSize = newOffset, tailKey, tailSize
+	upload.Parts = append(upload.Parts, parts...)
+	if previousTail != "" && previousTail != tailKey {
+		if err := config.Store.Delete(ctx, previousTail); err != nil {
+			slog.WarnContext(ctx, "Error removing upload tail", "key", previousTail, "error", err)
+		}
+	}
+	if readErr != nil {
+		return upload, nil, fmt.Errorf("upload interrupted at offset %d: %v", newOffset, readErr)
+	}
+
+	// Turn the completed upload into a document
+	if !upload.Completed() {
+		return upload, nil, nil
+	}
+	document, err := finishUpload(ctx, multipart, upload)
+	return upload, document, err
+}
+
+// finishUpload assembles the object of a completed upload, calculates its fingerprint and creates the
+// document with CreateDocument, as done for a direct upload. It can be called again after a failure: an
+// object already assembled is not assembled twice.
+func finishUpload(ctx context.Context, multipart storage.Multipart, upload *models.Upload) (*models.Document, error) {
+	// Assemble the object from its parts, unless a previous attempt already did
+	_, err := config.Store.Stat(ctx, upload.ObjectKey)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		slog.DebugContext(ctx, "Upload already assembled", "key", upload.ObjectKey)
+	} else if len(upload.Parts) == 0 {
+		// An empty upload has no parts: store an empty object instead
+		_ = multipart.AbortMultipartUpload(ctx, upload.ObjectKey, upload.MultipartID)
+		if _, err := config.Store.Put(ctx, upload.ObjectKey, bytes.NewReader(nil), 0, "application/octet-stream"); err != nil {
+			return nil, err
+		}
+	} else {
+		parts := make([]storage.Part, len(upload.Parts))
+		for i, part := range upload.Parts {
+			parts[i] = storage.Part{Number: part.Number, ETag: part.ETag, Size: part.Size}
+		}
+		sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+		if _, err := multipart.CompleteMultipartUpload(ctx, upload.ObjectKey, upload.MultipartID, parts); err != nil {
+			return nil, err
+		}
+	}
+
+	// The chunks were hashed separately, so the fingerprint is calculated reading the object back
+	fingerprint, size, err := FingerprintObject(ctx, upload.ObjectKey)
+	if err != nil {
+		return nil, err
+	}
+	mimeType, err := DetectObjectMimeType(ctx, upload.ObjectKey, upload.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the document and link it to the upload
+	document, _, err := CreateDocument(ctx, StagedFile{
+		Name:        upload.Name,
+		Key:         upload.ObjectKey,
+		Fingerprint: fingerprint,
+		Size:        size,
+		MimeType:    mimeType,
+		Uploader:    upload.Owner,
+		Owner:       upload.Owner,
+		FolderID:    upload.FolderID,
+	}, upload.Duplicates)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.DB.Model(upload).Update("id_file", document.IdFile).Error; err != nil {
+		return document, fmt.Errorf("error while updating upload: %v", err)
+	}
+	upload.IdFile = &document.IdFile
+
+	// The upload will not be written anymore
+	uploadLocks.Delete(upload.IdUpload)
+	return document, nil
+}
+
+// TerminateUpload drops a resumable upload, its parts and its tail.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - idUpload (uuid.UUID): The unique identifier of the upload.
+//
+// Returns:
+// - error: ErrUploadNotFound (wrapped) if the upload does not exist, or any error during the removal.
+func TerminateUpload(ctx context.Context, idUpload uuid.UUID) error {
+	upload, err := GetUpload(idUpload)
+	if err != nil {
+		return err
+	}
+
+	// Drop the content stored so far; a completed upload has already been assembled
+	if multipart, ok := config.Store.(storage.Multipart); ok && !upload.Completed() {
+		if err := multipart.AbortMultipartUpload(ctx, upload.ObjectKey, upload.MultipartID); err != nil {
+			slog.ErrorContext(ctx, "Error aborting upload", "upload_id", idUpload, "error", err)
+		}
+	}
+	if upload.TailKey != "" {
+		if err := config.Store.Delete(ctx, upload.TailKey); err != nil {
+			slog.WarnContext(ctx, "Error removing upload tail", "key", upload.TailKey, "error", err)
+		}
+	}
+
+	// Delete the upload and its parts
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("upload_id = ?", upload.ID).Delete(&models.UploadPart{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(upload).Error
+	})
+	if err != nil {
+		return fmt.Errorf("error while deleting upload: %v", err)
+	}
+	uploadLocks.Delete(idUpload)
+	return nil
+}
+
+// PurgeExpiredUploads terminates the resumable uploads that have not been written since the given time.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation.
+// - before (time.Time): Uploads not updated since this time are terminated.
+//
+// Returns:
+// - int: The number of uploads terminated.
+// - error: The first error encountered; the purge goes on with the other uploads anyway.
+func PurgeExpiredUploads(ctx context.Context, before time.Time) (int, error) {
+	var uploads []models.Upload
+	if err := config.DB.Where("updated_at < ?", before).Find(&uploads).Error; err != nil {
+		return 0, fmt.Errorf("error retrieving expired uploads: %v", err)
+	}
+
+	var firstErr error
+	purged := 0
+	for _, upload := range uploads {
+		if err := TerminateUpload(ctx, upload.IdUpload); err != nil {
+			slog.ErrorContext(ctx, "Error terminating upload", "upload_id", upload.IdUpload, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		purged++
+	}
+	return purged, firstErr
+}
+
+// parseChecksum parses an Upload-Checksum header and returns the hash to verify and the expected digest.
+func parseChecksum(checksum string) (hash.Hash, []byte, error) {
+	algorithm, encoded, found := strings.Cut(checksum, " ")
+	if !found {
+		return nil, nil, fmt.Errorf("%w: malformed checksum %q", ErrChecksumNotSupported, checksum)
+	}
+	expected, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: malformed checksum %q", ErrChecksumNotSupported, checksum)
+	}
+	switch algorithm {
+	case "md5":
+		return md5.New(), expected, nil
+	case "sha1":
+		return sha1.New(), expected, nil
+	case "sha256":
+		return sha256.New(), expected, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: %s", ErrChecksumNotSupported, algorithm)
+	}
+}
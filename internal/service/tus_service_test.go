@@ -0,0 +1,312 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"github.com/google/uuid"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// randomContent returns size bytes of reproducible pseudo-random content.
+func randomContent(size int) []byte {
+	content := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(content)
+	return content
+}
+
+// createUpload starts a resumable upload of the given length, failing the test on error.
+func createUpload(t *testing.T, length int64) uuid.UUID {
+	t.Helper()
+	upload, err := CreateUpload(context.Background(), "upload.bin", "", length, config.DuplicatesReject, "", nil)
+	if err != nil {
+		t.Fatalf("CreateUpload: %v", err)
+	}
+	return upload.IdUpload
+}
+
+// writeChunk sends a chunk of a resumable upload, failing the test on error.
+func writeChunk(t *testing.T, idUpload uuid.UUID, offset int64, chunk []byte) (*models.Upload, *models.Document) {
+	t.Helper()
+	upload, document, err := WriteUpload(context.Background(), idUpload, offset, bytes.NewReader(chunk), "")
+	if err != nil {
+		t.Fatalf("WriteUpload at offset %d: %v", offset, err)
+	}
+	return upload, document
+}
+
+// readDocument returns the content of a document, failing the test on error.
+func readDocument(t *testing.T, document *models.Document) []byte {
+	t.Helper()
+	object, err := config.Store.Get(context.Background(), document.Key())
+	if err != nil {
+		t.Fatalf("error opening %s: %v", document.Name, err)
+	}
+	defer object.Close()
+	content, err := io.ReadAll(object)
+	if err != nil {
+		t.Fatalf("error reading %s: %v", document.Name, err)
+	}
+	return content
+}
+
+func TestWriteUploadCutsPartsAndKeepsTail(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		content := randomContent(tusPartSize + 300)
+		idUpload := createUpload(t, int64(len(content)))
+
+		// A chunk shorter than a part becomes the tail
+		upload, _ := writeChunk(t, idUpload, 0, content[:100])
+		if upload.Offset != 100 || upload.TailSize != 100 || len(upload.Parts) != 0 {
+			t.Fatalf("after the first chunk: offset %d, tail %d, %d parts", upload.Offset, upload.TailSize, len(upload.Parts))
+		}
+		firstTail := upload.TailKey
+		assertStored(t, firstTail, true)
+
+		// The tail and the next chunk fill a part, the rest becomes the new tail
+		upload, _ = writeChunk(t, idUpload, 100, content[100:tusPartSize+100])
+		if upload.Offset != tusPartSize+100 || upload.TailSize != 100 || len(upload.Parts) != 1 || upload.Parts[0].Size != tusPartSize {
+			t.Fatalf("after the second chunk: offset %d, tail %d, parts %+v", upload.Offset, upload.TailSize, upload.Parts)
+		}
+		secondTail := upload.TailKey
+		assertStored(t, firstTail, false)
+		assertStored(t, secondTail, true)
+
+		// An empty chunk changes nothing, and keeps the tail
+		upload, _ = writeChunk(t, idUpload, tusPartSize+100, nil)
+		if upload.Offset != tusPartSize+100 || upload.TailKey != secondTail {
+			t.Fatalf("after an empty chunk: offset %d, tail %s, want tail %s", upload.Offset, upload.TailKey, secondTail)
+		}
+		assertStored(t, secondTail, true)
+
+		// The last chunk completes the upload, which becomes a document with the whole content
+		upload, document := writeChunk(t, idUpload, tusPartSize+100, content[tusPartSize+100:])
+		if document == nil {
+			t.Fatalf("the completed upload did not create a document")
+		}
+		if upload.IdFile == nil || *upload.IdFile != document.IdFile {
+			t.Errorf("the upload is not linked to its document: %v", upload.IdFile)
+		}
+		if got := readDocument(t, document); !bytes.Equal(got, content) {
+			t.Errorf("content of the document differs from the upload (%d bytes, want %d)", len(got), len(content))
+		}
+		assertStored(t, secondTail, false)
+		if _, locked := uploadLocks.Load(idUpload); locked {
+			t.Errorf("the lock of the completed upload is still held in memory")
+		}
+
+		// Writing a completed upload again returns no new document
+		if _, document, err := WriteUpload(context.Background(), idUpload, int64(len(content)), bytes.NewReader(nil), ""); err != nil || document != nil {
+			t.Errorf("WriteUpload of a completed upload = %v, %v; want no document and no error", document, err)
+		}
+	})
+}
+
+func TestWriteUploadRejectsInvalidChunks(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		ctx := context.Background()
+		idUpload := createUpload(t, 10)
+		writeChunk(t, idUpload, 0, []byte("abcd"))
+
+		// The offset must match the bytes received so far
+		if _, _, err := WriteUpload(ctx, idUpload, 0, bytes.NewReader([]byte("abcd")), ""); !errors.Is(err, ErrOffsetMismatch) {
+			t.Errorf("WriteUpload at a stale offset: %v, want ErrOffsetMismatch", err)
+		}
+
+		// The chunk cannot go beyond the length of the upload
+		if _, _, err := WriteUpload(ctx, idUpload, 4, bytes.NewReader([]byte("efghijk")), ""); !errors.Is(err, ErrUploadTooLarge) {
+			t.Errorf("WriteUpload of a chunk too large: %v, want ErrUploadTooLarge", err)
+		}
+
+		// A chunk that does not match its checksum is dropped
+		digest := md5.Sum([]byte("other"))
+		checksum := "md5 " + base64.StdEncoding.EncodeToString(digest[:])
+		if _, _, err := WriteUpload(ctx, idUpload, 4, bytes.NewReader([]byte("efg")), checksum); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("WriteUpload with a wrong checksum: %v, want ErrChecksumMismatch", err)
+		}
+		if _, _, err := WriteUpload(ctx, idUpload, 4, bytes.NewReader([]byte("efg")), "crc32 AAAA"); !errors.Is(err, ErrChecksumNotSupported) {
+			t.Errorf("WriteUpload with an unknown checksum: %v, want ErrChecksumNotSupported", err)
+		}
+
+		// None of the rejected chunks moved the offset or left a tail behind
+		upload, err := GetUpload(idUpload)
+		if err != nil {
+			t.Fatalf("GetUpload: %v", err)
+		}
+		if upload.Offset != 4 {
+			t.Errorf("offset after the rejected chunks = %d, want 4", upload.Offset)
+		}
+		tails, err := config.Store.List(ctx, upload.ObjectKey+".tail-")
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if len(tails) != 1 || tails[0].Key != upload.TailKey {
+			t.Errorf("tails stored = %+v, want only %s", tails, upload.TailKey)
+		}
+
+		// A chunk matching its checksum is accepted
+		digest = md5.Sum([]byte("efg"))
+		checksum = "md5 " + base64.StdEncoding.EncodeToString(digest[:])
+		if upload, _, err := WriteUpload(ctx, idUpload, 4, bytes.NewReader([]byte("efg")), checksum); err != nil || upload.Offset != 7 {
+			t.Errorf("WriteUpload with the right checksum: %v", err)
+		}
+	})
+}
+
+// failingReader returns its content and then an error, as a connection dropped in the middle of a chunk.
+type failingReader struct {
+	content []byte
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.content) == 0 {
+		return 0, io.ErrClosedPipe
+	}
+	n := copy(p, r.content)
+	r.content = r.content[n:]
+	return n, nil
+}
+
+func TestWriteUploadSavesInterruptedChunk(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		content := randomContent(64)
+		idUpload := createUpload(t, int64(len(content)))
+
+		// The bytes received before the interruption are kept, so that the client can resume
+		upload, _, err := WriteUpload(context.Background(), idUpload, 0, &failingReader{content: content[:40]}, "")
+		if err == nil {
+			t.Fatalf("WriteUpload of an interrupted chunk succeeded")
+		}
+		if upload.Offset != 40 {
+			t.Fatalf("offset after the interruption = %d, want 40", upload.Offset)
+		}
+		_, document := writeChunk(t, idUpload, 40, content[40:])
+		if document == nil || !bytes.Equal(readDocument(t, document), content) {
+			t.Errorf("the resumed upload did not create the document with the whole content")
+		}
+	})
+}
+
+func TestWriteUploadReportsUnfinishedDocument(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		content := randomContent(32)
+		first := createUpload(t, int64(len(content)))
+		writeChunk(t, first, 0, content)
+
+		// The same content uploaded again is a duplicate: the upload completes without a document
+		second := createUpload(t, int64(len(content)))
+		upload, document, err := WriteUpload(context.Background(), second, 0, bytes.NewReader(content), "")
+		if !errors.Is(err, ErrDuplicateDocument) || document != nil {
+			t.Fatalf("WriteUpload of a duplicate = %v, %v; want ErrDuplicateDocument", document, err)
+		}
+		if upload.Offset != int64(len(content)) || upload.IdFile != nil {
+			t.Fatalf("duplicate upload: offset %d, document %v", upload.Offset, upload.IdFile)
+		}
+
+		// Sending the last chunk again does not report the upload as finished
+		if _, document, err := WriteUpload(context.Background(), second, int64(len(content)), bytes.NewReader(nil), ""); err == nil || document != nil {
+			t.Errorf("WriteUpload of an upload without document = %v, %v; want an error", document, err)
+		}
+	})
+}
+
+func TestCreateUploadOfEmptyFile(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		upload, err := CreateUpload(context.Background(), "empty.txt", "", 0, config.DuplicatesReject, "", nil)
+		if err != nil {
+			t.Fatalf("CreateUpload: %v", err)
+		}
+		if !upload.Completed() || upload.IdFile == nil {
+			t.Fatalf("the empty upload did not complete: %+v", upload)
+		}
+		document, err := GetDocument(*upload.IdFile)
+		if err != nil {
+			t.Fatalf("GetDocument: %v", err)
+		}
+		if document.Size != 0 || len(readDocument(t, document)) != 0 {
+			t.Errorf("the document of the empty upload is not empty: %+v", document)
+		}
+	})
+}
+
+func TestWriteUploadCreatesDocumentInFolder(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		ctx := context.Background()
+		folder, err := CreateFolder("reports", nil, "")
+		if err != nil {
+			t.Fatalf("CreateFolder: %v", err)
+		}
+		upload := func(content string) *models.Upload {
+			upload, err := CreateUpload(ctx, "report.txt", "", int64(len(content)), config.DuplicatesReject, "", &folder.ID)
+			if err != nil {
+				t.Fatalf("CreateUpload: %v", err)
+			}
+			return upload
+		}
+		placed, moved := upload("in the folder"), upload("at the root")
+
+		_, document := writeChunk(t, placed.IdUpload, 0, []byte("in the folder"))
+		if document.FolderID == nil || *document.FolderID != folder.ID {
+			t.Errorf("document created in folder %v, want %d", document.FolderID, folder.ID)
+		}
+
+		// The uploads towards a deleted folder create their documents at the root
+		if _, err := DeleteFolder(folder, true); err != nil {
+			t.Fatalf("DeleteFolder: %v", err)
+		}
+		_, document = writeChunk(t, moved.IdUpload, 0, []byte("at the root"))
+		if document.FolderID != nil {
+			t.Errorf("document of an upload towards a deleted folder created in folder %d", *document.FolderID)
+		}
+	})
+}
+
+func TestTerminateUploadDropsTail(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		idUpload := createUpload(t, 100)
+		upload, _ := writeChunk(t, idUpload, 0, []byte("partial"))
+		if err := TerminateUpload(context.Background(), idUpload); err != nil {
+			t.Fatalf("TerminateUpload: %v", err)
+		}
+		if _, err := GetUpload(idUpload); !errors.Is(err, ErrUploadNotFound) {
+			t.Errorf("GetUpload of a terminated upload: %v, want ErrUploadNotFound", err)
+		}
+		assertStored(t, upload.TailKey, false)
+		if _, locked := uploadLocks.Load(idUpload); locked {
+			t.Errorf("the lock of the terminated upload is still held in memory")
+		}
+		if _, _, err := WriteUpload(context.Background(), idUpload, 7, bytes.NewReader([]byte("more")), ""); !errors.Is(err, ErrUploadNotFound) {
+			t.Errorf("WriteUpload of a terminated upload: %v, want ErrUploadNotFound", err)
+		}
+	})
+}
+
+func TestCheckUploadAccess(t *testing.T) {
+	owned := &models.Upload{IdUpload: uuid.New(), Owner: "apikey:1"}
+	anonymous := &models.Upload{IdUpload: uuid.New()}
+	owner := &Principal{Subject: "apikey:1", Scopes: models.Scopes{models.ScopeWrite}}
+	other := &Principal{Subject: "apikey:2", Scopes: models.Scopes{models.ScopeWrite}}
+	admin := &Principal{Subject: "apikey:3", Scopes: models.Scopes{models.ScopeAdmin}}
+
+	if err := CheckUploadAccess(owner, owned); err != nil {
+		t.Errorf("owner denied: %v", err)
+	}
+	if err := CheckUploadAccess(admin, owned); err != nil {
+		t.Errorf("administrator denied: %v", err)
+	}
+	if err := CheckUploadAccess(nil, owned); err != nil {
+		t.Errorf("caller without authentication denied: %v", err)
+	}
+	if err := CheckUploadAccess(other, anonymous); err != nil {
+		t.Errorf("anonymous upload denied: %v", err)
+	}
+	if err := CheckUploadAccess(other, owned); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("upload of another caller: %v, want ErrUploadNotFound", err)
+	}
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fileserver/config"
+	"fileserver/internal/models"
+	"fmt"
+	"gorm.io/gorm"
+)
+
+// ErrVersionNotFound is returned when a document has no version with the requested number.
+var ErrVersionNotFound = errors.New("version not found")
+
+// GetVersions retrieves the versions of a document, from the oldest to the newest.
+// Documents uploaded before versioning get their first version recorded here.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - document (*models.Document): The document whose versions are retrieved.
+//
+// Returns:
+// - []models.DocumentVersion: The versions of the document, ordered by number.
+// - error: An error is returned if there is an issue with retrieving the versions from the database.
+func GetVersions(ctx context.Context, document *models.Document) ([]models.DocumentVersion, error) {
+	if err := ensureVersions(ctx, config.DB, document); err != nil {
+		return nil, err
+	}
+
+	var versions []models.DocumentVersion
+	if err := config.DB.Where("document_id = ?", document.ID).Order("number").Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("error retrieving versions: %v", err)
+	}
+	return versions, nil
+}
+
+// GetVersion retrieves a version of a document by its number.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - document (*models.Document): The document the version belongs to.
+// - number (int): The number of the version, starting from 1.
+//
+// Returns:
+// - *models.DocumentVersion: A pointer to the version if found.
+// - error: ErrVersionNotFound if the document has no such version, or a database error.
+func GetVersion(ctx context.Context, document *models.Document, number int) (*models.DocumentVersion, error) {
+	if err := ensureVersions(ctx, config.DB, document); err != nil {
+		return nil, err
+	}
+
+	var version models.DocumentVersion
+	if err := config.DB.Where("document_id = ? AND number = ?", document.ID, number).First(&version).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: document %v has no version %d", ErrVersionNotFound, document.IdFile, number)
+		}
+		return nil, fmt.Errorf("error while retrieving version: %v", err)
+	}
+	return &version, nil
+}
+
+// AddVersion stores a staged file as the new current version of a document. The content is moved to the
+// blob of its fingerprint and referenced by the new version, the older versions are kept untouched.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - document (*models.Document): The document to update. It is updated in place with the new version.
+// - staged (StagedFile): The uploaded content of the new version.
+//
+// Returns:
+// - *models.DocumentVersion: The new version.
+// - error: An error is returned if the content cannot be stored or the version cannot be saved.
+func AddVersion(ctx context.Context, document *models.Document, staged StagedFile) (*models.DocumentVersion, error) {
+	// Store the content once, under its fingerprint
+	blob, err := AcquireBlob(ctx, staged.Key, staged.Fingerprint, staged.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	version := &models.DocumentVersion{
+		ObjectKey:   blob.ObjectKey,
+		Size:        staged.Size,
+		Fingerprint: staged.Fingerprint,
+		MimeType:    staged.MimeType,
+		BlobID:      &blob.ID,
+	}
+	if err := appendVersion(ctx, document, version); err != nil {
+		// Give the reference back, the version does not exist
+		if releaseErr := ReleaseBlob(ctx, blob.ID); releaseErr != nil {
+			return nil, fmt.Errorf("%v (release blob: %v)", err, releaseErr)
+		}
+		return nil, err
+	}
+	return version, nil
+}
+
+// RestoreVersion rolls a document back to one of its versions. The history is never rewritten: the content
+// of the restored version becomes a new version, so the rollback itself can be undone.
+//
+// Parameters:
+// - ctx (context.Context): The context for the operation (to control request lifetime).
+// - document (*models.Document): The document to roll back. It is updated in place with the new version.
+// - number (int): The number of the version to restore.
+//
+// Returns:
+// - *models.DocumentVersion: The new version, with the content of the restored one.
+// - error: ErrVersionNotFound if the document has no such version, or a database/storage error.
+func RestoreVersion(ctx context.Context, document *models.Document, number int) (*models.DocumentVersion, error) {
+	restored, err := GetVersion(ctx, document, number)
+	if err != nil {
+		return nil, err
+	}
+
+	// The new version takes its own reference to the content
+	if restored.BlobID != nil {
+		if err := ReferenceBlob(*restored.BlobID); err != nil {
+			return nil, err
+		}
+	}
+
+	version := &models.DocumentVersion{
+		ObjectKey:   restored.ObjectKey,
+		Size:        restored.Size,
+		Fingerprint: restored.Fingerprint,
+		MimeType:    restored.MimeType,
+		BlobID:      restored.BlobID,
+	}
+	if err := appendVersion(ctx, document, version); err != nil {
+		if restored.BlobID != nil {
+			if releaseErr := ReleaseBlob(ctx, *restored.BlobID); releaseErr != nil {
+				return nil, fmt.Errorf("%v (release blob: %v)", err, releaseErr)
+			}
+		}
+		return nil, err
+	}
+	return version, nil
+}
+
+// appendVersion saves version as the newest version of the document and points the document to its content,
+// whose size and MIME type become the ones of the document.
+func appendVersion(ctx context.Context, document *models.Document, version *models.DocumentVersion) error {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := ensureVersions(ctx, tx, document); err != nil {
+			return err
+		}
+
+		// Number the version after the newest one
+		var last int
+		if err := tx.Model(&models.DocumentVersion{}).Where("document_id = ?", document.ID).
+			Select("COALESCE(MAX(number), 0)").Scan(&last).Error; err != nil {
+			return fmt.Errorf("error while numbering version: %v", err)
+		}
+		version.DocumentID = document.ID
+		version.Number = last + 1
+		if err := tx.Create(version).Error; err != nil {
+			return fmt.Errorf("error while adding version: %v", err)
+		}
+
+		// Make it the current version
+		if err := tx.Model(document).Updates(map[string]interface{}{
+			"object_key":  version.ObjectKey,
+			"fingerprint": version.Fingerprint,
+			"blob_id":     version.BlobID,
+			"version":     version.Number,
+			"size":        version.Size,
+			"mime_type":   version.MimeType,
+		}).Error; err != nil {
+			return fmt.Errorf("error while updating document: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	document.ObjectKey = version.ObjectKey
+	document.Fingerprint = version.Fingerprint
+	document.BlobID = version.BlobID
+	document.Version = version.Number
+	document.Size = version.Size
+	document.MimeType = version.MimeType
+
+	// Extract and index the text of the new content in background
+	scheduleIndexing(document.ID)
+	return nil
+}
+
+// ensureVersions records the current content of a document as its first version, for the documents
+// uploaded before versioning. The version takes over the blob reference held by the document.
+func ensureVersions(ctx context.Context, tx *gorm.DB, document *models.Document) error {
+	var count int64
+	if err := tx.Model(&models.DocumentVersion{}).Where("document_id = ?", document.ID).Count(&count).Error; err != nil {
+		return fmt.Errorf("error while counting versions: %v", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	// The size was not recorded by the document, ask the blob or the storage
+	version := &models.DocumentVersion{
+		DocumentID:  document.ID,
+		Number:      max(document.Version, 1),
+		ObjectKey:   document.Key(),
+		Fingerprint: document.Fingerprint,
+		MimeType:    document.MimeType,
+		BlobID:      document.BlobID,
+		CreatedAt:   document.UpdatedAt,
+	}
+	if document.BlobID != nil {
+		var blob models.Blob
+		if err := tx.First(&blob, *document.BlobID).Error; err != nil {
+			return fmt.Errorf("error while retrieving blob: %v", err)
+		}
+		version.Size = blob.Size
+	} else if info, err := config.Store.Stat(ctx, document.Key()); err == nil {
+		version.Size = info.Size
+	}
+	if err := tx.Create(version).Error; err != nil {
+		return fmt.Errorf("error while adding version: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"time"
+)
+
+// Observer is told the duration and the outcome of every operation of an instrumented backend.
+type Observer func(operation string, duration time.Duration, err error)
+
+// Instrument wraps a backend so that every operation is reported to an observer, e.g. to measure the
+// latency of the calls to MinIO. The wrapped backend keeps implementing Presigner when the backend does.
+// The backend must implement Multipart, as all the backends of this package do.
+//
+// Parameters:
+// - backend (Storage): The backend to instrument.
+// - observe (Observer): The function told about every operation.
+//
+// Returns:
+// - Storage: The instrumented backend.
+func Instrument(backend Storage, observe Observer) Storage {
+	instrumented := &instrumentedStorage{backend: backend, multipart: backend.(Multipart), observe: observe}
+	if presigner, ok := backend.(Presigner); ok {
+		return &instrumentedPresigner{instrumentedStorage: instrumented, presigner: presigner}
+	}
+	return instrumented
+}
+
+// instrumentedStorage is a Storage and Multipart backend reporting its operations to an observer.
+type instrumentedStorage struct {
+	backend   Storage
+	multipart Multipart
+	observe   Observer
+}
+
+// Put stores an object, reporting the operation.
+func (s *instrumentedStorage) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (ObjectInfo, error) {
+	start := time.Now()
+	info, err := s.backend.Put(ctx, key, reader, size, contentType)
+	s.observe("put", time.Since(start), err)
+	return info, err
+}
+
+// Get opens an object, reporting the operation. Reading the object is not measured.
+func (s *instrumentedStorage) Get(ctx context.Context, key string) (Object, error) {
+	start := time.Now()
+	object, err := s.backend.Get(ctx, key)
+	s.observe("get", time.Since(start), err)
+	return object, err
+}
+
+// Stat returns the information about an object, reporting the operation.
+func (s *instrumentedStorage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	start := time.Now()
+	info, err := s.backend.Stat(ctx, key)
+	s.observe("stat", time.Since(start), err)
+	return info, err
+}
+
+// Copy duplicates an object, reporting the operation.
+func (s *instrumentedStorage) Copy(ctx context.Context, srcKey, dstKey string) (ObjectInfo, error) {
+	start := time.Now()
+	info, err := s.backend.Copy(ctx, srcKey, dstKey)
+	s.observe("copy", time.Since(start), err)
+	return info, err
+}
+
+// Delete removes an object, reporting the operation.
+func (s *instrumentedStorage) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	err := s.backend.Delete(ctx, key)
+	s.observe("delete", time.Since(start), err)
+	return err
+}
+
+// List returns the objects whose key starts with prefix, reporting the operation.
+func (s *instrumentedStorage) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	start := time.Now()
+	objects, err := s.backend.List(ctx, prefix)
+	s.observe("list", time.Since(start), err)
+	return objects, err
+}
+
+// NewMultipartUpload starts a multipart upload, reporting the operation.
+func (s *instrumentedStorage) NewMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	start := time.Now()
+	uploadID, err := s.multipart.NewMultipartUpload(ctx, key, contentType)
+	s.observe("new_multipart_upload", time.Since(start), err)
+	return uploadID, err
+}
+
+// PutPart uploads a part of a multipart upload, reporting the operation.
+func (s *instrumentedStorage) PutPart(ctx context.Context, key, uploadID string, number int, reader io.Reader, size int64) (Part, error) {
+	start := time.Now()
+	part, err := s.multipart.PutPart(ctx, key, uploadID, number, reader, size)
+	s.observe("put_part", time.Since(start), err)
+	return part, err
+}
+
+// CompleteMultipartUpload assembles a multipart upload, reporting the operation.
+func (s *instrumentedStorage) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) (ObjectInfo, error) {
+	start := time.Now()
+	info, err := s.multipart.CompleteMultipartUpload(ctx, key, uploadID, parts)
+	s.observe("complete_multipart_upload", time.Since(start), err)
+	return info, err
+}
+
+// AbortMultipartUpload drops a multipart upload, reporting the operation.
+func (s *instrumentedStorage) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	start := time.Now()
+	err := s.multipart.AbortMultipartUpload(ctx, key, uploadID)
+	s.observe("abort_multipart_upload", time.Since(start), err)
+	return err
+}
+
+// instrumentedPresigner is an instrumented backend that also presigns URLs.
+type instrumentedPresigner struct {
+	*instrumentedStorage
+	presigner Presigner
+}
+
+// PresignPut returns a URL to upload an object, reporting the operation.
+func (s *instrumentedPresigner) PresignPut(ctx context.Context, key string, expiry time.Duration) (*url.URL, error) {
+	start := time.Now()
+	u, err := s.presigner.PresignPut(ctx, key, expiry)
+	s.observe("presign_put", time.Since(start), err)
+	return u, err
+}
+
+// PresignGet returns a URL to download an object, reporting the operation.
+func (s *instrumentedPresigner) PresignGet(ctx context.Context, key string, expiry time.Duration, filename string) (*url.URL, error) {
+	start := time.Now()
+	u, err := s.presigner.PresignGet(ctx, key, expiry, filename)
+	s.observe("presign_get", time.Since(start), err)
+	return u, err
+}
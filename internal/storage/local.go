@@ -0,0 +1,286 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Local is the Storage backend that keeps the objects as plain files under a root directory.
+// It is meant for running the server on a laptop without an object storage service.
+type Local struct {
+	root string // Root directory of the stored objects
+}
+
+// NewLocal creates a Storage backend rooted at the given directory, creating it if needed.
+//
+// Parameters:
+//   - root (string): The directory where the objects are stored.
+//
+// Returns:
+//   - *Local: The local filesystem storage backend.
+//   - error: An error is returned if the root directory cannot be created.
+func NewLocal(root string) (*Local, error) {
+	if err := os.MkdirAll(root, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("cannot create storage directory %s: %v", root, err)
+	}
+	return &Local{root: root}, nil
+}
+
+// Put writes the content of reader to a temporary file and then moves it under key,
+// so that readers never see a partially written object.
+func (s *Local) Put(_ context.Context, key string, reader io.Reader, _ int64, contentType string) (ObjectInfo, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	// Write the content in a temporary file next to the destination
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to create file: %v", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once the file has been renamed
+
+	if _, err := io.Copy(tmp, reader); err != nil {
+		_ = tmp.Close()
+		return ObjectInfo{}, fmt.Errorf("failed to write object: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to close object: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to store object: %v", err)
+	}
+
+	info, err := s.Stat(context.Background(), key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if contentType != "" {
+		info.ContentType = contentType
+	}
+	return info, nil
+}
+
+// Get opens the file stored under key.
+func (s *Local) Get(_ context.Context, key string) (Object, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening object %s: %w", key, mapFileError(err))
+	}
+	return &localObject{File: file, key: key}, nil
+}
+
+// Stat returns the information about the file stored under key.
+func (s *Local) Stat(_ context.Context, key string) (ObjectInfo, error) {
+	filePath, err := s.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("error getting object info %s: %w", key, mapFileError(err))
+	}
+	if fileInfo.IsDir() {
+		return ObjectInfo{}, fmt.Errorf("error getting object info %s: %w", key, ErrNotFound)
+	}
+	return fileObjectInfo(key, fileInfo), nil
+}
+
+// Copy duplicates the file stored under srcKey. A hard link is tried first, so that no data is copied
+// when the filesystem supports it; the content is copied otherwise.
+func (s *Local) Copy(ctx context.Context, srcKey, dstKey string) (ObjectInfo, error) {
+	srcPath, err := s.path(srcKey)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	dstPath, err := s.path(dstKey)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dstPath), os.ModePerm); err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	// Replace the destination through a hard link when possible
+	_ = os.Remove(dstPath)
+	if err := os.Link(srcPath, dstPath); err == nil {
+		return s.Stat(ctx, dstKey)
+	}
+
+	// Fall back to a plain copy of the content
+	src, err := s.Get(ctx, srcKey)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer src.Close()
+	return s.Put(ctx, dstKey, src, -1, "")
+}
+
+// Delete removes the file stored under key.
+func (s *Local) Delete(_ context.Context, key string) error {
+	filePath, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error deleting object %s: %v", key, err)
+	}
+	return nil
+}
+
+// List walks the root directory and returns the files whose key starts with prefix.
+func (s *Local) List(_ context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(s.root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && filePath != s.root && strings.HasPrefix(entry.Name(), ".") {
+			// Skip the hidden directories, such as the parts of the multipart uploads
+			return filepath.SkipDir
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+		relative, err := filepath.Rel(s.root, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relative)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		fileInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, fileObjectInfo(key, fileInfo))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing objects: %v", err)
+	}
+	return objects, nil
+}
+
+// NewMultipartUpload creates the directory that holds the parts of a new multipart upload.
+func (s *Local) NewMultipartUpload(_ context.Context, key, _ string) (string, error) {
+	if _, err := s.path(key); err != nil {
+		return "", err
+	}
+	uploadID := rand.Text()
+	if err := os.MkdirAll(s.partsDir(uploadID), os.ModePerm); err != nil {
+		return "", fmt.Errorf("error starting multipart upload: %v", err)
+	}
+	return uploadID, nil
+}
+
+// PutPart writes a part of the multipart upload in its own file.
+func (s *Local) PutPart(_ context.Context, _, uploadID string, number int, reader io.Reader, _ int64) (Part, error) {
+	partPath := filepath.Join(s.partsDir(uploadID), strconv.Itoa(number))
+	file, err := os.Create(partPath)
+	if err != nil {
+		return Part{}, fmt.Errorf("error uploading part %d: %w", number, mapFileError(err))
+	}
+	size, err := io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Part{}, fmt.Errorf("error uploading part %d: %v", number, err)
+	}
+	return Part{Number: number, ETag: fmt.Sprintf("%x", size), Size: size}, nil
+}
+
+// CompleteMultipartUpload concatenates the parts in the object and removes them.
+func (s *Local) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) (ObjectInfo, error) {
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		file, err := os.Open(filepath.Join(s.partsDir(uploadID), strconv.Itoa(part.Number)))
+		if err != nil {
+			return ObjectInfo{}, fmt.Errorf("error completing multipart upload: %w", mapFileError(err))
+		}
+		defer file.Close()
+		readers = append(readers, file)
+	}
+	info, err := s.Put(ctx, key, io.MultiReader(readers...), -1, "")
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("error completing multipart upload: %v", err)
+	}
+	return info, s.AbortMultipartUpload(ctx, key, uploadID)
+}
+
+// AbortMultipartUpload removes the directory holding the parts.
+func (s *Local) AbortMultipartUpload(_ context.Context, _, uploadID string) error {
+	if err := os.RemoveAll(s.partsDir(uploadID)); err != nil {
+		return fmt.Errorf("error aborting multipart upload: %v", err)
+	}
+	return nil
+}
+
+// partsDir returns the hidden directory holding the parts of a multipart upload.
+func (s *Local) partsDir(uploadID string) string {
+	return filepath.Join(s.root, ".multipart", filepath.Base(uploadID))
+}
+
+// path converts key to a path under the root directory, rejecting keys that would escape it.
+func (s *Local) path(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || cleaned == "/" || cleaned != "/"+key {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(cleaned)), nil
+}
+
+// localObject adapts *os.File to the Object interface.
+type localObject struct {
+	*os.File
+	key string
+}
+
+// Stat returns the information about the file.
+func (o *localObject) Stat() (ObjectInfo, error) {
+	fileInfo, err := o.File.Stat()
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return fileObjectInfo(o.key, fileInfo), nil
+}
+
+// fileObjectInfo builds the ObjectInfo of a file. The ETag is derived from the modification time and
+// the size, as static file servers usually do.
+func fileObjectInfo(key string, fileInfo fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          key,
+		Size:         fileInfo.Size(),
+		ETag:         fmt.Sprintf("%x-%x", fileInfo.ModTime().UnixNano(), fileInfo.Size()),
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		LastModified: fileInfo.ModTime(),
+	}
+}
+
+// mapFileError translates the filesystem "not exist" errors to ErrNotFound.
+func mapFileError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	testStorage(t, func(t *testing.T) Storage {
+		store, err := NewLocal(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewLocal: %v", err)
+		}
+		return store
+	})
+}
+
+func TestLocalRejectsKeysOutsideRoot(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocal(filepath.Join(root, "data"))
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	ctx := context.Background()
+	for _, key := range []string{"", "/", "../escape", "a/../../escape", "/absolute", "a//b", "a/./b"} {
+		if _, err := store.Put(ctx, key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Put %q succeeded, want an error", key)
+		}
+		if _, err := store.Get(ctx, key); err == nil {
+			t.Errorf("Get %q succeeded, want an error", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "escape")); !os.IsNotExist(err) {
+		t.Errorf("a file was written outside the root: %v", err)
+	}
+}
+
+func TestLocalListSkipsMultipartParts(t *testing.T) {
+	store, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	ctx := context.Background()
+	uploadID, err := store.NewMultipartUpload(ctx, "tus/pending", "")
+	if err != nil {
+		t.Fatalf("NewMultipartUpload: %v", err)
+	}
+	if _, err := store.PutPart(ctx, "tus/pending", uploadID, 1, strings.NewReader("part"), 4); err != nil {
+		t.Fatalf("PutPart: %v", err)
+	}
+	mustPut(t, store, "tus/done", "done")
+
+	objects, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Key != "tus/done" {
+		t.Errorf("List = %+v, want only tus/done", objects)
+	}
+}
+
+func TestLocalDirectoryIsNotAnObject(t *testing.T) {
+	store, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	mustPut(t, store, "blobs/sha256/abc", "content")
+	if _, err := store.Stat(context.Background(), "blobs/sha256"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat of a directory: %v, want ErrNotFound", err)
+	}
+}
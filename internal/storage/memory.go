@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is the Storage backend that keeps the objects in memory. The content is lost when the process exits,
+// so it is only meant for unit tests and quick experiments.
+type Memory struct {
+	mu      sync.RWMutex              // Guards objects and uploads
+	objects map[string]*memoryObject  // Stored objects by key
+	uploads map[string]map[int][]byte // Parts of the multipart uploads by upload ID
+	nextID  int                       // Counter used to generate the upload IDs
+}
+
+// memoryObject is an object held by the Memory backend.
+type memoryObject struct {
+	info ObjectInfo // Information about the object
+	data []byte     // Content of the object
+}
+
+// NewMemory creates an empty in-memory Storage backend.
+func NewMemory() *Memory {
+	return &Memory{objects: make(map[string]*memoryObject), uploads: make(map[string]map[int][]byte)}
+}
+
+// Put reads the whole content of reader and stores it under key.
+func (s *Memory) Put(_ context.Context, key string, reader io.Reader, _ int64, contentType string) (ObjectInfo, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to read object: %v", err)
+	}
+	info := ObjectInfo{
+		Key:          key,
+		Size:         int64(len(data)),
+		ETag:         fmt.Sprintf("%x", md5.Sum(data)),
+		ContentType:  contentType,
+		LastModified: time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = &memoryObject{info: info, data: data}
+	return info, nil
+}
+
+// Get returns a reader over the content stored under key.
+func (s *Memory) Get(_ context.Context, key string) (Object, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	object, ok := s.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("error getting object %s: %w", key, ErrNotFound)
+	}
+	return &memoryReader{Reader: bytes.NewReader(object.data), info: object.info}, nil
+}
+
+// Stat returns the information about the object stored under key.
+func (s *Memory) Stat(_ context.Context, key string) (ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	object, ok := s.objects[key]
+	if !ok {
+		return ObjectInfo{}, fmt.Errorf("error getting object info %s: %w", key, ErrNotFound)
+	}
+	return object.info, nil
+}
+
+// Copy duplicates the object stored under srcKey. The content is immutable, so it is shared by both keys.
+func (s *Memory) Copy(_ context.Context, srcKey, dstKey string) (ObjectInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	object, ok := s.objects[srcKey]
+	if !ok {
+		return ObjectInfo{}, fmt.Errorf("error copying object %s: %w", srcKey, ErrNotFound)
+	}
+	info := object.info
+	info.Key = dstKey
+	info.LastModified = time.Now().UTC()
+	s.objects[dstKey] = &memoryObject{info: info, data: object.data}
+	return info, nil
+}
+
+// Delete removes the object stored under key.
+func (s *Memory) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+// List returns the objects whose key starts with prefix, sorted by key.
+func (s *Memory) List(_ context.Context, prefix string) ([]ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var objects []ObjectInfo
+	for key, object := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, object.info)
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// NewMultipartUpload starts a new multipart upload.
+func (s *Memory) NewMultipartUpload(_ context.Context, _, _ string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	uploadID := fmt.Sprintf("upload-%d", s.nextID)
+	s.uploads[uploadID] = make(map[int][]byte)
+	return uploadID, nil
+}
+
+// PutPart stores a part of the multipart upload.
+func (s *Memory) PutPart(_ context.Context, _, uploadID string, number int, reader io.Reader, _ int64) (Part, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return Part{}, fmt.Errorf("error uploading part %d: %v", number, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parts, ok := s.uploads[uploadID]
+	if !ok {
+		return Part{}, fmt.Errorf("error uploading part %d: upload %s: %w", number, uploadID, ErrNotFound)
+	}
+	parts[number] = data
+	return Part{Number: number, ETag: fmt.Sprintf("%x", md5.Sum(data)), Size: int64(len(data))}, nil
+}
+
+// CompleteMultipartUpload concatenates the parts in the object.
+func (s *Memory) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) (ObjectInfo, error) {
+	s.mu.Lock()
+	stored, ok := s.uploads[uploadID]
+	delete(s.uploads, uploadID)
+	s.mu.Unlock()
+	if !ok {
+		return ObjectInfo{}, fmt.Errorf("error completing multipart upload %s: %w", uploadID, ErrNotFound)
+	}
+
+	var content bytes.Buffer
+	for _, part := range parts {
+		data, ok := stored[part.Number]
+		if !ok {
+			return ObjectInfo{}, fmt.Errorf("error completing multipart upload: part %d: %w", part.Number, ErrNotFound)
+		}
+		content.Write(data)
+	}
+	return s.Put(ctx, key, &content, int64(content.Len()), "")
+}
+
+// AbortMultipartUpload drops the multipart upload.
+func (s *Memory) AbortMultipartUpload(_ context.Context, _, uploadID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.uploads, uploadID)
+	return nil
+}
+
+// memoryReader adapts *bytes.Reader to the Object interface.
+type memoryReader struct {
+	*bytes.Reader
+	info ObjectInfo
+}
+
+// Close is a no-op, the content stays in memory.
+func (r *memoryReader) Close() error {
+	return nil
+}
+
+// Stat returns the information about the object.
+func (r *memoryReader) Stat() (ObjectInfo, error) {
+	return r.info, nil
+}
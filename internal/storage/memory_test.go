@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	testStorage(t, func(t *testing.T) Storage {
+		return NewMemory()
+	})
+}
+
+func TestMemoryCopyIsIndependent(t *testing.T) {
+	// The copy shares the content of its source, replacing the source must not change it
+	store := NewMemory()
+	mustPut(t, store, "a", "original")
+	if _, err := store.Copy(context.Background(), "a", "b"); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	mustPut(t, store, "a", "replaced")
+	if got := mustRead(t, store, "b"); got != "original" {
+		t.Errorf("content of the copy = %q, want %q", got, "original")
+	}
+}
@@ -0,0 +1,314 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultPartSize is the size of the parts used by MinIO to upload a stream of unknown size. Without it
+// minio-go would size the parts for the largest possible object and allocate a huge buffer per upload.
+const DefaultPartSize = 16 << 20 // 16 MiB
+
+// MinIO is the Storage backend that keeps the objects in a bucket of a MinIO (or S3 compatible) server.
+type MinIO struct {
+	client   *minio.Client // MinIO client used for every operation
+	bucket   string        // Name of the bucket where objects are stored
+	region   string        // Region used when the bucket has to be created
+	partSize uint64        // Size of the parts of multipart uploads
+}
+
+// NewMinIO creates a Storage backend on top of an already configured MinIO client.
+//
+// Parameters:
+//   - client (*minio.Client): The MinIO client used to reach the server.
+//   - bucket (string): The name of the bucket holding the objects. It is created on the first upload if missing.
+//   - region (string): The region used when creating the bucket.
+//   - partSize (uint64): The size of the parts of multipart uploads, 0 for DefaultPartSize.
+//     Streams of unknown size are limited to 10000 parts of this size.
+//
+// Returns:
+//   - *MinIO: The MinIO storage backend.
+func NewMinIO(client *minio.Client, bucket, region string, partSize uint64) *MinIO {
+	if partSize == 0 {
+		partSize = DefaultPartSize
+	}
+	return &MinIO{client: client, bucket: bucket, region: region, partSize: partSize}
+}
+
+// Client returns the underlying MinIO client.
+func (s *MinIO) Client() *minio.Client {
+	return s.client
+}
+
+// Bucket returns the name of the bucket used by the backend.
+func (s *MinIO) Bucket() string {
+	return s.bucket
+}
+
+// Put uploads the content of reader to the bucket, creating the bucket if it doesn't exist.
+func (s *MinIO) Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (ObjectInfo, error) {
+	// Check if the bucket exists, create it if not
+	if err := s.createBucketIfNotExists(ctx); err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to create bucket: %v", err)
+	}
+
+	// Upload the content to MinIO, streaming it in parts when it is large or its size is unknown
+	info, err := s.client.PutObject(ctx, s.bucket, key, reader, size, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    s.partSize,
+	})
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to upload object: %v", err)
+	}
+	return ObjectInfo{
+		Key:          key,
+		Size:         info.Size,
+		ETag:         info.ETag,
+		ContentType:  contentType,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+// Get returns a handle to the object. The content is not downloaded here: every Read after a Seek issues a
+// ranged GetObject call starting at the current offset, so serving a byte range only transfers that range.
+func (s *MinIO) Get(ctx context.Context, key string) (Object, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &minioObject{ctx: ctx, core: minio.Core{Client: s.client}, bucket: s.bucket, info: info}, nil
+}
+
+// Stat returns the information about the object without downloading it.
+func (s *MinIO) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("error getting object info from MinIO: %w", mapMinIOError(err))
+	}
+	return toObjectInfo(info), nil
+}
+
+// Copy duplicates the object server side. ComposeObject falls back to a single CopyObject call for objects
+// up to 5 GiB and switches to a multipart copy for larger ones.
+func (s *MinIO) Copy(ctx context.Context, srcKey, dstKey string) (ObjectInfo, error) {
+	_, err := s.client.ComposeObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucket, Object: dstKey},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: srcKey},
+	)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("error copying object %s to %s: %w", srcKey, dstKey, mapMinIOError(err))
+	}
+	return s.Stat(ctx, dstKey)
+}
+
+// Delete removes the object from the bucket.
+func (s *MinIO) Delete(ctx context.Context, key string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("error deleting object from MinIO: %v", err)
+	}
+	return nil
+}
+
+// List returns the objects of the bucket whose key starts with prefix.
+func (s *MinIO) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, fmt.Errorf("error listing objects from MinIO: %v", info.Err)
+		}
+		objects = append(objects, toObjectInfo(info))
+	}
+	return objects, nil
+}
+
+// NewMultipartUpload starts a multipart upload on the bucket, creating the bucket if it doesn't exist.
+func (s *MinIO) NewMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	if err := s.createBucketIfNotExists(ctx); err != nil {
+		return "", fmt.Errorf("failed to create bucket: %v", err)
+	}
+	uploadID, err := minio.Core{Client: s.client}.NewMultipartUpload(ctx, s.bucket, key, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return "", fmt.Errorf("error starting multipart upload: %v", err)
+	}
+	return uploadID, nil
+}
+
+// PutPart uploads a part of the multipart upload.
+func (s *MinIO) PutPart(ctx context.Context, key, uploadID string, number int, reader io.Reader, size int64) (Part, error) {
+	part, err := minio.Core{Client: s.client}.PutObjectPart(ctx, s.bucket, key, uploadID, number, reader, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return Part{}, fmt.Errorf("error uploading part %d: %v", number, err)
+	}
+	return Part{Number: number, ETag: part.ETag, Size: part.Size}, nil
+}
+
+// CompleteMultipartUpload assembles the object from the given parts.
+func (s *MinIO) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) (ObjectInfo, error) {
+	completeParts := make([]minio.CompletePart, len(parts))
+	for i, part := range parts {
+		completeParts[i] = minio.CompletePart{PartNumber: part.Number, ETag: part.ETag}
+	}
+	if _, err := (minio.Core{Client: s.client}).CompleteMultipartUpload(ctx, s.bucket, key, uploadID, completeParts, minio.PutObjectOptions{}); err != nil {
+		return ObjectInfo{}, fmt.Errorf("error completing multipart upload: %v", err)
+	}
+	return s.Stat(ctx, key)
+}
+
+// AbortMultipartUpload drops the multipart upload and all its parts.
+func (s *MinIO) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	if err := (minio.Core{Client: s.client}).AbortMultipartUpload(ctx, s.bucket, key, uploadID); err != nil {
+		return fmt.Errorf("error aborting multipart upload: %v", err)
+	}
+	return nil
+}
+
+// PresignPut returns a presigned PUT URL for the object, creating the bucket if it doesn't exist
+// so that the client can upload to it right away.
+func (s *MinIO) PresignPut(ctx context.Context, key string, expiry time.Duration) (*url.URL, error) {
+	if err := s.createBucketIfNotExists(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create bucket: %v", err)
+	}
+	presigned, err := s.client.PresignedPutObject(ctx, s.bucket, key, expiry)
+	if err != nil {
+		return nil, fmt.Errorf("error presigning upload of %s: %v", key, err)
+	}
+	return presigned, nil
+}
+
+// PresignGet returns a presigned GET URL for the object. The file name is sent back by MinIO
+// in the Content-Disposition header of the response.
+func (s *MinIO) PresignGet(ctx context.Context, key string, expiry time.Duration, filename string) (*url.URL, error) {
+	params := make(url.Values)
+	if filename != "" {
+		params.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
+	presigned, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, params)
+	if err != nil {
+		return nil, fmt.Errorf("error presigning download of %s: %v", key, err)
+	}
+	return presigned, nil
+}
+
+// createBucketIfNotExists checks if the bucket exists and creates it if it doesn't.
+func (s *MinIO) createBucketIfNotExists(ctx context.Context) error {
+	// Check if the bucket already exists
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("failed to check if bucket exists: %v", err)
+	}
+
+	// If the bucket doesn't exist, create it
+	if !exists {
+		slog.InfoContext(ctx, "Bucket does not exist, creating it", "bucket", s.bucket)
+		if err = s.client.MakeBucket(ctx, s.bucket, minio.MakeBucketOptions{Region: s.region}); err != nil {
+			return fmt.Errorf("failed to create bucket: %v", err)
+		}
+		slog.InfoContext(ctx, "Bucket created", "bucket", s.bucket)
+	}
+	return nil
+}
+
+// minioObject is a seekable reader over a MinIO object, backed by ranged GetObject calls.
+type minioObject struct {
+	ctx    context.Context // Context of the request that opened the object
+	core   minio.Core      // Low level client returning the raw response body
+	bucket string          // Bucket holding the object
+	info   ObjectInfo      // Information about the object, fetched when it was opened
+	offset int64           // Current read offset
+	body   io.ReadCloser   // Body of the current ranged request, nil until the next Read
+}
+
+// Read reads from the current ranged request, starting a new one at the current offset if needed.
+func (o *minioObject) Read(p []byte) (int, error) {
+	if o.offset >= o.info.Size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		opts := minio.GetObjectOptions{}
+		if o.offset > 0 {
+			if err := opts.SetRange(o.offset, 0); err != nil {
+				return 0, err
+			}
+		}
+		// Make sure that all the ranges are read from the same version of the object
+		if o.info.ETag != "" {
+			if err := opts.SetMatchETag(o.info.ETag); err != nil {
+				return 0, err
+			}
+		}
+		body, _, _, err := o.core.GetObject(o.ctx, o.bucket, o.info.Key, opts)
+		if err != nil {
+			return 0, fmt.Errorf("error getting object from MinIO: %w", mapMinIOError(err))
+		}
+		o.body = body
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+// Seek moves the read offset. The current ranged request is dropped when the offset changes.
+func (o *minioObject) Seek(offset int64, whence int) (int64, error) {
+	var position int64
+	switch whence {
+	case io.SeekStart:
+		position = offset
+	case io.SeekCurrent:
+		position = o.offset + offset
+	case io.SeekEnd:
+		position = o.info.Size + offset
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if position < 0 {
+		return 0, fmt.Errorf("negative position %d", position)
+	}
+	if position != o.offset && o.body != nil {
+		_ = o.body.Close()
+		o.body = nil
+	}
+	o.offset = position
+	return position, nil
+}
+
+// Close closes the current ranged request, if any.
+func (o *minioObject) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
+
+// Stat returns the information about the object.
+func (o *minioObject) Stat() (ObjectInfo, error) {
+	return o.info, nil
+}
+
+// toObjectInfo converts the MinIO object information to ObjectInfo.
+func toObjectInfo(info minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ETag:         info.ETag,
+		ContentType:  info.ContentType,
+		LastModified: info.LastModified,
+	}
+}
+
+// mapMinIOError translates the MinIO "not found" responses to ErrNotFound.
+func mapMinIOError(err error) error {
+	response := minio.ToErrorResponse(err)
+	if response.StatusCode == http.StatusNotFound || response.Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	return err
+}
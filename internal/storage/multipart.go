@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// MinPartSize is the minimum size of every part of a multipart upload but the last one, as required by S3.
+const MinPartSize = 5 << 20 // 5 MiB
+
+// Part describes a part of a multipart upload.
+type Part struct {
+	Number int    // Number of the part, starting from 1
+	ETag   string // Entity tag returned when the part was uploaded
+	Size   int64  // Size of the part in bytes
+}
+
+// Multipart is implemented by the Storage backends that can assemble an object from parts uploaded
+// independently, possibly by different requests. Uploading a part with the number of an existing part
+// replaces it.
+type Multipart interface {
+	// NewMultipartUpload starts a multipart upload of the object key and returns its upload ID.
+	NewMultipartUpload(ctx context.Context, key, contentType string) (string, error)
+	// PutPart uploads a part of the multipart upload.
+	PutPart(ctx context.Context, key, uploadID string, number int, reader io.Reader, size int64) (Part, error)
+	// CompleteMultipartUpload assembles the object from the given parts, in order.
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) (ObjectInfo, error)
+	// AbortMultipartUpload drops the multipart upload and all its parts.
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
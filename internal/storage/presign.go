@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// MaxPresignExpiry is the longest validity of a presigned URL accepted by S3.
+const MaxPresignExpiry = 7 * 24 * time.Hour
+
+// Presigner is implemented by the Storage backends that let clients read and write objects directly,
+// through URLs signed by the server that expire after a while.
+type Presigner interface {
+	// PresignPut returns a URL to upload the object key with a PUT request.
+	PresignPut(ctx context.Context, key string, expiry time.Duration) (*url.URL, error)
+	// PresignGet returns a URL to download the object key with a GET request. When filename is not empty
+	// the response asks the client to save the object under that name.
+	PresignGet(ctx context.Context, key string, expiry time.Duration, filename string) (*url.URL, error)
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned by a Storage backend when the requested object does not exist.
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo describes an object held by a Storage backend.
+type ObjectInfo struct {
+	Key          string    // Key of the object inside the backend
+	Size         int64     // Size of the object in bytes
+	ETag         string    // Entity tag of the object (without quotes)
+	ContentType  string    // MIME type stored with the object, if any
+	LastModified time.Time // Time of the last modification of the object
+}
+
+// Object is a readable and seekable handle to an object returned by Storage.Get.
+// Callers must always Close it once done.
+type Object interface {
+	io.ReadSeekCloser
+	// Stat returns the information about the object.
+	Stat() (ObjectInfo, error)
+}
+
+// Storage is the interface implemented by every object storage backend (MinIO, local filesystem, memory).
+// Keys are slash separated paths relative to the root of the backend (bucket, directory, ...).
+type Storage interface {
+	// Put stores the content read from reader under key. Size may be -1 when it is not known in advance.
+	Put(ctx context.Context, key string, reader io.Reader, size int64, contentType string) (ObjectInfo, error)
+	// Get opens the object stored under key.
+	Get(ctx context.Context, key string) (Object, error)
+	// Stat returns the information about the object stored under key.
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Copy duplicates the object stored under srcKey to dstKey, inside the backend.
+	Copy(ctx context.Context, srcKey, dstKey string) (ObjectInfo, error)
+	// Delete removes the object stored under key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns all the objects whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
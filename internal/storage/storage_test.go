@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testStorage runs the checks that every Storage backend must pass, on fresh backends created by newStorage.
+func testStorage(t *testing.T, newStorage func(t *testing.T) Storage) {
+	ctx := context.Background()
+
+	t.Run("PutGetStat", func(t *testing.T) {
+		store := newStorage(t)
+		info, err := store.Put(ctx, "docs/a.txt", strings.NewReader("hello"), 5, "text/plain")
+		if err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		if info.Key != "docs/a.txt" || info.Size != 5 || info.ETag == "" {
+			t.Errorf("Put returned %+v", info)
+		}
+
+		object, err := store.Get(ctx, "docs/a.txt")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		defer object.Close()
+		content, err := io.ReadAll(object)
+		if err != nil {
+			t.Fatalf("reading object: %v", err)
+		}
+		if string(content) != "hello" {
+			t.Errorf("content = %q, want %q", content, "hello")
+		}
+
+		// The object is seekable, as http.ServeContent needs for the ranges
+		if _, err := object.Seek(1, io.SeekStart); err != nil {
+			t.Fatalf("Seek: %v", err)
+		}
+		rest, _ := io.ReadAll(object)
+		if string(rest) != "ello" {
+			t.Errorf("content after seek = %q, want %q", rest, "ello")
+		}
+
+		objectInfo, err := object.Stat()
+		if err != nil {
+			t.Fatalf("Object.Stat: %v", err)
+		}
+		stat, err := store.Stat(ctx, "docs/a.txt")
+		if err != nil {
+			t.Fatalf("Stat: %v", err)
+		}
+		if stat.Size != 5 || stat.ETag != objectInfo.ETag || stat.LastModified.IsZero() {
+			t.Errorf("Stat = %+v, Object.Stat = %+v", stat, objectInfo)
+		}
+	})
+
+	t.Run("PutReplaces", func(t *testing.T) {
+		store := newStorage(t)
+		mustPut(t, store, "a", "first")
+		mustPut(t, store, "a", "second, longer")
+		if got := mustRead(t, store, "a"); got != "second, longer" {
+			t.Errorf("content = %q, want the second one", got)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := newStorage(t)
+		if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get of a missing object: %v, want ErrNotFound", err)
+		}
+		if _, err := store.Stat(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Stat of a missing object: %v, want ErrNotFound", err)
+		}
+		if _, err := store.Copy(ctx, "missing", "other"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Copy of a missing object: %v, want ErrNotFound", err)
+		}
+		if err := store.Delete(ctx, "missing"); err != nil {
+			t.Errorf("Delete of a missing object: %v, want no error", err)
+		}
+	})
+
+	t.Run("CopyDelete", func(t *testing.T) {
+		store := newStorage(t)
+		mustPut(t, store, "uploads/staged", "content")
+		info, err := store.Copy(ctx, "uploads/staged", "blobs/sha256/abc")
+		if err != nil {
+			t.Fatalf("Copy: %v", err)
+		}
+		if info.Key != "blobs/sha256/abc" || info.Size != 7 {
+			t.Errorf("Copy returned %+v", info)
+		}
+
+		// The copy outlives its source
+		if err := store.Delete(ctx, "uploads/staged"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := store.Stat(ctx, "uploads/staged"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Stat of a deleted object: %v, want ErrNotFound", err)
+		}
+		if got := mustRead(t, store, "blobs/sha256/abc"); got != "content" {
+			t.Errorf("content of the copy = %q, want %q", got, "content")
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		store := newStorage(t)
+		for _, key := range []string{"tus/1", "tus/2.tail-10", "blobs/sha256/x", "tusk"} {
+			mustPut(t, store, key, key)
+		}
+		objects, err := store.List(ctx, "tus/")
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		keys := make([]string, len(objects))
+		for i, object := range objects {
+			keys[i] = object.Key
+		}
+		slices.Sort(keys)
+		if want := []string{"tus/1", "tus/2.tail-10"}; !slices.Equal(keys, want) {
+			t.Errorf("List = %v, want %v", keys, want)
+		}
+	})
+
+	t.Run("Multipart", func(t *testing.T) {
+		store := newStorage(t)
+		multipart, ok := store.(Multipart)
+		if !ok {
+			t.Skip("the backend does not support multipart uploads")
+		}
+		uploadID, err := multipart.NewMultipartUpload(ctx, "tus/object", "application/octet-stream")
+		if err != nil {
+			t.Fatalf("NewMultipartUpload: %v", err)
+		}
+
+		// The parts are assembled in the order given, and a part uploaded again replaces the previous one
+		contents := map[int]string{1: "one-", 2: "two-", 3: "three"}
+		parts := make([]Part, 0, len(contents))
+		for number := 1; number <= 3; number++ {
+			if number == 2 {
+				if _, err := multipart.PutPart(ctx, "tus/object", uploadID, 2, strings.NewReader("stale"), 5); err != nil {
+					t.Fatalf("PutPart: %v", err)
+				}
+			}
+			part, err := multipart.PutPart(ctx, "tus/object", uploadID, number, strings.NewReader(contents[number]), int64(len(contents[number])))
+			if err != nil {
+				t.Fatalf("PutPart %d: %v", number, err)
+			}
+			if part.Number != number || part.Size != int64(len(contents[number])) {
+				t.Errorf("PutPart %d returned %+v", number, part)
+			}
+			parts = append(parts, part)
+		}
+		info, err := multipart.CompleteMultipartUpload(ctx, "tus/object", uploadID, parts)
+		if err != nil {
+			t.Fatalf("CompleteMultipartUpload: %v", err)
+		}
+		if info.Size != 13 {
+			t.Errorf("size of the assembled object = %d, want 13", info.Size)
+		}
+		if got := mustRead(t, store, "tus/object"); got != "one-two-three" {
+			t.Errorf("assembled content = %q, want %q", got, "one-two-three")
+		}
+
+		// The parts are dropped once assembled
+		if _, err := multipart.PutPart(ctx, "tus/object", uploadID, 4, strings.NewReader("x"), 1); err == nil {
+			t.Errorf("PutPart after completion succeeded, want an error")
+		}
+	})
+
+	t.Run("MultipartAbort", func(t *testing.T) {
+		store := newStorage(t)
+		multipart, ok := store.(Multipart)
+		if !ok {
+			t.Skip("the backend does not support multipart uploads")
+		}
+		uploadID, err := multipart.NewMultipartUpload(ctx, "tus/aborted", "application/octet-stream")
+		if err != nil {
+			t.Fatalf("NewMultipartUpload: %v", err)
+		}
+		part, err := multipart.PutPart(ctx, "tus/aborted", uploadID, 1, bytes.NewReader([]byte("data")), 4)
+		if err != nil {
+			t.Fatalf("PutPart: %v", err)
+		}
+		if err := multipart.AbortMultipartUpload(ctx, "tus/aborted", uploadID); err != nil {
+			t.Fatalf("AbortMultipartUpload: %v", err)
+		}
+		if _, err := multipart.CompleteMultipartUpload(ctx, "tus/aborted", uploadID, []Part{part}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("CompleteMultipartUpload of an aborted upload: %v, want ErrNotFound", err)
+		}
+		if _, err := store.Stat(ctx, "tus/aborted"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Stat of an aborted upload: %v, want ErrNotFound", err)
+		}
+	})
+}
+
+// mustPut stores content under key, failing the test on error.
+func mustPut(t *testing.T, store Storage, key, content string) {
+	t.Helper()
+	if _, err := store.Put(context.Background(), key, strings.NewReader(content), int64(len(content)), ""); err != nil {
+		t.Fatalf("Put %s: %v", key, err)
+	}
+}
+
+// mustRead returns the content stored under key, failing the test on error.
+func mustRead(t *testing.T, store Storage, key string) string {
+	t.Helper()
+	object, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get %s: %v", key, err)
+	}
+	defer object.Close()
+	content, err := io.ReadAll(object)
+	if err != nil {
+		t.Fatalf("reading %s: %v", key, err)
+	}
+	return string(content)
+}
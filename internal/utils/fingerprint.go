@@ -1,35 +1,63 @@
 package utils
 
 import (
-	"crypto/sha1"
+	"crypto/sha256"
 	"fmt"
+	"hash"
 	"io"
-	"log"
+	"log/slog"
+	"lukechampine.com/blake3"
 	"os"
 )
 
-// CalculateFingerprint calculates the fingerprint (SHA-1 hash) of a file at a given path.
+// Supported fingerprint (hash) algorithms.
+const (
+	FingerprintSHA256 = "sha256" // SHA-256, the default algorithm
+	FingerprintBLAKE3 = "blake3" // BLAKE3 with a 256 bit output, faster on large files
+)
+
+// NewFingerprintHash returns a new hash for the given fingerprint algorithm.
+//
+// Parameters:
+//   - algorithm (string): The name of the algorithm ("sha256" or "blake3"). An empty string selects SHA-256.
+//
+// Returns:
+//   - hash.Hash: The hash implementing the algorithm.
+//   - error: An error is returned if the algorithm is not supported.
+func NewFingerprintHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case "", FingerprintSHA256:
+		return sha256.New(), nil
+	case FingerprintBLAKE3:
+		return blake3.New(32, nil), nil
+	default:
+		return nil, fmt.Errorf("fingerprint algorithm %s is not supported", algorithm)
+	}
+}
+
+// CalculateFingerprint calculates the fingerprint of a file at a given path.
 //
-// This function computes a SHA-1 hash for the contents of a file. It opens the file, reads it in chunks
-// to avoid loading the entire file into memory, and then calculates the hash using the SHA-1 algorithm.
-// Finally, it returns the resulting hash as a hexadecimal string.
+// This function computes a hash for the contents of a file. It opens the file, reads it in chunks
+// to avoid loading the entire file into memory, and then calculates the hash using the given algorithm.
+// Finally, it returns the resulting fingerprint in the "<algorithm>:<hexadecimal hash>" form.
 //
 // Parameters:
 //   - filePath (string): The path to the file whose fingerprint (hash) is to be calculated.
+//   - algorithm (string): The hash algorithm to use ("sha256" or "blake3").
 //
 // Returns:
-//   - string: The SHA-1 hash of the file, represented as a hexadecimal string.
+//   - string: The fingerprint of the file.
 //   - error: Any error encountered while opening the file, reading it, or calculating the hash.
 //     If no error occurred, it returns nil.
 //
 // Example usage:
 //
-//	fingerprint, err := utils.CalculateFingerprint("/path/to/file.txt")
+//	fingerprint, err := utils.CalculateFingerprint("/path/to/file.txt", utils.FingerprintSHA256)
 //	if err != nil {
 //	    log.Fatalf("Error calculating fingerprint: %v", err)
 //	}
 //	fmt.Printf("Fingerprint: %s\n", fingerprint)
-func CalculateFingerprint(filePath string) (string, error) {
+func CalculateFingerprint(filePath, algorithm string) (string, error) {
 	// Open the file at the specified file path.
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -39,19 +67,80 @@ func CalculateFingerprint(filePath string) (string, error) {
 	defer func(file *os.File) {
 		err := file.Close()
 		if err != nil {
-			log.Fatalf("failed to close file: %v", err)
+			slog.Warn("Failed to close file", "path", file.Name(), "error", err)
 		}
 	}(file)
 
-	// Create a new SHA-1 hash object.
-	hash := sha1.New()
-
-	// Read the file and calculate the hash while reading. The entire file is not loaded into memory.
-	_, err = io.Copy(hash, file)
+	// Read the file through a fingerprint reader: the entire file is not loaded into memory.
+	reader, err := NewFingerprintReader(file, algorithm)
 	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(io.Discard, reader); err != nil {
 		return "", fmt.Errorf("failed to calculate hash: %v", err)
 	}
 
-	// Return the final hash as a hexadecimal string.
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+	// Return the final fingerprint.
+	return reader.Fingerprint(), nil
+}
+
+// FingerprintReader wraps an io.Reader and calculates the fingerprint (hash) and the size
+// of the content while it is being read, so that a stream can be hashed while it is copied elsewhere.
+//
+// Example usage:
+//
+//	reader, err := utils.NewFingerprintReader(body, utils.FingerprintBLAKE3)
+//	if err != nil {
+//	    return err
+//	}
+//	if _, err := io.Copy(destination, reader); err != nil {
+//	    return err
+//	}
+//	fmt.Printf("Fingerprint: %s (%d bytes)\n", reader.Fingerprint(), reader.Size())
+type FingerprintReader struct {
+	reader    io.Reader // Underlying reader
+	algorithm string    // Name of the hash algorithm
+	hash      hash.Hash // Hash updated with every byte read
+	size      int64     // Number of bytes read so far
+}
+
+// NewFingerprintReader returns a FingerprintReader reading from reader.
+//
+// Parameters:
+//   - reader (io.Reader): The stream whose content is hashed.
+//   - algorithm (string): The hash algorithm to use ("sha256" or "blake3"). An empty string selects SHA-256.
+//
+// Returns:
+//   - *FingerprintReader: The reader that hashes the content while it is read.
+//   - error: An error is returned if the algorithm is not supported.
+func NewFingerprintReader(reader io.Reader, algorithm string) (*FingerprintReader, error) {
+	h, err := NewFingerprintHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm == "" {
+		algorithm = FingerprintSHA256
+	}
+	return &FingerprintReader{reader: reader, algorithm: algorithm, hash: h}, nil
+}
+
+// Read reads from the underlying reader and updates the hash and the size with the bytes read.
+func (r *FingerprintReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.hash.Write(p[:n])
+		r.size += int64(n)
+	}
+	return n, err
+}
+
+// Fingerprint returns the fingerprint of the content read so far, in the "<algorithm>:<hexadecimal hash>"
+// form, so that fingerprints calculated with different algorithms never collide.
+func (r *FingerprintReader) Fingerprint() string {
+	return fmt.Sprintf("%s:%x", r.algorithm, r.hash.Sum(nil))
+}
+
+// Size returns the number of bytes read so far.
+func (r *FingerprintReader) Size() int64 {
+	return r.size
 }
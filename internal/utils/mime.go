@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// SniffLength is the number of leading bytes of a content used to detect its MIME type.
+const SniffLength = 512
+
+// DetectMimeType detects the MIME type of a file from its first bytes and its name.
+//
+// http.DetectContentType recognises the signature of the most common binary formats, but it falls back to
+// generic types for the formats it does not know (e.g. application/zip for docx, text/plain for csv or json).
+// In those cases the type registered for the file extension is more precise and is preferred.
+//
+// Parameters:
+//   - head ([]byte): The first bytes of the content, up to SniffLength.
+//   - filename (string): The name of the file, used for its extension.
+//
+// Returns:
+//   - string: The detected MIME type.
+func DetectMimeType(head []byte, filename string) string {
+	sniffed := http.DetectContentType(head)
+	byExtension := mime.TypeByExtension(FileExtension(filename))
+	if byExtension == "" {
+		return sniffed
+	}
+
+	base, _, _ := strings.Cut(sniffed, ";")
+	switch base {
+	case "application/octet-stream", "text/plain", "application/zip":
+		return byExtension
+	default:
+		return sniffed
+	}
+}
+
+// FileExtension returns the lower case extension of a file name, including the dot (e.g. ".pdf").
+func FileExtension(filename string) string {
+	return strings.ToLower(filepath.Ext(filename))
+}